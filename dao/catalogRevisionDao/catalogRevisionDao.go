@@ -0,0 +1,57 @@
+package catalogRevisionDao
+
+import (
+	"errors"
+
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+
+	"gorm.io/gorm"
+)
+
+const (
+	table = "catalog_revision"
+	rowID = 1
+)
+
+// Next takes the next revision for a write, tx has to be the transaction of
+// the write. The row stays locked until tx ends, so the writes commit in the
+// order of their revisions, and the revision is read back without a second
+// query on the row. The catalog writes are serialized by this lock: they go
+// through at most one per commit round trip, a few hundred per second, so a
+// write should take its revision last, just before its own statements.
+func Next(tx *gorm.DB) (uint64, error) {
+	var revision uint64
+	// LAST_INSERT_ID is per connection, the transaction keeps both statements
+	// on the same one
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		updated := tx.Table(table).
+			Where(table+".id = ?", rowID).
+			Update("revision", gorm.Expr("LAST_INSERT_ID(revision + 1)"))
+		if updated.Error != nil {
+			return updated.Error
+		}
+		if updated.RowsAffected == 0 {
+			return errors.New("catalog revision row missing")
+		}
+		return tx.Raw("SELECT LAST_INSERT_ID()").Scan(&revision).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return revision, nil
+}
+
+// Current returns the revision of the last committed write
+func Current(tx *gorm.DB) (uint64, error) {
+	result := &models.CatalogRevisionModel{}
+	err := tx.Table(table).
+		Where(table+".id = ?", rowID).
+		Take(result).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, errors.New("catalog revision row missing")
+	}
+	if err != nil {
+		return 0, err
+	}
+	return result.Revision, nil
+}
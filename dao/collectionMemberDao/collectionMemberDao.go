@@ -0,0 +1,159 @@
+package collectionMemberDao
+
+import (
+	"errors"
+
+	"github.com/paper-trade-chatbot/be-common/pagination"
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+	"github.com/paper-trade-chatbot/be-proto/general"
+
+	"gorm.io/gorm"
+)
+
+const table = "collection_member"
+
+// QueryModel set query condition, used by queryChain()
+type QueryModel struct {
+	CollectionID uint64
+	ProductID    uint64
+	// ExistingProducts leaves out the members whose product is gone or
+	// deleted
+	ExistingProducts bool
+}
+
+// New a row
+func New(tx *gorm.DB, model *models.CollectionMemberModel) (uint64, error) {
+
+	err := tx.Table(table).
+		Create(model).Error
+
+	if err != nil {
+		return 0, err
+	}
+	return model.ID, nil
+}
+
+// Gets return records as raw-data-form, in the collection order
+func Gets(tx *gorm.DB, query *QueryModel) ([]models.CollectionMemberModel, error) {
+	result := make([]models.CollectionMemberModel, 0)
+	err := tx.Table(table).
+		Scopes(queryChain(query)).
+		Order(table + ".sort_order").
+		Scan(&result).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return []models.CollectionMemberModel{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func GetsWithPagination(tx *gorm.DB, query *QueryModel, paginate *general.Pagination) ([]models.CollectionMemberModel, *general.PaginationInfo, error) {
+
+	if paginate == nil || paginate.Page < 1 || paginate.PageSize < 1 {
+		return nil, nil, errors.New("invalid pagination")
+	}
+
+	var rows []models.CollectionMemberModel
+	var count int64 = 0
+	err := tx.Table(table).
+		Scopes(queryChain(query)).
+		Count(&count).
+		Select(table + ".*").
+		Order(table + ".sort_order").
+		Scopes(paginateChain(paginate)).
+		Scan(&rows).Error
+
+	offset, _ := pagination.GetOffsetAndLimit(paginate)
+	paginationInfo := pagination.SetPaginationDto(paginate.Page, paginate.PageSize, int32(count), int32(offset))
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return []models.CollectionMemberModel{}, paginationInfo, nil
+	}
+
+	if err != nil {
+		return []models.CollectionMemberModel{}, nil, err
+	}
+
+	return rows, paginationInfo, nil
+}
+
+// Delete delete records
+func Delete(tx *gorm.DB, query *QueryModel) error {
+	if query.CollectionID == 0 {
+		return errors.New("delete without collection id")
+	}
+
+	return tx.Table(table).
+		Scopes(queryChain(query)).
+		Delete(&models.CollectionMemberModel{}).Error
+}
+
+func queryChain(query *QueryModel) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.
+			Scopes(collectionIDEqualScope(query.CollectionID)).
+			Scopes(productIDEqualScope(query.ProductID)).
+			Scopes(existingProductsScope(query.ExistingProducts))
+
+	}
+}
+
+func paginateChain(paginate *general.Pagination) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		offset, limit := pagination.GetOffsetAndLimit(paginate)
+		return db.
+			Scopes(offsetScope(offset)).
+			Scopes(limitScope(limit))
+
+	}
+}
+
+func collectionIDEqualScope(collectionID uint64) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if collectionID != 0 {
+			return db.Where(table+".collection_id = ?", collectionID)
+		}
+		return db
+	}
+}
+
+func productIDEqualScope(productID uint64) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if productID != 0 {
+			return db.Where(table+".product_id = ?", productID)
+		}
+		return db
+	}
+}
+
+func existingProductsScope(existingProducts bool) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if existingProducts {
+			return db.Joins("JOIN product ON product.id = " + table + ".product_id AND product.deleted_at IS NULL")
+		}
+		return db
+	}
+}
+
+func limitScope(limit int) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if limit > 0 {
+			return db.Limit(limit)
+		}
+		return db
+	}
+}
+
+func offsetScope(offset int) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if offset > 0 {
+			return db.Offset(offset)
+		}
+		return db
+	}
+}
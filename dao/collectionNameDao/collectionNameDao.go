@@ -0,0 +1,95 @@
+package collectionNameDao
+
+import (
+	"errors"
+
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const table = "collection_name"
+
+// QueryModel set query condition, used by queryChain()
+type QueryModel struct {
+	CollectionID  uint64
+	CollectionIDs []uint64
+	Locales       []string
+}
+
+// Upsert insert a row, or replace the names of the existing (collection_id, locale) row
+func Upsert(tx *gorm.DB, model *models.CollectionNameModel) error {
+
+	return tx.Table(table).
+		Clauses(clause.OnConflict{
+			DoUpdates: clause.AssignmentColumns([]string{"title", "description"}),
+		}).
+		Create(model).Error
+}
+
+// Gets return records as raw-data-form
+func Gets(tx *gorm.DB, query *QueryModel) ([]models.CollectionNameModel, error) {
+	result := make([]models.CollectionNameModel, 0)
+	err := tx.Table(table).
+		Scopes(queryChain(query)).
+		Scan(&result).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return []models.CollectionNameModel{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Delete delete records
+func Delete(tx *gorm.DB, query *QueryModel) error {
+	if query.CollectionID == 0 && len(query.CollectionIDs) == 0 {
+		return errors.New("delete without collection id")
+	}
+
+	return tx.Table(table).
+		Scopes(queryChain(query)).
+		Delete(&models.CollectionNameModel{}).Error
+}
+
+func queryChain(query *QueryModel) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.
+			Scopes(collectionIDEqualScope(query.CollectionID)).
+			Scopes(collectionIDInScope(query.CollectionIDs)).
+			Scopes(localeInScope(query.Locales))
+
+	}
+}
+
+func collectionIDEqualScope(collectionID uint64) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if collectionID != 0 {
+			return db.Where(table+".collection_id = ?", collectionID)
+		}
+		return db
+	}
+}
+
+func collectionIDInScope(collectionIDs []uint64) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if len(collectionIDs) > 0 {
+			return db.Where(table+".collection_id IN ?", collectionIDs)
+		}
+		return db
+	}
+}
+
+func localeInScope(locales []string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if len(locales) > 0 {
+			return db.Where(table+".locale IN ?", locales)
+		}
+		return db
+	}
+}
@@ -0,0 +1,159 @@
+package eventOutboxDao
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const table = "event_outbox"
+
+// New a row
+func New(tx *gorm.DB, model *models.EventOutboxModel) (uint64, error) {
+
+	err := tx.Table(table).
+		Create(model).Error
+
+	if err != nil {
+		return 0, err
+	}
+	return model.ID, nil
+}
+
+// Record adds a pending event, tx has to be the transaction of the write the
+// event is about.
+func Record(tx *gorm.DB, eventType models.EventType, aggregateType models.AggregateType, aggregateID string, payload map[string]interface{}) error {
+	b, err := json.Marshal(plain(payload))
+	if err != nil {
+		return err
+	}
+
+	_, err = New(tx, &models.EventOutboxModel{
+		EventType:     eventType,
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+		Payload:       string(b),
+		Status:        models.EventOutboxStatus_Pending,
+		NextAttemptAt: time.Now(),
+	})
+	return err
+}
+
+// GetsDue locks the pending rows due at now, oldest first. A row waits while
+// an older one of the same aggregate is pending, so that the events of an
+// aggregate go out in order. Rows locked by another relay are skipped.
+func GetsDue(tx *gorm.DB, now time.Time, limit int) ([]models.EventOutboxModel, error) {
+	result := make([]models.EventOutboxModel, 0)
+	err := tx.Table(table).
+		Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where(table+".status = ?", models.EventOutboxStatus_Pending).
+		Where(table+".next_attempt_at <= ?", now).
+		Where("NOT EXISTS (SELECT 1 FROM "+table+" AS older"+
+			" WHERE older.aggregate_type = "+table+".aggregate_type"+
+			" AND older.aggregate_id = "+table+".aggregate_id"+
+			" AND older.status = ?"+
+			" AND older.id < "+table+".id)", models.EventOutboxStatus_Pending).
+		Order(table + ".id").
+		Limit(limit).
+		Find(&result).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return []models.EventOutboxModel{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Claim leases the rows to a relay until the time, another relay only takes
+// them again once it is over. It counts the attempt, the relay then updates
+// the rows with ModifyClaimed at that count.
+func Claim(tx *gorm.DB, ids []uint64, until time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return tx.Table(table).
+		Where(table+".id IN ?", ids).
+		Updates(map[string]interface{}{
+			"attempts":        gorm.Expr("attempts + 1"),
+			"next_attempt_at": until,
+		}).Error
+}
+
+// ModifyClaimed is Modify for a row claimed with model.Attempts, it returns
+// false and updates nothing when the lease ran out and another relay claimed
+// the row since.
+func ModifyClaimed(tx *gorm.DB, model *models.EventOutboxModel, updates map[string]interface{}) (bool, error) {
+	if model.ID == 0 {
+		return false, errors.New("modify without id")
+	}
+
+	result := tx.Table(table).
+		Where(table+".id = ?", model.ID).
+		Where(table+".status = ?", models.EventOutboxStatus_Pending).
+		Where(table+".attempts = ?", model.Attempts).
+		Updates(updates)
+	return result.RowsAffected > 0, result.Error
+}
+
+// Modify update columns of a row
+func Modify(tx *gorm.DB, model *models.EventOutboxModel, updates map[string]interface{}) error {
+	if model.ID == 0 {
+		return errors.New("modify without id")
+	}
+
+	return tx.Table(table).
+		Where(table+".id = ?", model.ID).
+		Updates(updates).Error
+}
+
+// DeletePublished deletes up to limit rows published before the time, it
+// returns the number of rows deleted
+func DeletePublished(tx *gorm.DB, before time.Time, limit int) (int64, error) {
+	ids := []uint64{}
+	err := tx.Table(table).
+		Where(table+".status = ?", models.EventOutboxStatus_Published).
+		Where(table+".published_at < ?", before).
+		Order(table+".id").
+		Limit(limit).
+		Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	result := tx.Table(table).
+		Where(table+".id IN ?", ids).
+		Delete(&models.EventOutboxModel{})
+	return result.RowsAffected, result.Error
+}
+
+// plain replaces the sql.Null* values of the updates of a write by what they
+// hold, or nil.
+func plain(payload map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(payload))
+	for k, v := range payload {
+		switch value := v.(type) {
+		case map[string]interface{}:
+			result[k] = plain(value)
+		case driver.Valuer:
+			plainValue, err := value.Value()
+			if err != nil {
+				plainValue = nil
+			}
+			result[k] = plainValue
+		default:
+			result[k] = v
+		}
+	}
+	return result
+}
@@ -4,6 +4,8 @@ import (
 	"errors"
 
 	"github.com/paper-trade-chatbot/be-common/pagination"
+	"github.com/paper-trade-chatbot/be-product/dao/catalogRevisionDao"
+	"github.com/paper-trade-chatbot/be-product/dao/eventOutboxDao"
 	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
 	"github.com/paper-trade-chatbot/be-proto/general"
 
@@ -15,15 +17,34 @@ const table = "exchange"
 // QueryModel set query condition, used by queryChain()
 type QueryModel struct {
 	Code    string
+	Codes   []string
 	Status  int
 	Display int
 }
 
-// New a row
+// IsByCode reports whether the query matches one exchange by its code and
+// nothing else, the lookup a cache keyed by code can serve.
+func (q *QueryModel) IsByCode() bool {
+	return q.Code != "" && len(q.Codes) == 0 && q.Status == 0 && q.Display == 0
+}
+
+// New a row at the next catalog revision, with its created event in the same
+// transaction
 func New(tx *gorm.DB, model *models.ExchangeModel) (string, error) {
 
-	err := tx.Table(table).
-		Create(model).Error
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		revision, err := catalogRevisionDao.Next(tx)
+		if err != nil {
+			return err
+		}
+		model.Revision = revision
+		if err := tx.Table(table).Create(model).Error; err != nil {
+			return err
+		}
+		return eventOutboxDao.Record(tx, models.EventType_ExchangeCreated, models.AggregateType_Exchange, model.Code, map[string]interface{}{
+			"productType": model.ProductType,
+		})
+	})
 
 	if err != nil {
 		return "", err
@@ -37,7 +58,7 @@ func Get(tx *gorm.DB, query *QueryModel) (*models.ExchangeModel, error) {
 	result := &models.ExchangeModel{}
 	err := tx.Table(table).
 		Scopes(queryChain(query)).
-		Scan(result).Error
+		Take(result).Error
 
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, nil
@@ -66,13 +87,65 @@ func Gets(tx *gorm.DB, query *QueryModel) ([]models.ExchangeModel, error) {
 	return result, nil
 }
 
+// Modify updates a row by its code at the next catalog revision, with its
+// modified event in the same transaction. A change of the status or display is
+// a status changed event. The products of the exchange take the revision too,
+// so that they are synced again, their updated_at is left as it is.
+func Modify(tx *gorm.DB, model *models.ExchangeModel, updates map[string]interface{}) error {
+	if model.Code == "" {
+		return errors.New("modify without code")
+	}
+
+	return tx.Transaction(func(tx *gorm.DB) error {
+		revision, err := catalogRevisionDao.Next(tx)
+		if err != nil {
+			return err
+		}
+		columns := make(map[string]interface{}, len(updates)+1)
+		for k, v := range updates {
+			columns[k] = v
+		}
+		columns["revision"] = revision
+
+		err = tx.Table(table).
+			Where(table+".code = ?", model.Code).
+			Updates(columns).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Table("product").
+			Where("product.exchange_code = ?", model.Code).
+			Updates(map[string]interface{}{
+				"revision":   revision,
+				"updated_at": gorm.Expr("updated_at"),
+			}).Error
+		if err != nil {
+			return err
+		}
+		eventType := models.EventType_ExchangeModified
+		_, status := updates["status"]
+		_, display := updates["display"]
+		if status || display {
+			eventType = models.EventType_ExchangeStatusChanged
+		}
+		return eventOutboxDao.Record(tx, eventType, models.AggregateType_Exchange, model.Code, map[string]interface{}{
+			"changes": updates,
+		})
+	})
+}
+
 func GetsWithPagination(tx *gorm.DB, query *QueryModel, paginate *general.Pagination) ([]models.ExchangeModel, *general.PaginationInfo, error) {
 
+	if paginate == nil || paginate.Page < 1 || paginate.PageSize < 1 {
+		return nil, nil, errors.New("invalid pagination")
+	}
+
 	var rows []models.ExchangeModel
 	var count int64 = 0
 	err := tx.Table(table).
 		Scopes(queryChain(query)).
 		Count(&count).
+		Order(table + ".code").
 		Scopes(paginateChain(paginate)).
 		Scan(&rows).Error
 
@@ -90,10 +163,42 @@ func GetsWithPagination(tx *gorm.DB, query *QueryModel, paginate *general.Pagina
 	return rows, paginationInfo, nil
 }
 
+// GetsByKeyset returns up to limit rows ordered by code, after afterCode
+// unless it is empty.
+func GetsByKeyset(tx *gorm.DB, query *QueryModel, afterCode string, limit int) ([]models.ExchangeModel, error) {
+	result := make([]models.ExchangeModel, 0)
+	err := tx.Table(table).
+		Scopes(queryChain(query)).
+		Scopes(codeAfterScope(afterCode)).
+		Order(table + ".code").
+		Scopes(limitScope(limit)).
+		Scan(&result).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return []models.ExchangeModel{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Count return the number of rows matching the query
+func Count(tx *gorm.DB, query *QueryModel) (int64, error) {
+	var count int64
+	err := tx.Table(table).
+		Scopes(queryChain(query)).
+		Count(&count).Error
+	return count, err
+}
+
 func queryChain(query *QueryModel) func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
 		return db.
 			Scopes(codeEqualScope(query.Code)).
+			Scopes(codeInScope(query.Codes)).
 			Scopes(statusEqualScope(query.Status)).
 			Scopes(displayEqualScope(query.Display))
 
@@ -119,6 +224,24 @@ func codeEqualScope(code string) func(db *gorm.DB) *gorm.DB {
 	}
 }
 
+func codeInScope(codes []string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if len(codes) > 0 {
+			return db.Where(table+".code IN ?", codes)
+		}
+		return db
+	}
+}
+
+func codeAfterScope(code string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if code != "" {
+			return db.Where(table+".code > ?", code)
+		}
+		return db
+	}
+}
+
 func statusEqualScope(status int) func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
 		if status != 0 {
@@ -150,7 +273,7 @@ func limitScope(limit int) func(db *gorm.DB) *gorm.DB {
 func offsetScope(offset int) func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
 		if offset > 0 {
-			return db.Limit(offset)
+			return db.Offset(offset)
 		}
 		return db
 	}
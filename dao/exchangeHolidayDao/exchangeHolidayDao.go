@@ -0,0 +1,134 @@
+package exchangeHolidayDao
+
+import (
+	"errors"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-product/dao/eventOutboxDao"
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const dateLayout = "2006-01-02"
+
+const table = "exchange_holiday"
+
+// QueryModel set query condition, used by queryChain()
+type QueryModel struct {
+	ExchangeID  uint64
+	ExchangeIDs []uint64
+	// EndsFrom keeps the holidays that are not over before this date
+	EndsFrom time.Time
+}
+
+// Upsert adds the holiday of the exchange on its date or replaces it, with
+// its updated event in the same transaction
+func Upsert(tx *gorm.DB, model *models.ExchangeHolidayModel, exchangeCode string) error {
+	if model.ExchangeID == 0 {
+		return errors.New("upsert without exchange id")
+	}
+
+	return tx.Transaction(func(tx *gorm.DB) error {
+		err := tx.Table(table).
+			Clauses(clause.OnConflict{
+				DoUpdates: clause.AssignmentColumns([]string{"name", "end_date", "type", "half_day_close_time", "memo"}),
+			}).
+			Create(model).Error
+		if err != nil {
+			return err
+		}
+
+		payload := map[string]interface{}{
+			"date": model.Date.Format(dateLayout),
+			"name": model.Name,
+			"type": model.Type,
+		}
+		if model.EndDate.Valid {
+			payload["endDate"] = model.EndDate.Time.Format(dateLayout)
+		}
+		if model.HalfDayCloseTime.Valid {
+			payload["halfDayCloseTime"] = model.HalfDayCloseTime.Time.Format("15:04:05")
+		}
+		return eventOutboxDao.Record(tx, models.EventType_HolidayUpdated, models.AggregateType_Exchange, exchangeCode, payload)
+	})
+}
+
+// Delete removes the holiday of the exchange on the date, with its deleted
+// event in the same transaction. It reports false when there was none.
+func Delete(tx *gorm.DB, exchangeID uint64, date time.Time, exchangeCode string) (bool, error) {
+	deleted := false
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		result := tx.Table(table).
+			Where(table+".exchange_id = ?", exchangeID).
+			Where(table+".date = ?", date.Format(dateLayout)).
+			Delete(&models.ExchangeHolidayModel{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		deleted = true
+
+		return eventOutboxDao.Record(tx, models.EventType_HolidayDeleted, models.AggregateType_Exchange, exchangeCode, map[string]interface{}{
+			"date": date.Format(dateLayout),
+		})
+	})
+	return deleted, err
+}
+
+// Gets return records as raw-data-form, ordered by date
+func Gets(tx *gorm.DB, query *QueryModel) ([]models.ExchangeHolidayModel, error) {
+	result := make([]models.ExchangeHolidayModel, 0)
+	err := tx.Table(table).
+		Scopes(queryChain(query)).
+		Order(table + ".date").
+		Scan(&result).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return []models.ExchangeHolidayModel{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func queryChain(query *QueryModel) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.
+			Scopes(exchangeIDEqualScope(query.ExchangeID)).
+			Scopes(exchangeIDInScope(query.ExchangeIDs)).
+			Scopes(endsFromScope(query.EndsFrom))
+
+	}
+}
+
+func exchangeIDEqualScope(exchangeID uint64) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if exchangeID != 0 {
+			return db.Where(table+".exchange_id = ?", exchangeID)
+		}
+		return db
+	}
+}
+
+func exchangeIDInScope(exchangeIDs []uint64) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if len(exchangeIDs) > 0 {
+			return db.Where(table+".exchange_id IN ?", exchangeIDs)
+		}
+		return db
+	}
+}
+
+func endsFromScope(endsFrom time.Time) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if !endsFrom.IsZero() {
+			date := endsFrom.Format(dateLayout)
+			return db.Where("COALESCE("+table+".end_date, "+table+".date) >= ?", date)
+		}
+		return db
+	}
+}
@@ -0,0 +1,130 @@
+package optionContractDao
+
+import (
+	"errors"
+	"time"
+
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+
+	"gorm.io/gorm"
+)
+
+const table = "option_contract"
+
+// QueryModel set query condition, used by queryChain()
+type QueryModel struct {
+	ProductID    uint64
+	ProductIDs   []uint64
+	UnderlyingID uint64
+	ExpiryDates  []time.Time
+	OptionRight  models.OptionRight
+}
+
+// New a row
+func New(tx *gorm.DB, model *models.OptionContractModel) (uint64, error) {
+
+	err := tx.Table(table).
+		Create(model).Error
+
+	if err != nil {
+		return 0, err
+	}
+	return model.ProductID, nil
+}
+
+// Get return a record as raw-data-form
+func Get(tx *gorm.DB, query *QueryModel) (*models.OptionContractModel, error) {
+
+	result := &models.OptionContractModel{}
+	err := tx.Table(table).
+		Scopes(queryChain(query)).
+		Take(result).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Gets return records as raw-data-form
+func Gets(tx *gorm.DB, query *QueryModel) ([]models.OptionContractModel, error) {
+	result := make([]models.OptionContractModel, 0)
+	err := tx.Table(table).
+		Scopes(queryChain(query)).
+		Order(table + ".expiry_date, " + table + ".strike_price, " + table + ".option_right").
+		Scan(&result).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return []models.OptionContractModel{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func queryChain(query *QueryModel) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.
+			Scopes(productIDEqualScope(query.ProductID)).
+			Scopes(productIDInScope(query.ProductIDs)).
+			Scopes(underlyingIDEqualScope(query.UnderlyingID)).
+			Scopes(expiryDateInScope(query.ExpiryDates)).
+			Scopes(optionRightEqualScope(query.OptionRight))
+
+	}
+}
+
+func productIDEqualScope(productID uint64) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if productID != 0 {
+			return db.Where(table+".product_id = ?", productID)
+		}
+		return db
+	}
+}
+
+func productIDInScope(productIDs []uint64) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if len(productIDs) > 0 {
+			return db.Where(table+".product_id IN ?", productIDs)
+		}
+		return db
+	}
+}
+
+func underlyingIDEqualScope(underlyingID uint64) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if underlyingID != 0 {
+			return db.Where(table+".underlying_id = ?", underlyingID)
+		}
+		return db
+	}
+}
+
+func expiryDateInScope(expiryDates []time.Time) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if len(expiryDates) > 0 {
+			dates := make([]string, 0, len(expiryDates))
+			for _, d := range expiryDates {
+				dates = append(dates, d.Format("2006-01-02"))
+			}
+			return db.Where(table+".expiry_date IN ?", dates)
+		}
+		return db
+	}
+}
+
+func optionRightEqualScope(optionRight models.OptionRight) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if optionRight != models.OptionRight_None {
+			return db.Where(table+".option_right = ?", optionRight)
+		}
+		return db
+	}
+}
@@ -0,0 +1,96 @@
+package productAliasDao
+
+import (
+	"errors"
+
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+
+	"gorm.io/gorm"
+)
+
+const table = "product_alias"
+
+// QueryModel set query condition, used by queryChain()
+type QueryModel struct {
+	ProductID  uint64
+	ProductIDs []uint64
+	Alias      string
+}
+
+// New a row
+func New(tx *gorm.DB, model *models.ProductAliasModel) (uint64, error) {
+
+	err := tx.Table(table).
+		Create(model).Error
+
+	if err != nil {
+		return 0, err
+	}
+	return model.ID, nil
+}
+
+// Gets return records as raw-data-form
+func Gets(tx *gorm.DB, query *QueryModel) ([]models.ProductAliasModel, error) {
+	result := make([]models.ProductAliasModel, 0)
+	err := tx.Table(table).
+		Scopes(queryChain(query)).
+		Scan(&result).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return []models.ProductAliasModel{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Delete delete records
+func Delete(tx *gorm.DB, query *QueryModel) error {
+	if query.ProductID == 0 && len(query.ProductIDs) == 0 {
+		return errors.New("delete without product id")
+	}
+
+	return tx.Table(table).
+		Scopes(queryChain(query)).
+		Delete(&models.ProductAliasModel{}).Error
+}
+
+func queryChain(query *QueryModel) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.
+			Scopes(productIDEqualScope(query.ProductID)).
+			Scopes(productIDInScope(query.ProductIDs)).
+			Scopes(aliasEqualScope(query.Alias))
+
+	}
+}
+
+func productIDEqualScope(productID uint64) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if productID != 0 {
+			return db.Where(table+".product_id = ?", productID)
+		}
+		return db
+	}
+}
+
+func productIDInScope(productIDs []uint64) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if len(productIDs) > 0 {
+			return db.Where(table+".product_id IN ?", productIDs)
+		}
+		return db
+	}
+}
+
+func aliasEqualScope(alias string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if alias != "" {
+			return db.Where(table+".alias = ?", alias)
+		}
+		return db
+	}
+}
@@ -2,12 +2,18 @@ package productDao
 
 import (
 	"errors"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/paper-trade-chatbot/be-common/pagination"
+	"github.com/paper-trade-chatbot/be-product/dao/catalogRevisionDao"
+	"github.com/paper-trade-chatbot/be-product/dao/eventOutboxDao"
 	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
 	"github.com/paper-trade-chatbot/be-proto/general"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 const table = "product"
@@ -15,21 +21,113 @@ const table = "product"
 // QueryModel set query condition, used by queryChain()
 type QueryModel struct {
 	ID            uint64
+	IDs           []uint64
 	ExchangeCode  string
 	Code          string
 	ProductType   []models.ProductType
 	ExchangeCodes []string
 	Status        int
 	Display       int
-	Offset        int
-	Limit         int
+	ISIN          string
+	CUSIP         string
+	SEDOL         string
+	FIGI          string
+	TaxonomyIDs   []uint64
+	Tag           string
+	ListedFrom    time.Time
+	ListedUntil   time.Time
+	DelistedFrom  time.Time
+	DelistedUntil time.Time
+	// CurrencyCodes match the currency of the product, or the default of its
+	// exchange when the product has none
+	CurrencyCodes []string
+	// CodeOrNameLike is a LIKE pattern matching the code or the name
+	CodeOrNameLike string
+	UpdatedFrom    time.Time
+	// EffectiveStatus and EffectiveDisplay also take the exchange into
+	// account, the more restrictive of the two wins
+	EffectiveStatus   int
+	EffectiveStatuses []int
+	EffectiveDisplay  int
+	// WithDeleted also matches the deleted products, which are left out
+	// otherwise
+	WithDeleted bool
+	// Sort orders the pages by the columns, then by id
+	Sort   []SortField
+	Offset int
+	Limit  int
 }
 
-// New a row
+// SortField orders by a column of product
+type SortField struct {
+	Column string
+	Desc   bool
+}
+
+// Keyset is where the previous page ended, the values of the Sort columns
+// and the id of its last row.
+type Keyset struct {
+	Values []interface{}
+	ID     uint64
+}
+
+// IsByID reports whether the query matches one product by its id and nothing
+// else, the lookup a cache keyed by id can serve.
+func (q *QueryModel) IsByID() bool {
+	return q.ID != 0 && q.ExchangeCode == "" && q.Code == "" && !q.filtered()
+}
+
+// IsByCode is IsByID for the exchange code and code.
+func (q *QueryModel) IsByCode() bool {
+	return q.ID == 0 && q.ExchangeCode != "" && q.Code != "" && !q.filtered()
+}
+
+// filtered reports whether any condition besides ID, ExchangeCode and Code is
+// set. Sort only orders the rows and is left out.
+func (q *QueryModel) filtered() bool {
+	return len(q.IDs) > 0 ||
+		len(q.ProductType) > 0 ||
+		len(q.ExchangeCodes) > 0 ||
+		q.Status != 0 ||
+		q.Display != 0 ||
+		q.ISIN != "" ||
+		q.CUSIP != "" ||
+		q.SEDOL != "" ||
+		q.FIGI != "" ||
+		len(q.TaxonomyIDs) > 0 ||
+		q.Tag != "" ||
+		!q.ListedFrom.IsZero() ||
+		!q.ListedUntil.IsZero() ||
+		!q.DelistedFrom.IsZero() ||
+		!q.DelistedUntil.IsZero() ||
+		len(q.CurrencyCodes) > 0 ||
+		q.CodeOrNameLike != "" ||
+		!q.UpdatedFrom.IsZero() ||
+		q.EffectiveStatus != 0 ||
+		len(q.EffectiveStatuses) > 0 ||
+		q.EffectiveDisplay != 0 ||
+		q.WithDeleted ||
+		q.Offset != 0 ||
+		q.Limit != 0
+}
+
+// New a row at the next catalog revision, with its created event in the same
+// transaction
 func New(tx *gorm.DB, model *models.ProductModel) (uint64, error) {
 
-	err := tx.Table(table).
-		Create(model).Error
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		revision, err := catalogRevisionDao.Next(tx)
+		if err != nil {
+			return err
+		}
+		model.Revision = revision
+		if err := tx.Table(table).Create(model).Error; err != nil {
+			return err
+		}
+		return recordEvent(tx, models.EventType_ProductCreated, model, map[string]interface{}{
+			"type": model.Type,
+		})
+	})
 
 	if err != nil {
 		return 0, err
@@ -43,7 +141,7 @@ func Get(tx *gorm.DB, query *QueryModel) (*models.ProductModel, error) {
 	result := &models.ProductModel{}
 	err := tx.Table(table).
 		Scopes(queryChain(query)).
-		Scan(result).Error
+		Take(result).Error
 
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, nil
@@ -72,13 +170,240 @@ func Gets(tx *gorm.DB, query *QueryModel) ([]models.ProductModel, error) {
 	return result, nil
 }
 
+// Modify update columns of a row at the next catalog revision, with its
+// modified event in the same transaction
+func Modify(tx *gorm.DB, model *models.ProductModel, updates map[string]interface{}) error {
+	if model.ID == 0 {
+		return errors.New("modify without id")
+	}
+
+	return tx.Transaction(func(tx *gorm.DB) error {
+		columns, err := withNextRevision(tx, updates)
+		if err != nil {
+			return err
+		}
+		err = tx.Table(table).
+			Where(table+".id = ?", model.ID).
+			Updates(columns).Error
+		if err != nil {
+			return err
+		}
+		return recordEvent(tx, models.EventType_ProductModified, model, map[string]interface{}{
+			"changes": updates,
+		})
+	})
+}
+
+// Touch gives the product the next revision after a write to one of the
+// tables hanging off it, e.g. its names, and records the changes as a
+// modification of the product.
+func Touch(tx *gorm.DB, model *models.ProductModel, changes map[string]interface{}) error {
+	if model.ID == 0 {
+		return errors.New("touch without id")
+	}
+
+	return tx.Transaction(func(tx *gorm.DB) error {
+		columns, err := withNextRevision(tx, map[string]interface{}{})
+		if err != nil {
+			return err
+		}
+		err = tx.Table(table).
+			Where(table+".id = ?", model.ID).
+			Updates(columns).Error
+		if err != nil {
+			return err
+		}
+		return recordEvent(tx, models.EventType_ProductModified, model, map[string]interface{}{
+			"changes": changes,
+		})
+	})
+}
+
+// Delist disables a product whose delisted_at has passed, it reports false
+// when the product was already disabled, e.g. by another replica. The
+// delisted event is only recorded when the product is disabled.
+func Delist(tx *gorm.DB, model *models.ProductModel, now time.Time) (bool, error) {
+	if model.ID == 0 {
+		return false, errors.New("delist without id")
+	}
+
+	delisted := false
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		columns, err := withNextRevision(tx, map[string]interface{}{
+			"status":  2,
+			"display": 2,
+		})
+		if err != nil {
+			return err
+		}
+		result := tx.Table(table).
+			Where(table+".id = ?", model.ID).
+			Where(table+".delisted_at <= ?", now).
+			Where("("+table+".status <> ? OR "+table+".display <> ?)", 2, 2).
+			Updates(columns)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		delisted = true
+
+		payload := map[string]interface{}{}
+		if model.DelistedAt.Valid {
+			payload["delistedAt"] = model.DelistedAt.Time.Unix()
+		}
+		return recordEvent(tx, models.EventType_ProductDelisted, model, payload)
+	})
+	if err != nil {
+		return false, err
+	}
+	return delisted, nil
+}
+
+// ModifyByQuery update columns of every row matching the query at the next
+// catalog revision, it returns the number of rows changed. A modified event is
+// recorded for every row matching, in the same transaction.
+func ModifyByQuery(tx *gorm.DB, query *QueryModel, updates map[string]interface{}) (int64, error) {
+	if query.ExchangeCode == "" && len(query.ExchangeCodes) == 0 && len(query.ProductType) == 0 && query.ID == 0 && len(query.IDs) == 0 {
+		return 0, errors.New("modify without condition")
+	}
+
+	var affected int64
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		// the rows are locked so that the events match the rows updated
+		matching := make([]models.ProductModel, 0)
+		err := tx.Table(table).
+			Scopes(queryChain(query)).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Find(&matching).Error
+		if err != nil {
+			return err
+		}
+
+		columns, err := withNextRevision(tx, updates)
+		if err != nil {
+			return err
+		}
+		result := tx.Table(table).
+			Scopes(queryChain(query)).
+			Updates(columns)
+		if result.Error != nil {
+			return result.Error
+		}
+		affected = result.RowsAffected
+
+		for i := range matching {
+			err := recordEvent(tx, models.EventType_ProductModified, &matching[i], map[string]interface{}{
+				"changes": updates,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return affected, err
+}
+
+// Delete disables a product and keeps it as a tombstone, so that the clients
+// syncing the catalog learn it is gone. It reports false when the product was
+// already deleted. The deleted event is only recorded when it is deleted.
+func Delete(tx *gorm.DB, model *models.ProductModel, now time.Time) (bool, error) {
+	if model.ID == 0 {
+		return false, errors.New("delete without id")
+	}
+
+	deleted := false
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		columns, err := withNextRevision(tx, map[string]interface{}{
+			"status":     2,
+			"display":    2,
+			"deleted_at": now,
+		})
+		if err != nil {
+			return err
+		}
+		result := tx.Table(table).
+			Where(table+".id = ?", model.ID).
+			Where(table + ".deleted_at IS NULL").
+			Updates(columns)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		deleted = true
+
+		return recordEvent(tx, models.EventType_ProductDeleted, model, map[string]interface{}{
+			"deletedAt": now.Unix(),
+		})
+	})
+	if err != nil {
+		return false, err
+	}
+	return deleted, nil
+}
+
+// GetsChanged returns the products changed after the revision, a write of
+// their exchange changes them too. They are ordered by revision and id on
+// idx_product_revision. afterID continues from the product of that id at the
+// revision, and untilRevision bounds the revision.
+func GetsChanged(tx *gorm.DB, sinceRevision, afterID, untilRevision uint64, withDeleted bool, limit int) ([]models.ProductRevisionModel, error) {
+	result := make([]models.ProductRevisionModel, 0)
+	err := tx.Table(table).
+		Select(table+".id, "+table+".revision, "+table+".deleted_at").
+		Where("("+table+".revision > ? OR ("+table+".revision = ? AND "+table+".id > ?))", sinceRevision, sinceRevision, afterID).
+		Where(table+".revision <= ?", untilRevision).
+		Scopes(deletedScope(withDeleted)).
+		Order(table + ".revision, " + table + ".id").
+		Scopes(limitScope(limit)).
+		Scan(&result).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return []models.ProductRevisionModel{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// withNextRevision returns the updates with the next catalog revision, the
+// updates themselves are left as they are for the event.
+func withNextRevision(tx *gorm.DB, updates map[string]interface{}) (map[string]interface{}, error) {
+	revision, err := catalogRevisionDao.Next(tx)
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]interface{}, len(updates)+1)
+	for k, v := range updates {
+		columns[k] = v
+	}
+	columns["revision"] = revision
+	return columns, nil
+}
+
+// recordEvent adds an event about the product to the outbox of tx
+func recordEvent(tx *gorm.DB, eventType models.EventType, model *models.ProductModel, payload map[string]interface{}) error {
+	if model.ExchangeCode != "" {
+		payload["exchangeCode"] = model.ExchangeCode
+	}
+	if model.Code != "" {
+		payload["code"] = model.Code
+	}
+	return eventOutboxDao.Record(tx, eventType, models.AggregateType_Product, strconv.FormatUint(model.ID, 10), payload)
+}
+
 func GetsWithPagination(tx *gorm.DB, query *QueryModel, paginate *general.Pagination) ([]models.ProductModel, *general.PaginationInfo, error) {
 
+	if paginate == nil || paginate.Page < 1 || paginate.PageSize < 1 {
+		return nil, nil, errors.New("invalid pagination")
+	}
+
 	var rows []models.ProductModel
 	var count int64 = 0
 	err := tx.Table(table).
 		Scopes(queryChain(query)).
 		Count(&count).
+		Scopes(sortScope(query.Sort)).
 		Scopes(paginateChain(paginate)).
 		Scan(&rows).Error
 
@@ -96,16 +421,67 @@ func GetsWithPagination(tx *gorm.DB, query *QueryModel, paginate *general.Pagina
 	return rows, paginationInfo, nil
 }
 
+// GetsByKeyset returns up to limit rows after the keyset in the Sort order,
+// the first page without one.
+func GetsByKeyset(tx *gorm.DB, query *QueryModel, after *Keyset, limit int) ([]models.ProductModel, error) {
+	result := make([]models.ProductModel, 0)
+	err := tx.Table(table).
+		Scopes(queryChain(query)).
+		Scopes(keysetScope(query.Sort, after)).
+		Scopes(sortScope(query.Sort)).
+		Scopes(limitScope(limit)).
+		Scan(&result).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return []models.ProductModel{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Count return the number of rows matching the query, regardless of its
+// offset and limit
+func Count(tx *gorm.DB, query *QueryModel) (int64, error) {
+	q := *query
+	q.Offset, q.Limit = 0, 0
+
+	var count int64
+	err := tx.Table(table).
+		Scopes(queryChain(&q)).
+		Count(&count).Error
+	return count, err
+}
+
 func queryChain(query *QueryModel) func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
 		return db.
 			Scopes(idEqualScope(query.ID)).
+			Scopes(idInScope(query.IDs)).
 			Scopes(codeEqualScope(query.Code)).
 			Scopes(exchangeCodeEqualScope(query.ExchangeCode)).
 			Scopes(productTypeInScope(query.ProductType)).
 			Scopes(exchangeCodesInScope(query.ExchangeCodes)).
 			Scopes(statusEqualScope(query.Status)).
 			Scopes(displayEqualScope(query.Display)).
+			Scopes(currencyCodeInScope(query.CurrencyCodes)).
+			Scopes(codeOrNameLikeScope(query.CodeOrNameLike)).
+			Scopes(timeRangeScope("updated_at", query.UpdatedFrom, time.Time{})).
+			Scopes(isinEqualScope(query.ISIN)).
+			Scopes(cusipEqualScope(query.CUSIP)).
+			Scopes(sedolEqualScope(query.SEDOL)).
+			Scopes(figiEqualScope(query.FIGI)).
+			Scopes(taxonomyIDInScope(query.TaxonomyIDs)).
+			Scopes(tagEqualScope(query.Tag)).
+			Scopes(timeRangeScope("listed_at", query.ListedFrom, query.ListedUntil)).
+			Scopes(timeRangeScope("delisted_at", query.DelistedFrom, query.DelistedUntil)).
+			Scopes(effectiveEqualScope("status", query.EffectiveStatus)).
+			Scopes(effectiveInScope("status", query.EffectiveStatuses)).
+			Scopes(effectiveEqualScope("display", query.EffectiveDisplay)).
+			Scopes(deletedScope(query.WithDeleted)).
 			Scopes(offsetScope(query.Offset)).
 			Scopes(limitScope(query.Limit))
 
@@ -131,6 +507,15 @@ func idEqualScope(id uint64) func(db *gorm.DB) *gorm.DB {
 	}
 }
 
+func idInScope(ids []uint64) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if len(ids) > 0 {
+			return db.Where(table+".id IN ?", ids)
+		}
+		return db
+	}
+}
+
 func codeEqualScope(code string) func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
 		if code != "" {
@@ -152,7 +537,7 @@ func exchangeCodeEqualScope(exchangeCode string) func(db *gorm.DB) *gorm.DB {
 func productTypeInScope(productType []models.ProductType) func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
 		if len(productType) > 0 {
-			return db.Where(table+".type = ?", productType)
+			return db.Where(table+".type IN ?", productType)
 		}
 		return db
 	}
@@ -161,7 +546,7 @@ func productTypeInScope(productType []models.ProductType) func(db *gorm.DB) *gor
 func exchangeCodesInScope(exchanges []string) func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
 		if len(exchanges) > 0 {
-			return db.Where(table+".exchange_code = ?", exchanges)
+			return db.Where(table+".exchange_code IN ?", exchanges)
 		}
 		return db
 	}
@@ -185,6 +570,165 @@ func displayEqualScope(display int) func(db *gorm.DB) *gorm.DB {
 	}
 }
 
+func currencyCodeInScope(currencyCodes []string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if len(currencyCodes) > 0 {
+			return db.Where("COALESCE("+table+".currency_code, (SELECT exchange.currency_code FROM exchange WHERE exchange.code = "+table+".exchange_code)) IN ?", currencyCodes)
+		}
+		return db
+	}
+}
+
+func codeOrNameLikeScope(pattern string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if pattern != "" {
+			return db.Where("("+table+".code LIKE ? OR "+table+".name LIKE ?)", pattern, pattern)
+		}
+		return db
+	}
+}
+
+func isinEqualScope(isin string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if isin != "" {
+			return db.Where(table+".isin = ?", isin)
+		}
+		return db
+	}
+}
+
+func cusipEqualScope(cusip string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if cusip != "" {
+			return db.Where(table+".cusip = ?", cusip)
+		}
+		return db
+	}
+}
+
+func sedolEqualScope(sedol string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if sedol != "" {
+			return db.Where(table+".sedol = ?", sedol)
+		}
+		return db
+	}
+}
+
+func figiEqualScope(figi string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if figi != "" {
+			return db.Where(table+".figi = ?", figi)
+		}
+		return db
+	}
+}
+
+func taxonomyIDInScope(taxonomyIDs []uint64) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if len(taxonomyIDs) > 0 {
+			return db.Where(table+".taxonomy_id IN ?", taxonomyIDs)
+		}
+		return db
+	}
+}
+
+func tagEqualScope(tag string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if tag != "" {
+			return db.Where(table+".id IN (SELECT product_tag.product_id FROM product_tag WHERE product_tag.tag = ?)", tag)
+		}
+		return db
+	}
+}
+
+// timeRangeScope matches from <= column <= until, a zero bound is open
+func timeRangeScope(column string, from, until time.Time) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if !from.IsZero() {
+			db = db.Where(table+"."+column+" >= ?", from)
+		}
+		if !until.IsZero() {
+			db = db.Where(table+"."+column+" <= ?", until)
+		}
+		return db
+	}
+}
+
+// effectiveEqualScope compares with the more restrictive value of the product
+// and its exchange, 2 (disabled) being more restrictive than 1 (enabled)
+func effectiveEqualScope(column string, value int) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if value != 0 {
+			return db.Where("GREATEST("+table+"."+column+", COALESCE((SELECT exchange."+column+" FROM exchange WHERE exchange.code = "+table+".exchange_code), 1)) = ?", value)
+		}
+		return db
+	}
+}
+
+// effectiveInScope is effectiveEqualScope for several values
+func effectiveInScope(column string, values []int) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if len(values) > 0 {
+			return db.Where("GREATEST("+table+"."+column+", COALESCE((SELECT exchange."+column+" FROM exchange WHERE exchange.code = "+table+".exchange_code), 1)) IN ?", values)
+		}
+		return db
+	}
+}
+
+func deletedScope(withDeleted bool) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if !withDeleted {
+			return db.Where(table + ".deleted_at IS NULL")
+		}
+		return db
+	}
+}
+
+// sortScope orders by the fields then by id, so that the order is stable
+func sortScope(sort []SortField) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		for _, f := range sort {
+			db = db.Order(clause.OrderByColumn{Column: clause.Column{Table: table, Name: f.Column}, Desc: f.Desc})
+		}
+		return db.Order(table + ".id")
+	}
+}
+
+// keysetScope matches the rows after the keyset in the order of sortScope
+func keysetScope(sort []SortField, after *Keyset) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if after == nil {
+			return db
+		}
+		if len(after.Values) != len(sort) {
+			db.AddError(errors.New("keyset does not match the sort"))
+			return db
+		}
+
+		// (a > ?) OR (a = ? AND b > ?) OR ... OR (a = ? AND b = ? AND id > ?)
+		conditions := []string{}
+		args := []interface{}{}
+		equal := ""
+		equalArgs := []interface{}{}
+		for i, f := range sort {
+			column := table + "." + f.Column
+			op := " > ?"
+			if f.Desc {
+				op = " < ?"
+			}
+			conditions = append(conditions, "("+equal+column+op+")")
+			args = append(append(args, equalArgs...), after.Values[i])
+			equal += column + " = ? AND "
+			equalArgs = append(equalArgs, after.Values[i])
+		}
+		conditions = append(conditions, "("+equal+table+".id > ?)")
+		args = append(append(args, equalArgs...), after.ID)
+
+		return db.Where("("+strings.Join(conditions, " OR ")+")", args...)
+	}
+}
+
 func limitScope(limit int) func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
 		if limit > 0 {
@@ -197,7 +741,7 @@ func limitScope(limit int) func(db *gorm.DB) *gorm.DB {
 func offsetScope(offset int) func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
 		if offset > 0 {
-			return db.Limit(offset)
+			return db.Offset(offset)
 		}
 		return db
 	}
@@ -0,0 +1,95 @@
+package productNameDao
+
+import (
+	"errors"
+
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const table = "product_name"
+
+// QueryModel set query condition, used by queryChain()
+type QueryModel struct {
+	ProductID  uint64
+	ProductIDs []uint64
+	Locales    []string
+}
+
+// Upsert insert a row, or replace the names of the existing (product_id, locale) row
+func Upsert(tx *gorm.DB, model *models.ProductNameModel) error {
+
+	return tx.Table(table).
+		Clauses(clause.OnConflict{
+			DoUpdates: clause.AssignmentColumns([]string{"short_name", "long_name"}),
+		}).
+		Create(model).Error
+}
+
+// Gets return records as raw-data-form
+func Gets(tx *gorm.DB, query *QueryModel) ([]models.ProductNameModel, error) {
+	result := make([]models.ProductNameModel, 0)
+	err := tx.Table(table).
+		Scopes(queryChain(query)).
+		Scan(&result).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return []models.ProductNameModel{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Delete delete records
+func Delete(tx *gorm.DB, query *QueryModel) error {
+	if query.ProductID == 0 && len(query.ProductIDs) == 0 {
+		return errors.New("delete without product id")
+	}
+
+	return tx.Table(table).
+		Scopes(queryChain(query)).
+		Delete(&models.ProductNameModel{}).Error
+}
+
+func queryChain(query *QueryModel) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.
+			Scopes(productIDEqualScope(query.ProductID)).
+			Scopes(productIDInScope(query.ProductIDs)).
+			Scopes(localeInScope(query.Locales))
+
+	}
+}
+
+func productIDEqualScope(productID uint64) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if productID != 0 {
+			return db.Where(table+".product_id = ?", productID)
+		}
+		return db
+	}
+}
+
+func productIDInScope(productIDs []uint64) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if len(productIDs) > 0 {
+			return db.Where(table+".product_id IN ?", productIDs)
+		}
+		return db
+	}
+}
+
+func localeInScope(locales []string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if len(locales) > 0 {
+			return db.Where(table+".locale IN ?", locales)
+		}
+		return db
+	}
+}
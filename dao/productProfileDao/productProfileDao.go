@@ -0,0 +1,84 @@
+package productProfileDao
+
+import (
+	"errors"
+
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+
+	"gorm.io/gorm"
+)
+
+const table = "product_profile"
+
+// QueryModel set query condition, used by queryChain()
+type QueryModel struct {
+	ProductID  uint64
+	ProductIDs []uint64
+}
+
+// New a row
+func New(tx *gorm.DB, model *models.ProductProfileModel) (uint64, error) {
+
+	err := tx.Table(table).
+		Create(model).Error
+
+	if err != nil {
+		return 0, err
+	}
+	return model.ProductID, nil
+}
+
+// Get return a record as raw-data-form
+func Get(tx *gorm.DB, query *QueryModel) (*models.ProductProfileModel, error) {
+
+	result := &models.ProductProfileModel{}
+	err := tx.Table(table).
+		Scopes(queryChain(query)).
+		Take(result).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Modify update columns of a row
+func Modify(tx *gorm.DB, model *models.ProductProfileModel, updates map[string]interface{}) error {
+	if model.ProductID == 0 {
+		return errors.New("modify without product id")
+	}
+
+	return tx.Table(table).
+		Where(table+".product_id = ?", model.ProductID).
+		Updates(updates).Error
+}
+
+func queryChain(query *QueryModel) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.
+			Scopes(productIDEqualScope(query.ProductID)).
+			Scopes(productIDInScope(query.ProductIDs))
+
+	}
+}
+
+func productIDEqualScope(productID uint64) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if productID != 0 {
+			return db.Where(table+".product_id = ?", productID)
+		}
+		return db
+	}
+}
+
+func productIDInScope(productIDs []uint64) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if len(productIDs) > 0 {
+			return db.Where(table+".product_id IN ?", productIDs)
+		}
+		return db
+	}
+}
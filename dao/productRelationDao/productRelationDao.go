@@ -0,0 +1,156 @@
+package productRelationDao
+
+import (
+	"errors"
+	"time"
+
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+
+	"gorm.io/gorm"
+)
+
+const table = "product_relation"
+
+// QueryModel set query condition, used by queryChain()
+type QueryModel struct {
+	ProductID         uint64
+	RelatedProductID  uint64
+	RelatedProductIDs []uint64
+	RelationTypes     []models.RelationType
+	EffectiveDate     time.Time
+	EffectiveUntil    time.Time
+}
+
+// New a row
+func New(tx *gorm.DB, model *models.ProductRelationModel) (uint64, error) {
+
+	err := tx.Table(table).
+		Create(model).Error
+
+	if err != nil {
+		return 0, err
+	}
+	return model.ID, nil
+}
+
+// Gets return records as raw-data-form
+func Gets(tx *gorm.DB, query *QueryModel) ([]models.ProductRelationModel, error) {
+	result := make([]models.ProductRelationModel, 0)
+	err := tx.Table(table).
+		Scopes(queryChain(query)).
+		Order(table + ".effective_date DESC, " + table + ".weight DESC, " + table + ".id").
+		Scan(&result).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return []models.ProductRelationModel{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// LatestEffectiveDates return the latest effective_date of every related
+// product matching the query, keyed by related_product_id
+func LatestEffectiveDates(tx *gorm.DB, query *QueryModel) (map[uint64]time.Time, error) {
+	rows := []struct {
+		RelatedProductID uint64    `gorm:"column:related_product_id"`
+		EffectiveDate    time.Time `gorm:"column:effective_date"`
+	}{}
+	err := tx.Table(table).
+		Select(table + ".related_product_id, MAX(" + table + ".effective_date) AS effective_date").
+		Scopes(queryChain(query)).
+		Group(table + ".related_product_id").
+		Scan(&rows).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[uint64]time.Time, len(rows))
+	for _, r := range rows {
+		result[r.RelatedProductID] = r.EffectiveDate
+	}
+	return result, nil
+}
+
+// Delete delete records, it returns the number of rows deleted
+func Delete(tx *gorm.DB, query *QueryModel) (int64, error) {
+	if query.ProductID == 0 && query.RelatedProductID == 0 {
+		return 0, errors.New("delete without product id")
+	}
+
+	result := tx.Table(table).
+		Scopes(queryChain(query)).
+		Delete(&models.ProductRelationModel{})
+	return result.RowsAffected, result.Error
+}
+
+func queryChain(query *QueryModel) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.
+			Scopes(productIDEqualScope(query.ProductID)).
+			Scopes(relatedProductIDEqualScope(query.RelatedProductID)).
+			Scopes(relatedProductIDInScope(query.RelatedProductIDs)).
+			Scopes(relationTypeInScope(query.RelationTypes)).
+			Scopes(effectiveDateEqualScope(query.EffectiveDate)).
+			Scopes(effectiveDateUntilScope(query.EffectiveUntil))
+
+	}
+}
+
+func productIDEqualScope(productID uint64) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if productID != 0 {
+			return db.Where(table+".product_id = ?", productID)
+		}
+		return db
+	}
+}
+
+func relatedProductIDEqualScope(relatedProductID uint64) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if relatedProductID != 0 {
+			return db.Where(table+".related_product_id = ?", relatedProductID)
+		}
+		return db
+	}
+}
+
+func relatedProductIDInScope(relatedProductIDs []uint64) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if len(relatedProductIDs) > 0 {
+			return db.Where(table+".related_product_id IN ?", relatedProductIDs)
+		}
+		return db
+	}
+}
+
+func relationTypeInScope(relationTypes []models.RelationType) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if len(relationTypes) > 0 {
+			return db.Where(table+".relation_type IN ?", relationTypes)
+		}
+		return db
+	}
+}
+
+func effectiveDateEqualScope(effectiveDate time.Time) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if !effectiveDate.IsZero() {
+			return db.Where(table+".effective_date = ?", effectiveDate.Format("2006-01-02"))
+		}
+		return db
+	}
+}
+
+func effectiveDateUntilScope(until time.Time) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if !until.IsZero() {
+			return db.Where(table+".effective_date <= ?", until.Format("2006-01-02"))
+		}
+		return db
+	}
+}
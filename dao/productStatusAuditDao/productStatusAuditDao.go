@@ -0,0 +1,75 @@
+package productStatusAuditDao
+
+import (
+	"errors"
+
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+
+	"gorm.io/gorm"
+)
+
+const table = "product_status_audit"
+
+// QueryModel set query condition, used by queryChain()
+type QueryModel struct {
+	ExchangeCode string
+	Limit        int
+}
+
+// New a row
+func New(tx *gorm.DB, model *models.ProductStatusAuditModel) (uint64, error) {
+
+	err := tx.Table(table).
+		Create(model).Error
+
+	if err != nil {
+		return 0, err
+	}
+	return model.ID, nil
+}
+
+// Gets return records as raw-data-form, newest first
+func Gets(tx *gorm.DB, query *QueryModel) ([]models.ProductStatusAuditModel, error) {
+	result := make([]models.ProductStatusAuditModel, 0)
+	err := tx.Table(table).
+		Scopes(queryChain(query)).
+		Order(table + ".id DESC").
+		Scan(&result).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return []models.ProductStatusAuditModel{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func queryChain(query *QueryModel) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.
+			Scopes(exchangeCodeEqualScope(query.ExchangeCode)).
+			Scopes(limitScope(query.Limit))
+
+	}
+}
+
+func exchangeCodeEqualScope(exchangeCode string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if exchangeCode != "" {
+			return db.Where(table+".exchange_code = ?", exchangeCode)
+		}
+		return db
+	}
+}
+
+func limitScope(limit int) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if limit > 0 {
+			return db.Limit(limit)
+		}
+		return db
+	}
+}
@@ -0,0 +1,147 @@
+package taxonomyDao
+
+import (
+	"errors"
+
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+
+	"gorm.io/gorm"
+)
+
+const table = "taxonomy"
+
+// QueryModel set query condition, used by queryChain()
+type QueryModel struct {
+	ID       uint64
+	IDs      []uint64
+	ParentID uint64
+	Level    models.TaxonomyLevel
+	Code     string
+}
+
+// New a row
+func New(tx *gorm.DB, model *models.TaxonomyModel) (uint64, error) {
+
+	err := tx.Table(table).
+		Create(model).Error
+
+	if err != nil {
+		return 0, err
+	}
+	return model.ID, nil
+}
+
+// Get return a record as raw-data-form
+func Get(tx *gorm.DB, query *QueryModel) (*models.TaxonomyModel, error) {
+
+	result := &models.TaxonomyModel{}
+	err := tx.Table(table).
+		Scopes(queryChain(query)).
+		Take(result).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Gets return records as raw-data-form
+func Gets(tx *gorm.DB, query *QueryModel) ([]models.TaxonomyModel, error) {
+	result := make([]models.TaxonomyModel, 0)
+	err := tx.Table(table).
+		Scopes(queryChain(query)).
+		Order(table + ".level, " + table + ".code").
+		Scan(&result).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return []models.TaxonomyModel{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Modify update columns of a row
+func Modify(tx *gorm.DB, model *models.TaxonomyModel, updates map[string]interface{}) error {
+	if model.ID == 0 {
+		return errors.New("modify without id")
+	}
+
+	return tx.Table(table).
+		Where(table+".id = ?", model.ID).
+		Updates(updates).Error
+}
+
+// Delete delete a row
+func Delete(tx *gorm.DB, model *models.TaxonomyModel) error {
+	if model.ID == 0 {
+		return errors.New("delete without id")
+	}
+
+	return tx.Table(table).
+		Where(table+".id = ?", model.ID).
+		Delete(&models.TaxonomyModel{}).Error
+}
+
+func queryChain(query *QueryModel) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.
+			Scopes(idEqualScope(query.ID)).
+			Scopes(idInScope(query.IDs)).
+			Scopes(parentIDEqualScope(query.ParentID)).
+			Scopes(levelEqualScope(query.Level)).
+			Scopes(codeEqualScope(query.Code))
+
+	}
+}
+
+func idEqualScope(id uint64) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if id != 0 {
+			return db.Where(table+".id = ?", id)
+		}
+		return db
+	}
+}
+
+func idInScope(ids []uint64) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if len(ids) > 0 {
+			return db.Where(table+".id IN ?", ids)
+		}
+		return db
+	}
+}
+
+func parentIDEqualScope(parentID uint64) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if parentID != 0 {
+			return db.Where(table+".parent_id = ?", parentID)
+		}
+		return db
+	}
+}
+
+func levelEqualScope(level models.TaxonomyLevel) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if level != models.TaxonomyLevel_None {
+			return db.Where(table+".level = ?", level)
+		}
+		return db
+	}
+}
+
+func codeEqualScope(code string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if code != "" {
+			return db.Where(table+".code = ?", code)
+		}
+		return db
+	}
+}
@@ -0,0 +1,154 @@
+package webhookDeliveryDao
+
+import (
+	"errors"
+	"time"
+
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const table = "webhook_delivery"
+
+// QueryModel set query condition, used by queryChain()
+type QueryModel struct {
+	SubscriptionID uint64
+	Status         models.WebhookDeliveryStatus
+	Limit          int
+}
+
+// NewsIgnoreDuplicate adds the rows, skipping the ones of an event already
+// queued for the subscription
+func NewsIgnoreDuplicate(tx *gorm.DB, rows []*models.WebhookDeliveryModel) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	return tx.Table(table).
+		Clauses(clause.Insert{Modifier: "IGNORE"}).
+		Create(rows).Error
+}
+
+// Claim takes up to limit pending rows due at now, oldest first, and moves
+// their next attempt to leaseUntil so that no other dispatcher takes them
+// while they are being sent.
+func Claim(tx *gorm.DB, now, leaseUntil time.Time, limit int) ([]models.WebhookDeliveryModel, error) {
+	result := make([]models.WebhookDeliveryModel, 0)
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		err := tx.Table(table).
+			Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where(table+".status = ?", models.WebhookDeliveryStatus_Pending).
+			Where(table+".next_attempt_at <= ?", now).
+			Order(table + ".id").
+			Limit(limit).
+			Find(&result).Error
+		if err != nil || len(result) == 0 {
+			return err
+		}
+
+		ids := make([]uint64, 0, len(result))
+		for _, r := range result {
+			ids = append(ids, r.ID)
+		}
+		return tx.Table(table).
+			Where(table+".id IN ?", ids).
+			Update("next_attempt_at", leaseUntil).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Gets return records as raw-data-form, newest first
+func Gets(tx *gorm.DB, query *QueryModel) ([]models.WebhookDeliveryModel, error) {
+	result := make([]models.WebhookDeliveryModel, 0)
+	err := tx.Table(table).
+		Scopes(queryChain(query)).
+		Order(table + ".id DESC").
+		Scan(&result).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return []models.WebhookDeliveryModel{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Modify update columns of a row
+func Modify(tx *gorm.DB, model *models.WebhookDeliveryModel, updates map[string]interface{}) error {
+	if model.ID == 0 {
+		return errors.New("modify without id")
+	}
+
+	return tx.Table(table).
+		Where(table+".id = ?", model.ID).
+		Updates(updates).Error
+}
+
+// DeleteFinished deletes up to limit succeeded or failed rows last attempted
+// before the time, it returns the number of rows deleted. The last attempt
+// of a finished row is within the lease of its next_attempt_at.
+func DeleteFinished(tx *gorm.DB, before time.Time, limit int) (int64, error) {
+	ids := []uint64{}
+	err := tx.Table(table).
+		Where(table+".status IN ?", []models.WebhookDeliveryStatus{
+			models.WebhookDeliveryStatus_Succeeded,
+			models.WebhookDeliveryStatus_Failed,
+		}).
+		Where(table+".next_attempt_at < ?", before).
+		Order(table+".id").
+		Limit(limit).
+		Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	result := tx.Table(table).
+		Where(table+".id IN ?", ids).
+		Delete(&models.WebhookDeliveryModel{})
+	return result.RowsAffected, result.Error
+}
+
+func queryChain(query *QueryModel) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.
+			Scopes(subscriptionIDEqualScope(query.SubscriptionID)).
+			Scopes(statusEqualScope(query.Status)).
+			Scopes(limitScope(query.Limit))
+
+	}
+}
+
+func subscriptionIDEqualScope(subscriptionID uint64) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if subscriptionID != 0 {
+			return db.Where(table+".subscription_id = ?", subscriptionID)
+		}
+		return db
+	}
+}
+
+func statusEqualScope(status models.WebhookDeliveryStatus) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if status != 0 {
+			return db.Where(table+".status = ?", status)
+		}
+		return db
+	}
+}
+
+func limitScope(limit int) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if limit > 0 {
+			return db.Limit(limit)
+		}
+		return db
+	}
+}
@@ -0,0 +1,114 @@
+package webhookSubscriptionDao
+
+import (
+	"errors"
+
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+
+	"gorm.io/gorm"
+)
+
+const table = "webhook_subscription"
+
+// QueryModel set query condition, used by queryChain()
+type QueryModel struct {
+	ID     uint64
+	Status int
+}
+
+// New a row
+func New(tx *gorm.DB, model *models.WebhookSubscriptionModel) (uint64, error) {
+
+	err := tx.Table(table).
+		Create(model).Error
+
+	if err != nil {
+		return 0, err
+	}
+	return model.ID, nil
+}
+
+// Get return a record as raw-data-form
+func Get(tx *gorm.DB, query *QueryModel) (*models.WebhookSubscriptionModel, error) {
+
+	result := &models.WebhookSubscriptionModel{}
+	err := tx.Table(table).
+		Scopes(queryChain(query)).
+		Take(result).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Gets return records as raw-data-form, ordered by id
+func Gets(tx *gorm.DB, query *QueryModel) ([]models.WebhookSubscriptionModel, error) {
+	result := make([]models.WebhookSubscriptionModel, 0)
+	err := tx.Table(table).
+		Scopes(queryChain(query)).
+		Order(table + ".id").
+		Scan(&result).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return []models.WebhookSubscriptionModel{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Modify update columns of a row
+func Modify(tx *gorm.DB, model *models.WebhookSubscriptionModel, updates map[string]interface{}) error {
+	if model.ID == 0 {
+		return errors.New("modify without id")
+	}
+
+	return tx.Table(table).
+		Where(table+".id = ?", model.ID).
+		Updates(updates).Error
+}
+
+// Delete a row, its deliveries go with it
+func Delete(tx *gorm.DB, model *models.WebhookSubscriptionModel) error {
+	if model.ID == 0 {
+		return errors.New("delete without id")
+	}
+
+	return tx.Table(table).
+		Where(table+".id = ?", model.ID).
+		Delete(&models.WebhookSubscriptionModel{}).Error
+}
+
+func queryChain(query *QueryModel) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.
+			Scopes(idEqualScope(query.ID)).
+			Scopes(statusEqualScope(query.Status))
+
+	}
+}
+
+func idEqualScope(id uint64) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if id != 0 {
+			return db.Where(table+".id = ?", id)
+		}
+		return db
+	}
+}
+
+func statusEqualScope(status int) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if status != 0 {
+			return db.Where(table+".status = ?", status)
+		}
+		return db
+	}
+}
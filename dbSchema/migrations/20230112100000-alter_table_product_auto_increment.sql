@@ -0,0 +1,7 @@
+
+-- +migrate Up
+ALTER TABLE `product` MODIFY `id` INTEGER UNSIGNED NOT NULL AUTO_INCREMENT COMMENT 'id';
+
+
+-- +migrate Down
+ALTER TABLE `product` MODIFY `id` INTEGER UNSIGNED NOT NULL COMMENT 'id';
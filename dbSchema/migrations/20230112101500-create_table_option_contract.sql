@@ -0,0 +1,21 @@
+
+-- +migrate Up
+CREATE TABLE `option_contract` (
+    `product_id` INTEGER UNSIGNED NOT NULL COMMENT '產品id',
+    `underlying_id` INTEGER UNSIGNED NOT NULL COMMENT '標的產品id',
+    `expiry_date` DATE NOT NULL COMMENT '到期日',
+    `strike_price` DECIMAL(20,8) NOT NULL COMMENT '履約價',
+    `option_right` TINYINT(4) NOT NULL COMMENT '權利類別 1:call, 2:put',
+    `multiplier` DECIMAL(15,4) NOT NULL DEFAULT 1 COMMENT '契約乘數',
+    `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '創建時間',
+    `updated_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新時間',
+    PRIMARY KEY (`product_id`),
+    UNIQUE INDEX (`underlying_id`, `expiry_date`, `strike_price`, `option_right`),
+    FOREIGN KEY (`product_id`) REFERENCES product(`id`) ON DELETE CASCADE,
+    FOREIGN KEY (`underlying_id`) REFERENCES product(`id`) ON DELETE CASCADE
+) CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='選擇權契約';
+
+
+-- +migrate Down
+SET FOREIGN_KEY_CHECKS=0;
+DROP TABLE IF EXISTS `option_contract`;
@@ -0,0 +1,19 @@
+
+-- +migrate Up
+CREATE TABLE `product_vendor_symbol` (
+    `id` INTEGER UNSIGNED NOT NULL AUTO_INCREMENT,
+    `product_id` INTEGER UNSIGNED NOT NULL COMMENT '產品id',
+    `vendor` VARCHAR(32) NOT NULL COMMENT '行情供應商 ex:yahoo, binance, tradingview',
+    `symbol` VARCHAR(64) NOT NULL COMMENT '供應商代號',
+    `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '創建時間',
+    `updated_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新時間',
+    PRIMARY KEY (`id`),
+    UNIQUE INDEX (`vendor`, `symbol`),
+    UNIQUE INDEX (`product_id`, `vendor`),
+    FOREIGN KEY (`product_id`) REFERENCES product(`id`) ON DELETE CASCADE
+) AUTO_INCREMENT=1 CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='產品供應商代號對照';
+
+
+-- +migrate Down
+SET FOREIGN_KEY_CHECKS=0;
+DROP TABLE IF EXISTS `product_vendor_symbol`;
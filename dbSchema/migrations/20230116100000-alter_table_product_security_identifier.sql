@@ -0,0 +1,23 @@
+
+-- +migrate Up
+ALTER TABLE `product`
+    ADD COLUMN `isin` CHAR(12) NULL DEFAULT NULL COMMENT 'ISIN' AFTER `icon_id`,
+    ADD COLUMN `cusip` CHAR(9) NULL DEFAULT NULL COMMENT 'CUSIP' AFTER `isin`,
+    ADD COLUMN `sedol` CHAR(7) NULL DEFAULT NULL COMMENT 'SEDOL' AFTER `cusip`,
+    ADD COLUMN `figi` CHAR(12) NULL DEFAULT NULL COMMENT 'FIGI' AFTER `sedol`,
+    ADD UNIQUE INDEX `uk_product_isin` (`isin`),
+    ADD UNIQUE INDEX `uk_product_cusip` (`cusip`),
+    ADD UNIQUE INDEX `uk_product_sedol` (`sedol`),
+    ADD UNIQUE INDEX `uk_product_figi` (`figi`);
+
+
+-- +migrate Down
+ALTER TABLE `product`
+    DROP INDEX `uk_product_isin`,
+    DROP INDEX `uk_product_cusip`,
+    DROP INDEX `uk_product_sedol`,
+    DROP INDEX `uk_product_figi`,
+    DROP COLUMN `isin`,
+    DROP COLUMN `cusip`,
+    DROP COLUMN `sedol`,
+    DROP COLUMN `figi`;
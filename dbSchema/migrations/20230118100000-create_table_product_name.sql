@@ -0,0 +1,19 @@
+
+-- +migrate Up
+CREATE TABLE `product_name` (
+    `id` INTEGER UNSIGNED NOT NULL AUTO_INCREMENT,
+    `product_id` INTEGER UNSIGNED NOT NULL COMMENT '產品id',
+    `locale` VARCHAR(16) NOT NULL COMMENT '語系 ex:zh-TW, en, ja',
+    `short_name` VARCHAR(32) NOT NULL COMMENT '簡稱',
+    `long_name` VARCHAR(128) NOT NULL COMMENT '全名',
+    `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '創建時間',
+    `updated_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新時間',
+    PRIMARY KEY (`id`),
+    UNIQUE INDEX (`product_id`, `locale`),
+    FOREIGN KEY (`product_id`) REFERENCES product(`id`) ON DELETE CASCADE
+) AUTO_INCREMENT=1 CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='產品多語系名稱';
+
+
+-- +migrate Down
+SET FOREIGN_KEY_CHECKS=0;
+DROP TABLE IF EXISTS `product_name`;
@@ -0,0 +1,17 @@
+
+-- +migrate Up
+CREATE TABLE `product_alias` (
+    `id` INTEGER UNSIGNED NOT NULL AUTO_INCREMENT,
+    `product_id` INTEGER UNSIGNED NOT NULL COMMENT '產品id',
+    `alias` VARCHAR(64) NOT NULL COMMENT '別名',
+    `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '創建時間',
+    PRIMARY KEY (`id`),
+    UNIQUE INDEX (`product_id`, `alias`),
+    INDEX (`alias`),
+    FOREIGN KEY (`product_id`) REFERENCES product(`id`) ON DELETE CASCADE
+) AUTO_INCREMENT=1 CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='產品別名';
+
+
+-- +migrate Down
+SET FOREIGN_KEY_CHECKS=0;
+DROP TABLE IF EXISTS `product_alias`;
@@ -0,0 +1,22 @@
+
+-- +migrate Up
+CREATE TABLE `product_phonetic` (
+    `id` INTEGER UNSIGNED NOT NULL AUTO_INCREMENT,
+    `product_id` INTEGER UNSIGNED NOT NULL COMMENT '產品id',
+    `source` VARCHAR(128) NOT NULL COMMENT '來源名稱',
+    `pinyin` VARCHAR(1024) NOT NULL COMMENT '拼音',
+    `pinyin_initials` VARCHAR(128) NOT NULL COMMENT '拼音首字母',
+    `zhuyin` VARCHAR(512) NOT NULL COMMENT '注音',
+    `zhuyin_initials` VARCHAR(128) NOT NULL COMMENT '注音首字',
+    `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '創建時間',
+    PRIMARY KEY (`id`),
+    UNIQUE INDEX (`product_id`, `source`),
+    INDEX (`pinyin_initials`),
+    INDEX (`zhuyin_initials`),
+    FOREIGN KEY (`product_id`) REFERENCES product(`id`) ON DELETE CASCADE
+) AUTO_INCREMENT=1 CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='產品名稱拼音注音索引';
+
+
+-- +migrate Down
+SET FOREIGN_KEY_CHECKS=0;
+DROP TABLE IF EXISTS `product_phonetic`;
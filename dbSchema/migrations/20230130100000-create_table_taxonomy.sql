@@ -0,0 +1,27 @@
+-- +migrate Up
+CREATE TABLE `taxonomy` (
+    `id` INTEGER UNSIGNED NOT NULL AUTO_INCREMENT,
+    `parent_id` INTEGER UNSIGNED NULL DEFAULT NULL COMMENT '上層分類id',
+    `level` TINYINT UNSIGNED NOT NULL COMMENT '層級 1:sector 2:industry group 3:industry 4:sub-industry',
+    `code` VARCHAR(16) NOT NULL COMMENT '分類代碼',
+    `name` VARCHAR(64) NOT NULL COMMENT '分類名稱',
+    `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '創建時間',
+    `updated_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新時間',
+    PRIMARY KEY (`id`),
+    UNIQUE INDEX (`code`),
+    INDEX (`parent_id`),
+    FOREIGN KEY (`parent_id`) REFERENCES taxonomy(`id`)
+) AUTO_INCREMENT=1 CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='產業分類';
+
+ALTER TABLE `product`
+    ADD COLUMN `taxonomy_id` INTEGER UNSIGNED NULL DEFAULT NULL COMMENT '產業分類id' AFTER `figi`,
+    ADD CONSTRAINT `fk_product_taxonomy` FOREIGN KEY (`taxonomy_id`) REFERENCES taxonomy(`id`);
+
+
+-- +migrate Down
+ALTER TABLE `product`
+    DROP FOREIGN KEY `fk_product_taxonomy`,
+    DROP COLUMN `taxonomy_id`;
+
+SET FOREIGN_KEY_CHECKS=0;
+DROP TABLE IF EXISTS `taxonomy`;
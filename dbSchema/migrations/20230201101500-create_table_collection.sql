@@ -0,0 +1,46 @@
+-- +migrate Up
+CREATE TABLE `collection` (
+    `id` INTEGER UNSIGNED NOT NULL AUTO_INCREMENT,
+    `code` VARCHAR(32) NOT NULL COMMENT '精選清單代碼',
+    `title` VARCHAR(64) NOT NULL COMMENT '標題',
+    `description` TEXT NOT NULL COMMENT '說明',
+    `status` TINYINT UNSIGNED NOT NULL DEFAULT 1 COMMENT '狀態 1:enabled 2:disabled',
+    `display` TINYINT UNSIGNED NOT NULL DEFAULT 1 COMMENT '顯示 1:enabled 2:disabled',
+    `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '創建時間',
+    `updated_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新時間',
+    PRIMARY KEY (`id`),
+    UNIQUE INDEX (`code`)
+) AUTO_INCREMENT=1 CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='精選產品清單';
+
+CREATE TABLE `collection_name` (
+    `id` INTEGER UNSIGNED NOT NULL AUTO_INCREMENT,
+    `collection_id` INTEGER UNSIGNED NOT NULL COMMENT '精選清單id',
+    `locale` VARCHAR(16) NOT NULL COMMENT '語系 ex:zh-TW, en, ja',
+    `title` VARCHAR(64) NOT NULL COMMENT '標題',
+    `description` TEXT NOT NULL COMMENT '說明',
+    `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '創建時間',
+    `updated_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新時間',
+    PRIMARY KEY (`id`),
+    UNIQUE INDEX (`collection_id`, `locale`),
+    FOREIGN KEY (`collection_id`) REFERENCES collection(`id`) ON DELETE CASCADE
+) AUTO_INCREMENT=1 CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='精選清單多語系名稱';
+
+CREATE TABLE `collection_member` (
+    `id` INTEGER UNSIGNED NOT NULL AUTO_INCREMENT,
+    `collection_id` INTEGER UNSIGNED NOT NULL COMMENT '精選清單id',
+    `product_id` INTEGER UNSIGNED NOT NULL COMMENT '產品id',
+    `sort_order` INTEGER UNSIGNED NOT NULL COMMENT '排序',
+    `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '創建時間',
+    PRIMARY KEY (`id`),
+    UNIQUE INDEX (`collection_id`, `product_id`),
+    INDEX (`collection_id`, `sort_order`),
+    FOREIGN KEY (`collection_id`) REFERENCES collection(`id`) ON DELETE CASCADE,
+    FOREIGN KEY (`product_id`) REFERENCES product(`id`) ON DELETE CASCADE
+) AUTO_INCREMENT=1 CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='精選清單成員';
+
+
+-- +migrate Down
+SET FOREIGN_KEY_CHECKS=0;
+DROP TABLE IF EXISTS `collection_member`;
+DROP TABLE IF EXISTS `collection_name`;
+DROP TABLE IF EXISTS `collection`;
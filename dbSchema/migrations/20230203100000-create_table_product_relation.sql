@@ -0,0 +1,21 @@
+-- +migrate Up
+CREATE TABLE `product_relation` (
+    `id` INTEGER UNSIGNED NOT NULL AUTO_INCREMENT,
+    `product_id` INTEGER UNSIGNED NOT NULL COMMENT '產品id',
+    `related_product_id` INTEGER UNSIGNED NOT NULL COMMENT '關聯產品id',
+    `relation_type` TINYINT(4) NOT NULL COMMENT '關聯類別 1:constituent of, 2:underlying of, 3:ADR of, 4:dual listed with',
+    `weight` DECIMAL(9,6) NULL DEFAULT NULL COMMENT '成分權重(%), 僅 constituent of',
+    `effective_date` DATE NOT NULL COMMENT '生效日',
+    `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '創建時間',
+    `updated_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新時間',
+    PRIMARY KEY (`id`),
+    UNIQUE INDEX (`product_id`, `related_product_id`, `relation_type`, `effective_date`),
+    INDEX (`related_product_id`, `relation_type`, `effective_date`),
+    FOREIGN KEY (`product_id`) REFERENCES product(`id`) ON DELETE CASCADE,
+    FOREIGN KEY (`related_product_id`) REFERENCES product(`id`) ON DELETE CASCADE
+) AUTO_INCREMENT=1 CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='產品關聯';
+
+
+-- +migrate Down
+SET FOREIGN_KEY_CHECKS=0;
+DROP TABLE IF EXISTS `product_relation`;
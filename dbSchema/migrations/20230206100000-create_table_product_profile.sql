@@ -0,0 +1,31 @@
+-- +migrate Up
+CREATE TABLE `product_profile` (
+    `product_id` INTEGER UNSIGNED NOT NULL COMMENT '產品id',
+    `website` VARCHAR(255) NOT NULL DEFAULT '' COMMENT '公司網站',
+    `listing_date` DATE NULL DEFAULT NULL COMMENT '上市日',
+    `shares_outstanding` BIGINT UNSIGNED NULL DEFAULT NULL COMMENT '流通在外股數',
+    `country_of_incorporation` CHAR(2) NOT NULL DEFAULT '' COMMENT '註冊國家 ISO 3166-1 alpha-2',
+    `market_segment` VARCHAR(32) NOT NULL DEFAULT '' COMMENT '市場別 ex:上市, 上櫃, 興櫃',
+    `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '創建時間',
+    `updated_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新時間',
+    PRIMARY KEY (`product_id`),
+    FOREIGN KEY (`product_id`) REFERENCES product(`id`) ON DELETE CASCADE
+) CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='公司基本資料';
+
+CREATE TABLE `product_profile_description` (
+    `id` INTEGER UNSIGNED NOT NULL AUTO_INCREMENT,
+    `product_id` INTEGER UNSIGNED NOT NULL COMMENT '產品id',
+    `locale` VARCHAR(16) NOT NULL COMMENT '語系 ex:zh-TW, en, ja',
+    `description` TEXT NOT NULL COMMENT '公司簡介',
+    `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '創建時間',
+    `updated_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新時間',
+    PRIMARY KEY (`id`),
+    UNIQUE INDEX (`product_id`, `locale`),
+    FOREIGN KEY (`product_id`) REFERENCES product_profile(`product_id`) ON DELETE CASCADE
+) AUTO_INCREMENT=1 CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='公司簡介多語系';
+
+
+-- +migrate Down
+SET FOREIGN_KEY_CHECKS=0;
+DROP TABLE IF EXISTS `product_profile_description`;
+DROP TABLE IF EXISTS `product_profile`;
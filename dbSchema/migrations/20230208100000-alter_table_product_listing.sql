@@ -0,0 +1,14 @@
+-- +migrate Up
+ALTER TABLE `product`
+    ADD COLUMN `listed_at` DATETIME NULL DEFAULT NULL COMMENT '上市時間' AFTER `taxonomy_id`,
+    ADD COLUMN `delisted_at` DATETIME NULL DEFAULT NULL COMMENT '下市時間' AFTER `listed_at`,
+    ADD INDEX `idx_product_listed_at` (`listed_at`),
+    ADD INDEX `idx_product_delisted_at` (`delisted_at`);
+
+
+-- +migrate Down
+ALTER TABLE `product`
+    DROP INDEX `idx_product_listed_at`,
+    DROP INDEX `idx_product_delisted_at`,
+    DROP COLUMN `listed_at`,
+    DROP COLUMN `delisted_at`;
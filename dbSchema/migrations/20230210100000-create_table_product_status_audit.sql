@@ -0,0 +1,19 @@
+-- +migrate Up
+CREATE TABLE `product_status_audit` (
+    `id` INTEGER UNSIGNED NOT NULL AUTO_INCREMENT,
+    `exchange_code` VARCHAR(32) NOT NULL DEFAULT '' COMMENT '交易所代號, 空白為全部',
+    `product_type` TINYINT(4) NOT NULL DEFAULT 0 COMMENT '產品種類, 0為全部',
+    `status` TINYINT(4) NULL DEFAULT NULL COMMENT '設定狀態 1:enabled, 2:disabled',
+    `display` TINYINT(4) NULL DEFAULT NULL COMMENT '設定顯示 1:enabled, 2:disabled',
+    `affected` INTEGER UNSIGNED NOT NULL COMMENT '影響產品數',
+    `operator` VARCHAR(64) NOT NULL COMMENT '操作者',
+    `reason` VARCHAR(255) NOT NULL DEFAULT '' COMMENT '原因',
+    `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '創建時間',
+    PRIMARY KEY (`id`),
+    INDEX (`exchange_code`, `created_at`)
+) AUTO_INCREMENT=1 CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='產品批次狀態異動紀錄';
+
+
+-- +migrate Down
+SET FOREIGN_KEY_CHECKS=0;
+DROP TABLE IF EXISTS `product_status_audit`;
@@ -0,0 +1,31 @@
+-- +migrate Up
+ALTER TABLE `exchange`
+    ADD COLUMN `currency_code` VARCHAR(32) NULL DEFAULT NULL COMMENT '預設貨幣代號' AFTER `location`,
+    ADD COLUMN `tick_ladder` VARCHAR(1024) NULL DEFAULT NULL COMMENT '預設報價間隔 [{"from":0,"tick":0.01}]' AFTER `currency_code`,
+    ADD COLUMN `lot_size` DECIMAL(15,10) NULL DEFAULT NULL COMMENT '預設每手單位' AFTER `tick_ladder`,
+    ADD COLUMN `minimum_order` DECIMAL(15,10) NULL DEFAULT NULL COMMENT '預設最小購買單位' AFTER `lot_size`,
+    ADD COLUMN `price_limit_rule` VARCHAR(128) NULL DEFAULT NULL COMMENT '預設漲跌幅限制 {"type":"percent","value":10}' AFTER `minimum_order`;
+
+ALTER TABLE `product`
+    MODIFY COLUMN `currency_code` VARCHAR(32) NULL DEFAULT NULL COMMENT '貨幣代號 NULL:交易所預設',
+    MODIFY COLUMN `tick_unit` DECIMAL(4,2) NULL DEFAULT NULL COMMENT '報價間隔 NULL:交易所預設',
+    ADD COLUMN `lot_size` DECIMAL(15,10) NULL DEFAULT NULL COMMENT '每手單位 NULL:交易所預設' AFTER `tick_unit`,
+    ADD COLUMN `price_limit_rule` VARCHAR(128) NULL DEFAULT NULL COMMENT '漲跌幅限制 NULL:交易所預設' AFTER `minimum_order`;
+
+
+-- +migrate Down
+UPDATE `product` SET `currency_code` = '' WHERE `currency_code` IS NULL;
+UPDATE `product` SET `tick_unit` = 0 WHERE `tick_unit` IS NULL;
+
+ALTER TABLE `product`
+    MODIFY COLUMN `currency_code` VARCHAR(32) NOT NULL COMMENT '貨幣代號',
+    MODIFY COLUMN `tick_unit` DECIMAL(4,2) NOT NULL COMMENT '報價間隔',
+    DROP COLUMN `lot_size`,
+    DROP COLUMN `price_limit_rule`;
+
+ALTER TABLE `exchange`
+    DROP COLUMN `currency_code`,
+    DROP COLUMN `tick_ladder`,
+    DROP COLUMN `lot_size`,
+    DROP COLUMN `minimum_order`,
+    DROP COLUMN `price_limit_rule`;
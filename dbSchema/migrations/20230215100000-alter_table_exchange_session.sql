@@ -0,0 +1,12 @@
+-- +migrate Up
+ALTER TABLE `exchange`
+    ADD COLUMN `pre_open_time` TIMESTAMP NULL DEFAULT NULL COMMENT '每日開盤前時段開始時間' AFTER `timezone_offset`,
+    ADD COLUMN `break_start_time` TIMESTAMP NULL DEFAULT NULL COMMENT '每日午休開始時間' AFTER `open_time`,
+    ADD COLUMN `break_end_time` TIMESTAMP NULL DEFAULT NULL COMMENT '每日午休結束時間' AFTER `break_start_time`;
+
+
+-- +migrate Down
+ALTER TABLE `exchange`
+    DROP COLUMN `pre_open_time`,
+    DROP COLUMN `break_start_time`,
+    DROP COLUMN `break_end_time`;
@@ -0,0 +1,23 @@
+-- +migrate Up
+CREATE TABLE `event_outbox` (
+    `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `event_type` VARCHAR(64) NOT NULL COMMENT '事件種類 ex:product.modified',
+    `aggregate_type` VARCHAR(32) NOT NULL COMMENT '對象種類 product, exchange',
+    `aggregate_id` VARCHAR(64) NOT NULL COMMENT '對象id, 交易所為代號',
+    `payload` TEXT NOT NULL COMMENT '內容 json',
+    `status` TINYINT(4) NOT NULL DEFAULT 1 COMMENT '狀態 1:pending, 2:published, 3:dead',
+    `attempts` INTEGER UNSIGNED NOT NULL DEFAULT 0 COMMENT '發送次數',
+    `next_attempt_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '下次發送時間',
+    `last_error` VARCHAR(512) NULL DEFAULT NULL COMMENT '最後一次發送錯誤',
+    `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '創建時間',
+    `published_at` TIMESTAMP NULL DEFAULT NULL COMMENT '發送成功時間',
+    PRIMARY KEY (`id`),
+    INDEX (`status`, `next_attempt_at`),
+    INDEX (`aggregate_type`, `aggregate_id`, `status`),
+    INDEX (`published_at`)
+) AUTO_INCREMENT=1 CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='事件發送佇列';
+
+
+-- +migrate Down
+SET FOREIGN_KEY_CHECKS=0;
+DROP TABLE IF EXISTS `event_outbox`;
@@ -0,0 +1,37 @@
+-- +migrate Up
+CREATE TABLE `webhook_subscription` (
+    `id` INTEGER UNSIGNED NOT NULL AUTO_INCREMENT,
+    `url` VARCHAR(512) NOT NULL COMMENT '接收網址 https',
+    `secret` VARCHAR(128) NOT NULL COMMENT '簽章金鑰',
+    `event_types` VARCHAR(1024) NOT NULL DEFAULT '[]' COMMENT '訂閱事件種類 ["product.*"], 空為全部',
+    `status` TINYINT(4) NOT NULL DEFAULT 1 COMMENT '狀態 1:enabled, 2:disabled',
+    `description` VARCHAR(255) NOT NULL DEFAULT '' COMMENT '說明',
+    `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '創建時間',
+    `updated_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新時間',
+    PRIMARY KEY (`id`)
+) AUTO_INCREMENT=1 CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='webhook訂閱';
+
+CREATE TABLE `webhook_delivery` (
+    `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `subscription_id` INTEGER UNSIGNED NOT NULL COMMENT 'webhook訂閱id',
+    `event_id` BIGINT UNSIGNED NOT NULL COMMENT '事件id',
+    `event_type` VARCHAR(64) NOT NULL COMMENT '事件種類',
+    `body` TEXT NOT NULL COMMENT '發送內容 json',
+    `status` TINYINT(4) NOT NULL DEFAULT 1 COMMENT '狀態 1:pending, 2:succeeded, 3:failed',
+    `attempts` INTEGER UNSIGNED NOT NULL DEFAULT 0 COMMENT '發送次數',
+    `next_attempt_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '下次發送時間',
+    `response_code` SMALLINT NULL DEFAULT NULL COMMENT '最後一次回應狀態碼',
+    `last_error` VARCHAR(512) NULL DEFAULT NULL COMMENT '最後一次發送錯誤',
+    `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '創建時間',
+    `delivered_at` TIMESTAMP NULL DEFAULT NULL COMMENT '發送成功時間',
+    PRIMARY KEY (`id`),
+    UNIQUE INDEX (`subscription_id`, `event_id`),
+    INDEX (`status`, `next_attempt_at`),
+    FOREIGN KEY (`subscription_id`) REFERENCES webhook_subscription(`id`) ON DELETE CASCADE
+) AUTO_INCREMENT=1 CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='webhook發送紀錄';
+
+
+-- +migrate Down
+SET FOREIGN_KEY_CHECKS=0;
+DROP TABLE IF EXISTS `webhook_delivery`;
+DROP TABLE IF EXISTS `webhook_subscription`;
@@ -0,0 +1,30 @@
+-- +migrate Up
+CREATE TABLE `catalog_revision` (
+    `id` TINYINT(4) UNSIGNED NOT NULL COMMENT 'id, 只有一列',
+    `revision` BIGINT UNSIGNED NOT NULL DEFAULT 0 COMMENT '目錄最新版本',
+    PRIMARY KEY (`id`)
+) CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='目錄版本';
+
+INSERT INTO `catalog_revision` (`id`, `revision`) VALUES (1, 0);
+
+ALTER TABLE `product`
+    ADD COLUMN `revision` BIGINT UNSIGNED NOT NULL DEFAULT 0 COMMENT '最後寫入的目錄版本' AFTER `delisted_at`,
+    ADD COLUMN `deleted_at` TIMESTAMP NULL DEFAULT NULL COMMENT '刪除時間' AFTER `revision`,
+    ADD INDEX `idx_product_revision` (`revision`, `id`);
+
+ALTER TABLE `exchange`
+    ADD COLUMN `revision` BIGINT UNSIGNED NOT NULL DEFAULT 0 COMMENT '最後寫入的目錄版本' AFTER `display`,
+    ADD INDEX `idx_exchange_revision` (`revision`);
+
+
+-- +migrate Down
+ALTER TABLE `exchange`
+    DROP INDEX `idx_exchange_revision`,
+    DROP COLUMN `revision`;
+
+ALTER TABLE `product`
+    DROP INDEX `idx_product_revision`,
+    DROP COLUMN `revision`,
+    DROP COLUMN `deleted_at`;
+
+DROP TABLE IF EXISTS `catalog_revision`;
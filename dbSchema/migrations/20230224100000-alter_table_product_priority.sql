@@ -0,0 +1,12 @@
+-- +migrate Up
+ALTER TABLE `product`
+    ADD COLUMN `priority` INTEGER NOT NULL DEFAULT 0 COMMENT '自訂排序權重' AFTER `display`,
+    ADD INDEX `idx_product_priority` (`priority`),
+    ADD INDEX `idx_product_updated_at` (`updated_at`);
+
+
+-- +migrate Down
+ALTER TABLE `product`
+    DROP INDEX `idx_product_priority`,
+    DROP INDEX `idx_product_updated_at`,
+    DROP COLUMN `priority`;
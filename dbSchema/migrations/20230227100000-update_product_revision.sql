@@ -0,0 +1,8 @@
+-- +migrate Up
+-- an exchange write now bumps the revision of its products too
+UPDATE `product` JOIN `exchange` ON `exchange`.`code` = `product`.`exchange_code`
+SET `product`.`revision` = `exchange`.`revision`, `product`.`updated_at` = `product`.`updated_at`
+WHERE `exchange`.`revision` > `product`.`revision`;
+
+
+-- +migrate Down
@@ -7,7 +7,10 @@ import (
 
 	"github.com/paper-trade-chatbot/be-common/cache"
 	"github.com/paper-trade-chatbot/be-common/database"
+	"github.com/paper-trade-chatbot/be-product/service/event"
+	"github.com/paper-trade-chatbot/be-product/service/grpcError"
 	"github.com/paper-trade-chatbot/be-product/service/product"
+	"github.com/paper-trade-chatbot/be-product/service/webhook"
 	productGrpc "github.com/paper-trade-chatbot/be-proto/product"
 
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
@@ -55,16 +58,25 @@ func main() {
 	grpc := grpc.NewServer(
 		grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(
 			grpc_recovery.StreamServerInterceptor(recoveryOpt),
+			grpcError.StreamServerInterceptor(),
 		)),
 		grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(
 			grpc_recovery.UnaryServerInterceptor(recoveryOpt),
+			grpcError.UnaryServerInterceptor(),
 		)),
 	)
 	reflection.Register(grpc)
 
+	event.SetPublishers(&event.LogPublisher{}, &webhook.Publisher{})
+
 	productInstance := product.New()
 	productGrpc.RegisterProductServiceServer(grpc, productInstance)
 
+	go productInstance.StartLifecycleJob(ctx)
+	go productInstance.StartCatalogSync(ctx)
+	go event.StartRelay(ctx)
+	go webhook.NewDispatcher(nil).Start(ctx)
+
 	address := fmt.Sprintf("%s:%s",
 		config.GetString("SERVER_LISTEN_ADDRESS"),
 		config.GetString("SERVER_LISTEN_PORT"))
@@ -0,0 +1,8 @@
+package models
+
+// CatalogRevisionModel is the only row of catalog_revision, the revision of
+// the last product or exchange write.
+type CatalogRevisionModel struct {
+	ID       uint64 `gorm:"column:id; primary_key"`
+	Revision uint64 `gorm:"column:revision"`
+}
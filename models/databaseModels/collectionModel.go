@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+)
+
+type CollectionModel struct {
+	ID          uint64    `gorm:"column:id; primary_key"`
+	Code        string    `gorm:"column:code"`
+	Title       string    `gorm:"column:title"`
+	Description string    `gorm:"column:description"`
+	Status      int       `gorm:"column:status"`  // 1:enabled , 2:disabled
+	Display     int       `gorm:"column:display"` // 1:enabled , 2:disabled
+	CreatedAt   time.Time `gorm:"column:created_at"`
+	UpdatedAt   time.Time `gorm:"column:updated_at"`
+}
+
+type CollectionNameModel struct {
+	ID           uint64    `gorm:"column:id; primary_key"`
+	CollectionID uint64    `gorm:"column:collection_id"`
+	Locale       string    `gorm:"column:locale"`
+	Title        string    `gorm:"column:title"`
+	Description  string    `gorm:"column:description"`
+	CreatedAt    time.Time `gorm:"column:created_at"`
+	UpdatedAt    time.Time `gorm:"column:updated_at"`
+}
+
+type CollectionMemberModel struct {
+	ID           uint64    `gorm:"column:id; primary_key"`
+	CollectionID uint64    `gorm:"column:collection_id"`
+	ProductID    uint64    `gorm:"column:product_id"`
+	SortOrder    int       `gorm:"column:sort_order"`
+	CreatedAt    time.Time `gorm:"column:created_at"`
+}
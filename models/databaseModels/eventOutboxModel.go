@@ -0,0 +1,62 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+type EventType string
+
+const (
+	EventType_ProductCreated        EventType = "product.created"
+	EventType_ProductModified       EventType = "product.modified"
+	EventType_ProductDelisted       EventType = "product.delisted"
+	EventType_ProductDeleted        EventType = "product.deleted"
+	EventType_ExchangeCreated       EventType = "exchange.created"
+	EventType_ExchangeModified      EventType = "exchange.modified"
+	EventType_ExchangeStatusChanged EventType = "exchange.status_changed"
+	EventType_HolidayUpdated        EventType = "holiday.updated"
+	EventType_HolidayDeleted        EventType = "holiday.deleted"
+)
+
+// EventTypes are every event type, in the order above
+var EventTypes = []EventType{
+	EventType_ProductCreated,
+	EventType_ProductModified,
+	EventType_ProductDelisted,
+	EventType_ProductDeleted,
+	EventType_ExchangeCreated,
+	EventType_ExchangeModified,
+	EventType_ExchangeStatusChanged,
+	EventType_HolidayUpdated,
+	EventType_HolidayDeleted,
+}
+
+type AggregateType string
+
+const (
+	AggregateType_Product  AggregateType = "product"
+	AggregateType_Exchange AggregateType = "exchange"
+)
+
+type EventOutboxStatus int
+
+const (
+	EventOutboxStatus_Pending   EventOutboxStatus = 1
+	EventOutboxStatus_Published EventOutboxStatus = 2
+	EventOutboxStatus_Dead      EventOutboxStatus = 3
+)
+
+type EventOutboxModel struct {
+	ID            uint64            `gorm:"column:id; primary_key"`
+	EventType     EventType         `gorm:"column:event_type"`
+	AggregateType AggregateType     `gorm:"column:aggregate_type"`
+	AggregateID   string            `gorm:"column:aggregate_id"`
+	Payload       string            `gorm:"column:payload"` // json
+	Status        EventOutboxStatus `gorm:"column:status"`
+	Attempts      int               `gorm:"column:attempts"`
+	NextAttemptAt time.Time         `gorm:"column:next_attempt_at"`
+	LastError     sql.NullString    `gorm:"column:last_error"`
+	CreatedAt     time.Time         `gorm:"column:created_at"`
+	PublishedAt   sql.NullTime      `gorm:"column:published_at"`
+}
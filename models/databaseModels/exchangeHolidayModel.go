@@ -5,22 +5,22 @@ import (
 	"time"
 )
 
-type ExchangeHolidayType int
+type ExchangeHolidayType string
 
 const (
-	ExchangeHolidayType_None ExchangeHolidayType = iota
-	ExchangeHolidayType_FullDay
-	ExchangeHolidayType_HalfDay
+	ExchangeHolidayType_None    ExchangeHolidayType = "none"
+	ExchangeHolidayType_FullDay ExchangeHolidayType = "fullday"
+	ExchangeHolidayType_HalfDay ExchangeHolidayType = "halfday"
 )
 
 type ExchangeHolidayModel struct {
 	ID               uint64              `gorm:"column:id; primary_key"`
+	ExchangeID       uint64              `gorm:"column:exchange_id"`
 	Name             string              `gorm:"column:name"`
 	Date             time.Time           `gorm:"column:date"`
-	EndDate          sql.NullTime        `gorm:"column:end_date"`
-	Type             ExchangeHolidayType `gorm:"type:enum('ExchangeHolidayType_None', 'ExchangeHolidayType_FullDay', 'ExchangeHolidayType_HalfDay')";"column:type"`
-	ExchangeCode     string              `gorm:"column:exchange_code"`
+	EndDate          sql.NullTime        `gorm:"column:end_date"` // 包含當日
+	Type             ExchangeHolidayType `gorm:"column:type"`
 	UpdatedAt        time.Time           `gorm:"column:updated_at"`
 	HalfDayCloseTime sql.NullTime        `gorm:"column:half_day_close_time"`
-	Memo             string              `gorm:"column:memo"`
+	Memo             sql.NullString      `gorm:"column:memo"`
 }
@@ -6,23 +6,33 @@ import (
 )
 
 type ExchangeModel struct {
-	Code                string        `gorm:"column:code; primary_key"`
-	ProductType         ProductType   `gorm:"product_type"`
-	Name                string        `gorm:"column:name"`
-	Status              int           `gorm:"column:status"`          // 1:enabled , 2:disabled
-	Display             int           `gorm:"column:display"`         // 1:enabled , 2:disabled
-	CountryCode         string        `gorm:"column:country_code"`    //
-	TimezoneOffset      float32       `gorm:"column:timezone_offset"` //
-	OpenTime            sql.NullTime  `gorm:"column:open_time"`       //
-	CloseTime           sql.NullTime  `gorm:"column:close_time"`      //
-	ExchangeDay         string        `gorm:"column:exchange_day"`    // 星期幾
-	ExceptionTime       string        `gorm:"column:exception_time"`
-	DaylightSaving      bool          `gorm:"column:daylight_saving"`
-	Location            string        `gorm:"column:location"`
-	CreatedAt           time.Time     `gorm:"column:created_at"`
-	UpdatedAt           time.Time     `gorm:"column:updated_at"`
-	ExchangeDayParsed   ExchangeDay   `gorm:"-"`
-	ExceptionTimeParsed ExceptionTime `gorm:"-"`
+	ID                  uint64          `gorm:"column:id"`
+	Code                string          `gorm:"column:code; primary_key"`
+	ProductType         ProductType     `gorm:"product_type"`
+	Name                string          `gorm:"column:name"`
+	Status              int             `gorm:"column:status"`          // 1:enabled , 2:disabled
+	Display             int             `gorm:"column:display"`         // 1:enabled , 2:disabled
+	CountryCode         string          `gorm:"column:country_code"`    //
+	TimezoneOffset      float32         `gorm:"column:timezone_offset"` //
+	PreOpenTime         sql.NullTime    `gorm:"column:pre_open_time"`
+	OpenTime            sql.NullTime    `gorm:"column:open_time"` //
+	BreakStartTime      sql.NullTime    `gorm:"column:break_start_time"`
+	BreakEndTime        sql.NullTime    `gorm:"column:break_end_time"`
+	CloseTime           sql.NullTime    `gorm:"column:close_time"`   //
+	ExchangeDay         string          `gorm:"column:exchange_day"` // 星期幾
+	ExceptionTime       string          `gorm:"column:exception_time"`
+	DaylightSaving      bool            `gorm:"column:daylight_saving"`
+	Location            string          `gorm:"column:location"`
+	CurrencyCode        sql.NullString  `gorm:"column:currency_code"`
+	TickLadder          sql.NullString  `gorm:"column:tick_ladder"` // json of []TickStep
+	LotSize             sql.NullFloat64 `gorm:"column:lot_size"`
+	MinimumOrder        sql.NullFloat64 `gorm:"column:minimum_order"`
+	PriceLimitRule      sql.NullString  `gorm:"column:price_limit_rule"` // json of PriceLimitRule
+	Revision            uint64          `gorm:"column:revision"`         // catalog revision of the last write
+	CreatedAt           time.Time       `gorm:"column:created_at"`
+	UpdatedAt           time.Time       `gorm:"column:updated_at"`
+	ExchangeDayParsed   ExchangeDay     `gorm:"-"`
+	ExceptionTimeParsed ExceptionTime   `gorm:"-"`
 }
 
 type ExchangeDay struct {
@@ -39,3 +49,22 @@ type ExceptionTimeFormat struct {
 	Start time.Time `json:"start"` // 僅使用年以下之資料 ex:幾月幾日幾點
 	End   time.Time `json:"end"`   // 僅使用年以下之資料 ex:幾月幾日幾點
 }
+
+type PriceLimitType string
+
+const (
+	PriceLimitType_None     PriceLimitType = "none"
+	PriceLimitType_Percent  PriceLimitType = "percent"
+	PriceLimitType_Absolute PriceLimitType = "absolute"
+)
+
+// TickStep applies Tick to the prices from From up to the From of the next step
+type TickStep struct {
+	From float64 `json:"from"`
+	Tick float64 `json:"tick"`
+}
+
+type PriceLimitRule struct {
+	Type  PriceLimitType `json:"type"`
+	Value float64        `json:"value"` // percent of the reference price, or a price difference
+}
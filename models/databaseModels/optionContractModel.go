@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+type OptionRight int
+
+const (
+	OptionRight_None OptionRight = iota
+	OptionRight_Call
+	OptionRight_Put
+)
+
+type OptionContractModel struct {
+	ProductID    uint64      `gorm:"column:product_id; primary_key"`
+	UnderlyingID uint64      `gorm:"column:underlying_id"`
+	ExpiryDate   time.Time   `gorm:"column:expiry_date"`
+	StrikePrice  float64     `gorm:"column:strike_price"`
+	OptionRight  OptionRight `gorm:"column:option_right"` // 1:call , 2:put
+	Multiplier   float64     `gorm:"column:multiplier"`
+	CreatedAt    time.Time   `gorm:"column:created_at"`
+	UpdatedAt    time.Time   `gorm:"column:updated_at"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import (
+	"time"
+)
+
+type ProductAliasModel struct {
+	ID        uint64    `gorm:"column:id; primary_key"`
+	ProductID uint64    `gorm:"column:product_id"`
+	Alias     string    `gorm:"column:alias"`
+	CreatedAt time.Time `gorm:"column:created_at"`
+}
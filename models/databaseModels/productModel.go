@@ -13,20 +13,42 @@ const (
 	ProductType_Crypto
 	ProductType_Forex
 	ProductType_Futures
+	ProductType_Option
 )
 
 type ProductModel struct {
-	ID           uint64          `gorm:"column:id; primary_key"`
-	Type         ProductType     `gorm:"column:type"`
-	ExchangeCode string          `gorm:"column:exchange_code"`
-	Code         string          `gorm:"column:code"`
-	Name         string          `gorm:"column:name"`
-	Status       int             `gorm:"column:status"`  // 1:enabled , 2:disabled
-	Display      int             `gorm:"column:display"` // 1:enabled , 2:disabled
-	CurrencyCode string          `gorm:"column:currency_code"`
-	TickUnit     float64         `gorm:"column:tick_unit"`
-	MinimumOrder sql.NullFloat64 `gorm:"column:minimum_order"`
-	IconID       sql.NullString  `gorm:"column:icon_id"`
-	CreatedAt    time.Time       `gorm:"column:created_at"`
-	UpdatedAt    time.Time       `gorm:"column:updated_at"`
+	ID             uint64          `gorm:"column:id; primary_key"`
+	Type           ProductType     `gorm:"column:type"`
+	ExchangeID     uint64          `gorm:"column:exchange_id"`
+	ExchangeCode   string          `gorm:"column:exchange_code"`
+	Code           string          `gorm:"column:code"`
+	Name           string          `gorm:"column:name"`
+	Status         int             `gorm:"column:status"`           // 1:enabled , 2:disabled
+	Display        int             `gorm:"column:display"`          // 1:enabled , 2:disabled
+	Priority       int             `gorm:"column:priority"`         // custom sort order
+	CurrencyCode   sql.NullString  `gorm:"column:currency_code"`    // NULL inherits the exchange default
+	TickUnit       sql.NullFloat64 `gorm:"column:tick_unit"`        // NULL inherits the exchange default
+	LotSize        sql.NullFloat64 `gorm:"column:lot_size"`         // NULL inherits the exchange default
+	MinimumOrder   sql.NullFloat64 `gorm:"column:minimum_order"`    // NULL inherits the exchange default
+	PriceLimitRule sql.NullString  `gorm:"column:price_limit_rule"` // json of PriceLimitRule, NULL inherits the exchange default
+	IconID         sql.NullString  `gorm:"column:icon_id"`
+	ISIN           sql.NullString  `gorm:"column:isin"`
+	CUSIP          sql.NullString  `gorm:"column:cusip"`
+	SEDOL          sql.NullString  `gorm:"column:sedol"`
+	FIGI           sql.NullString  `gorm:"column:figi"`
+	TaxonomyID     sql.NullInt64   `gorm:"column:taxonomy_id"`
+	ListedAt       sql.NullTime    `gorm:"column:listed_at"`
+	DelistedAt     sql.NullTime    `gorm:"column:delisted_at"`
+	Revision       uint64          `gorm:"column:revision"`   // catalog revision of the last write
+	DeletedAt      sql.NullTime    `gorm:"column:deleted_at"` // a deleted product is kept as a tombstone
+	CreatedAt      time.Time       `gorm:"column:created_at"`
+	UpdatedAt      time.Time       `gorm:"column:updated_at"`
+}
+
+// ProductRevisionModel is the revision a product last changed at, by a write
+// to it or to its exchange.
+type ProductRevisionModel struct {
+	ID        uint64       `gorm:"column:id"`
+	Revision  uint64       `gorm:"column:revision"`
+	DeletedAt sql.NullTime `gorm:"column:deleted_at"`
 }
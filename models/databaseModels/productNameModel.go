@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+)
+
+type ProductNameModel struct {
+	ID        uint64    `gorm:"column:id; primary_key"`
+	ProductID uint64    `gorm:"column:product_id"`
+	Locale    string    `gorm:"column:locale"`
+	ShortName string    `gorm:"column:short_name"`
+	LongName  string    `gorm:"column:long_name"`
+	CreatedAt time.Time `gorm:"column:created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+type ProductPhoneticModel struct {
+	ID             uint64    `gorm:"column:id; primary_key"`
+	ProductID      uint64    `gorm:"column:product_id"`
+	Source         string    `gorm:"column:source"`
+	Pinyin         string    `gorm:"column:pinyin"`
+	PinyinInitials string    `gorm:"column:pinyin_initials"`
+	Zhuyin         string    `gorm:"column:zhuyin"`
+	ZhuyinInitials string    `gorm:"column:zhuyin_initials"`
+	CreatedAt      time.Time `gorm:"column:created_at"`
+}
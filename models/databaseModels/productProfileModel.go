@@ -0,0 +1,26 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+type ProductProfileModel struct {
+	ProductID              uint64        `gorm:"column:product_id; primary_key"`
+	Website                string        `gorm:"column:website"`
+	ListingDate            sql.NullTime  `gorm:"column:listing_date"`
+	SharesOutstanding      sql.NullInt64 `gorm:"column:shares_outstanding"`
+	CountryOfIncorporation string        `gorm:"column:country_of_incorporation"`
+	MarketSegment          string        `gorm:"column:market_segment"`
+	CreatedAt              time.Time     `gorm:"column:created_at"`
+	UpdatedAt              time.Time     `gorm:"column:updated_at"`
+}
+
+type ProductProfileDescriptionModel struct {
+	ID          uint64    `gorm:"column:id; primary_key"`
+	ProductID   uint64    `gorm:"column:product_id"`
+	Locale      string    `gorm:"column:locale"`
+	Description string    `gorm:"column:description"`
+	CreatedAt   time.Time `gorm:"column:created_at"`
+	UpdatedAt   time.Time `gorm:"column:updated_at"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// RelationType reads as "product is <type> related product", e.g. 2330 is
+// constituent of 0050.
+type RelationType int
+
+const (
+	RelationType_None RelationType = iota
+	RelationType_ConstituentOf
+	RelationType_UnderlyingOf
+	RelationType_ADROf
+	RelationType_DualListedWith
+)
+
+type ProductRelationModel struct {
+	ID               uint64          `gorm:"column:id; primary_key"`
+	ProductID        uint64          `gorm:"column:product_id"`
+	RelatedProductID uint64          `gorm:"column:related_product_id"`
+	RelationType     RelationType    `gorm:"column:relation_type"`
+	Weight           sql.NullFloat64 `gorm:"column:weight"`
+	EffectiveDate    time.Time       `gorm:"column:effective_date"`
+	CreatedAt        time.Time       `gorm:"column:created_at"`
+	UpdatedAt        time.Time       `gorm:"column:updated_at"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+type ProductStatusAuditModel struct {
+	ID           uint64        `gorm:"column:id; primary_key"`
+	ExchangeCode string        `gorm:"column:exchange_code"`
+	ProductType  ProductType   `gorm:"column:product_type"`
+	Status       sql.NullInt32 `gorm:"column:status"`
+	Display      sql.NullInt32 `gorm:"column:display"`
+	Affected     int64         `gorm:"column:affected"`
+	Operator     string        `gorm:"column:operator"`
+	Reason       string        `gorm:"column:reason"`
+	CreatedAt    time.Time     `gorm:"column:created_at"`
+}
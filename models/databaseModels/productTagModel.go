@@ -0,0 +1,12 @@
+package models
+
+import (
+	"time"
+)
+
+type ProductTagModel struct {
+	ID        uint64    `gorm:"column:id; primary_key"`
+	ProductID uint64    `gorm:"column:product_id"`
+	Tag       string    `gorm:"column:tag"`
+	CreatedAt time.Time `gorm:"column:created_at"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+type Vendor string
+
+const (
+	Vendor_Yahoo       Vendor = "yahoo"
+	Vendor_Binance     Vendor = "binance"
+	Vendor_TradingView Vendor = "tradingview"
+)
+
+type ProductVendorSymbolModel struct {
+	ID        uint64    `gorm:"column:id; primary_key"`
+	ProductID uint64    `gorm:"column:product_id"`
+	Vendor    Vendor    `gorm:"column:vendor"`
+	Symbol    string    `gorm:"column:symbol"`
+	CreatedAt time.Time `gorm:"column:created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at"`
+}
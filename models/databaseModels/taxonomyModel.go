@@ -0,0 +1,26 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+type TaxonomyLevel int
+
+const (
+	TaxonomyLevel_None TaxonomyLevel = iota
+	TaxonomyLevel_Sector
+	TaxonomyLevel_IndustryGroup
+	TaxonomyLevel_Industry
+	TaxonomyLevel_SubIndustry
+)
+
+type TaxonomyModel struct {
+	ID        uint64        `gorm:"column:id; primary_key"`
+	ParentID  sql.NullInt64 `gorm:"column:parent_id"`
+	Level     TaxonomyLevel `gorm:"column:level"`
+	Code      string        `gorm:"column:code"`
+	Name      string        `gorm:"column:name"`
+	CreatedAt time.Time     `gorm:"column:created_at"`
+	UpdatedAt time.Time     `gorm:"column:updated_at"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+type WebhookSubscriptionModel struct {
+	ID          uint64    `gorm:"column:id; primary_key"`
+	URL         string    `gorm:"column:url"`
+	Secret      string    `gorm:"column:secret"`
+	EventTypes  string    `gorm:"column:event_types"` // json of []string, "product.*" matches every product event
+	Status      int       `gorm:"column:status"`      // 1:enabled , 2:disabled
+	Description string    `gorm:"column:description"`
+	CreatedAt   time.Time `gorm:"column:created_at"`
+	UpdatedAt   time.Time `gorm:"column:updated_at"`
+}
+
+type WebhookDeliveryStatus int
+
+const (
+	WebhookDeliveryStatus_Pending   WebhookDeliveryStatus = 1
+	WebhookDeliveryStatus_Succeeded WebhookDeliveryStatus = 2
+	WebhookDeliveryStatus_Failed    WebhookDeliveryStatus = 3
+)
+
+type WebhookDeliveryModel struct {
+	ID             uint64                `gorm:"column:id; primary_key"`
+	SubscriptionID uint64                `gorm:"column:subscription_id"`
+	EventID        uint64                `gorm:"column:event_id"`
+	EventType      EventType             `gorm:"column:event_type"`
+	Body           string                `gorm:"column:body"` // json
+	Status         WebhookDeliveryStatus `gorm:"column:status"`
+	Attempts       int                   `gorm:"column:attempts"`
+	NextAttemptAt  time.Time             `gorm:"column:next_attempt_at"`
+	ResponseCode   sql.NullInt32         `gorm:"column:response_code"`
+	LastError      sql.NullString        `gorm:"column:last_error"`
+	CreatedAt      time.Time             `gorm:"column:created_at"`
+	DeliveredAt    sql.NullTime          `gorm:"column:delivered_at"`
+}
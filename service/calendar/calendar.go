@@ -0,0 +1,260 @@
+// Package calendar works out the trading phases of an exchange from its
+// trading days, its daily session times and its holidays.
+//
+// The session times are the wall clock of the open_time, close_time, ... columns
+// in the location of the exchange, a session has to end on the day it starts.
+// exception_time is not taken into account yet.
+package calendar
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+)
+
+const dateLayout = "2006-01-02"
+
+// lookBack is how far back the phase a time falls in is searched for, it
+// covers the longest run of days without a transition.
+const lookBack = 7
+
+type Phase int
+
+const (
+	Phase_PreOpen          Phase = 1
+	Phase_Open             Phase = 2
+	Phase_Break            Phase = 3
+	Phase_Closed           Phase = 4
+	Phase_Holiday          Phase = 5
+	Phase_EmergencyClosure Phase = 6
+)
+
+// Transition is the start of a phase.
+type Transition struct {
+	Phase Phase
+	At    time.Time
+	// Date is the local trading date the transition belongs to.
+	Date string
+	// Session counts the sessions of the day from 1, it is the session a
+	// pre-open, open, break or close belongs to and 0 otherwise.
+	Session int
+	// Holiday is the name of the holiday, for Holiday and for the close of
+	// a half day.
+	Holiday string
+}
+
+type holiday struct {
+	from, to string // dates, inclusive
+	name     string
+	halfDay  bool
+	closeAt  *clock
+}
+
+type clock struct {
+	hour, minute, second int
+}
+
+func (c clock) before(o clock) bool {
+	return c.seconds() < o.seconds()
+}
+
+func (c clock) seconds() int {
+	return c.hour*3600 + c.minute*60 + c.second
+}
+
+// Calendar is built for one exchange and is not modified afterwards.
+type Calendar struct {
+	location *time.Location
+	disabled bool
+	days     [7]bool
+	// open and close are nil for a market trading around the clock
+	preOpen, open, breakStart, breakEnd, close *clock
+	holidays                                   []holiday
+}
+
+// New builds the calendar of the exchange. holidays are the holidays of the
+// exchange, the ones of other exchanges are ignored.
+func New(e *models.ExchangeModel, holidays []models.ExchangeHolidayModel) (*Calendar, error) {
+	c := &Calendar{
+		location: location(e),
+		disabled: e.Status == 2,
+	}
+
+	day := models.ExchangeDay{}
+	if err := json.Unmarshal([]byte(e.ExchangeDay), &day); err != nil {
+		return nil, fmt.Errorf("exchange %s: exchange day: %w", e.Code, err)
+	}
+	if day.StartDay < 0 || day.StartDay > 6 || day.EndDay < 0 || day.EndDay > 6 {
+		return nil, fmt.Errorf("exchange %s: exchange day out of range: %s", e.Code, e.ExchangeDay)
+	}
+	for d := day.StartDay; ; d = (d + 1) % 7 {
+		c.days[d] = true
+		if d == day.EndDay {
+			break
+		}
+	}
+
+	c.open, c.close = clockOf(e.OpenTime), clockOf(e.CloseTime)
+	if c.open == nil || c.close == nil {
+		c.open, c.close = nil, nil
+	} else {
+		if !c.open.before(*c.close) {
+			return nil, fmt.Errorf("exchange %s: close time is not after open time", e.Code)
+		}
+		if p := clockOf(e.PreOpenTime); p != nil && p.before(*c.open) {
+			c.preOpen = p
+		}
+		bs, be := clockOf(e.BreakStartTime), clockOf(e.BreakEndTime)
+		if bs != nil && be != nil && c.open.before(*bs) && bs.before(*be) && be.before(*c.close) {
+			c.breakStart, c.breakEnd = bs, be
+		}
+	}
+
+	for _, h := range holidays {
+		if h.ExchangeID != e.ID || h.Type == models.ExchangeHolidayType_None {
+			continue
+		}
+		to := h.Date
+		if h.EndDate.Valid {
+			to = h.EndDate.Time
+		}
+		c.holidays = append(c.holidays, holiday{
+			from:    h.Date.Format(dateLayout),
+			to:      to.Format(dateLayout),
+			name:    h.Name,
+			halfDay: h.Type == models.ExchangeHolidayType_HalfDay,
+			closeAt: clockOf(h.HalfDayCloseTime),
+		})
+	}
+
+	return c, nil
+}
+
+// Location is the time zone the trading dates are in
+func (c *Calendar) Location() *time.Location {
+	return c.location
+}
+
+// PhaseAt returns the transition that started the phase t falls in. A
+// disabled exchange is in an emergency closure.
+func (c *Calendar) PhaseAt(t time.Time) Transition {
+	if c.disabled {
+		return Transition{Phase: Phase_EmergencyClosure, At: t, Date: t.In(c.location).Format(dateLayout)}
+	}
+
+	transitions := c.between(t.AddDate(0, 0, -lookBack), t)
+	i := sort.Search(len(transitions), func(i int) bool {
+		return transitions[i].At.After(t)
+	})
+	return transitions[i-1]
+}
+
+// Transitions returns the transitions after from up to and including to, in
+// order. A disabled exchange has none.
+func (c *Calendar) Transitions(from, to time.Time) []Transition {
+	if c.disabled {
+		return []Transition{}
+	}
+
+	transitions := c.between(from.AddDate(0, 0, -lookBack), to)
+	result := []Transition{}
+	for _, t := range transitions {
+		if t.At.After(from) && !t.At.After(to) {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+// between returns the transitions of the days from the one of from to the
+// one of to, without the ones that do not change the phase.
+func (c *Calendar) between(from, to time.Time) []Transition {
+	from, to = from.In(c.location), to.In(c.location)
+	last := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, c.location)
+
+	result := []Transition{}
+	for date := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, c.location); !date.After(last); date = date.AddDate(0, 0, 1) {
+		for _, t := range c.day(date) {
+			if n := len(result); n > 0 && result[n-1].Phase == t.Phase {
+				continue
+			}
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+// day returns the transitions of the local date, starting at midnight
+func (c *Calendar) day(date time.Time) []Transition {
+	key := date.Format(dateLayout)
+	h := c.holiday(key)
+
+	switch {
+	case h != nil && !h.halfDay:
+		return []Transition{{Phase: Phase_Holiday, At: date, Date: key, Holiday: h.name}}
+	case !c.days[date.Weekday()]:
+		return []Transition{{Phase: Phase_Closed, At: date, Date: key}}
+	case c.open == nil:
+		return []Transition{{Phase: Phase_Open, At: date, Date: key, Session: 1}}
+	}
+
+	closeAt, holidayName := *c.close, ""
+	if h != nil {
+		holidayName = h.name
+		if h.closeAt != nil && c.open.before(*h.closeAt) && h.closeAt.before(closeAt) {
+			closeAt = *h.closeAt
+		}
+	}
+
+	at := func(t clock) time.Time {
+		return time.Date(date.Year(), date.Month(), date.Day(), t.hour, t.minute, t.second, 0, c.location)
+	}
+
+	result := []Transition{{Phase: Phase_Closed, At: date, Date: key}}
+	if c.preOpen != nil {
+		result = append(result, Transition{Phase: Phase_PreOpen, At: at(*c.preOpen), Date: key, Session: 1})
+	}
+	result = append(result, Transition{Phase: Phase_Open, At: at(*c.open), Date: key, Session: 1})
+	session := 1
+	if c.breakStart != nil && c.breakEnd.before(closeAt) {
+		result = append(result,
+			Transition{Phase: Phase_Break, At: at(*c.breakStart), Date: key, Session: 1},
+			Transition{Phase: Phase_Open, At: at(*c.breakEnd), Date: key, Session: 2},
+		)
+		session = 2
+	} else if c.breakStart != nil && c.breakStart.before(closeAt) {
+		// a half day closing during the break ends at the break
+		closeAt = *c.breakStart
+	}
+	return append(result, Transition{Phase: Phase_Closed, At: at(closeAt), Date: key, Session: session, Holiday: holidayName})
+}
+
+func (c *Calendar) holiday(date string) *holiday {
+	for i := range c.holidays {
+		if c.holidays[i].from <= date && date <= c.holidays[i].to {
+			return &c.holidays[i]
+		}
+	}
+	return nil
+}
+
+// location falls back to the fixed offset of the exchange when its location
+// is not a known time zone.
+func location(e *models.ExchangeModel) *time.Location {
+	if l, err := time.LoadLocation(e.Location); err == nil && e.Location != "" {
+		return l
+	}
+	return time.FixedZone(e.Code, int(e.TimezoneOffset*3600))
+}
+
+func clockOf(t sql.NullTime) *clock {
+	if !t.Valid {
+		return nil
+	}
+	hour, minute, second := t.Time.Clock()
+	return &clock{hour, minute, second}
+}
@@ -0,0 +1,168 @@
+package calendar
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+)
+
+// the test exchange is at UTC+9 and trades Monday to Friday, 2023-03-06 is a
+// Monday
+var zone = time.FixedZone("TEST", 9*3600)
+
+func at(day, hour, minute int) time.Time {
+	return time.Date(2023, 3, day, hour, minute, 0, 0, zone)
+}
+
+func clockTime(hour, minute int) sql.NullTime {
+	return sql.NullTime{Time: time.Date(2000, 1, 1, hour, minute, 0, 0, time.UTC), Valid: true}
+}
+
+func testExchange() *models.ExchangeModel {
+	return &models.ExchangeModel{
+		ID:             1,
+		Code:           "TEST",
+		Status:         1,
+		TimezoneOffset: 9,
+		ExchangeDay:    `{"startDay":1,"endDay":5}`,
+		PreOpenTime:    clockTime(8, 30),
+		OpenTime:       clockTime(9, 0),
+		BreakStartTime: clockTime(11, 30),
+		BreakEndTime:   clockTime(12, 30),
+		CloseTime:      clockTime(15, 0),
+	}
+}
+
+func testHolidays() []models.ExchangeHolidayModel {
+	return []models.ExchangeHolidayModel{
+		{
+			ExchangeID:       1,
+			Name:             "half day",
+			Date:             at(8, 0, 0),
+			Type:             models.ExchangeHolidayType_HalfDay,
+			HalfDayCloseTime: clockTime(12, 0),
+		},
+		{
+			ExchangeID: 1,
+			Name:       "long weekend",
+			Date:       at(9, 0, 0),
+			EndDate:    sql.NullTime{Time: at(10, 0, 0), Valid: true},
+			Type:       models.ExchangeHolidayType_FullDay,
+		},
+		// another exchange
+		{ExchangeID: 2, Name: "other", Date: at(13, 0, 0), Type: models.ExchangeHolidayType_FullDay},
+	}
+}
+
+func newCalendar(t *testing.T, e *models.ExchangeModel, holidays []models.ExchangeHolidayModel) *Calendar {
+	c, err := New(e, holidays)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestPhaseAt(t *testing.T) {
+	cal := newCalendar(t, testExchange(), testHolidays())
+
+	cases := map[string]struct {
+		t    time.Time
+		want Transition
+	}{
+		// the close of friday lasts over the weekend
+		"before pre-open": {at(6, 8, 0), Transition{Phase: Phase_Closed, At: at(3, 15, 0), Date: "2023-03-03", Session: 2}},
+		"pre-open":        {at(6, 8, 45), Transition{Phase: Phase_PreOpen, At: at(6, 8, 30), Date: "2023-03-06", Session: 1}},
+		"morning session": {at(6, 10, 0), Transition{Phase: Phase_Open, At: at(6, 9, 0), Date: "2023-03-06", Session: 1}},
+		"break":           {at(6, 12, 0), Transition{Phase: Phase_Break, At: at(6, 11, 30), Date: "2023-03-06", Session: 1}},
+		"afternoon":       {at(6, 13, 0), Transition{Phase: Phase_Open, At: at(6, 12, 30), Date: "2023-03-06", Session: 2}},
+		"overnight":       {at(7, 8, 0), Transition{Phase: Phase_Closed, At: at(6, 15, 0), Date: "2023-03-06", Session: 2}},
+		// the half day closes at 12:00, during the break, so it ends at the break
+		"half day open":  {at(8, 11, 0), Transition{Phase: Phase_Open, At: at(8, 9, 0), Date: "2023-03-08", Session: 1}},
+		"half day close": {at(8, 12, 15), Transition{Phase: Phase_Closed, At: at(8, 11, 30), Date: "2023-03-08", Session: 1, Holiday: "half day"}},
+		// the holiday spans two days and starts once
+		"holiday":          {at(9, 10, 0), Transition{Phase: Phase_Holiday, At: at(9, 0, 0), Date: "2023-03-09", Holiday: "long weekend"}},
+		"holiday last day": {at(10, 10, 0), Transition{Phase: Phase_Holiday, At: at(9, 0, 0), Date: "2023-03-09", Holiday: "long weekend"}},
+		"weekend":          {at(12, 10, 0), Transition{Phase: Phase_Closed, At: at(11, 0, 0), Date: "2023-03-11"}},
+		// the holiday of another exchange is ignored
+		"other exchange": {at(13, 10, 0), Transition{Phase: Phase_Open, At: at(13, 9, 0), Date: "2023-03-13", Session: 1}},
+	}
+	for name, c := range cases {
+		if got := cal.PhaseAt(c.t); !equal(got, c.want) {
+			t.Errorf("%s: got %+v, want %+v", name, got, c.want)
+		}
+	}
+}
+
+func TestTransitions(t *testing.T) {
+	cal := newCalendar(t, testExchange(), testHolidays())
+
+	want := []Transition{
+		{Phase: Phase_PreOpen, At: at(8, 8, 30), Date: "2023-03-08", Session: 1},
+		{Phase: Phase_Open, At: at(8, 9, 0), Date: "2023-03-08", Session: 1},
+		{Phase: Phase_Closed, At: at(8, 11, 30), Date: "2023-03-08", Session: 1, Holiday: "half day"},
+		{Phase: Phase_Holiday, At: at(9, 0, 0), Date: "2023-03-09", Holiday: "long weekend"},
+		{Phase: Phase_Closed, At: at(11, 0, 0), Date: "2023-03-11"},
+		{Phase: Phase_PreOpen, At: at(13, 8, 30), Date: "2023-03-13", Session: 1},
+		// to is included
+		{Phase: Phase_Open, At: at(13, 9, 0), Date: "2023-03-13", Session: 1},
+	}
+	checkTransitions(t, cal.Transitions(at(8, 0, 0), at(13, 9, 0)), want)
+}
+
+func TestAroundTheClock(t *testing.T) {
+	e := testExchange()
+	e.PreOpenTime, e.OpenTime, e.BreakStartTime, e.BreakEndTime, e.CloseTime = sql.NullTime{}, sql.NullTime{}, sql.NullTime{}, sql.NullTime{}, sql.NullTime{}
+	cal := newCalendar(t, e, nil)
+
+	cases := map[string]struct {
+		t    time.Time
+		want Transition
+	}{
+		"monday":   {at(6, 3, 0), Transition{Phase: Phase_Open, At: at(6, 0, 0), Date: "2023-03-06", Session: 1}},
+		"friday":   {at(10, 23, 0), Transition{Phase: Phase_Open, At: at(6, 0, 0), Date: "2023-03-06", Session: 1}},
+		"saturday": {at(11, 12, 0), Transition{Phase: Phase_Closed, At: at(11, 0, 0), Date: "2023-03-11"}},
+	}
+	for name, c := range cases {
+		if got := cal.PhaseAt(c.t); !equal(got, c.want) {
+			t.Errorf("%s: got %+v, want %+v", name, got, c.want)
+		}
+	}
+
+	checkTransitions(t, cal.Transitions(at(6, 0, 0), at(13, 0, 0)), []Transition{
+		{Phase: Phase_Closed, At: at(11, 0, 0), Date: "2023-03-11"},
+		{Phase: Phase_Open, At: at(13, 0, 0), Date: "2023-03-13", Session: 1},
+	})
+}
+
+func TestDisabled(t *testing.T) {
+	e := testExchange()
+	e.Status = 2
+	cal := newCalendar(t, e, testHolidays())
+
+	now := at(6, 10, 0)
+	want := Transition{Phase: Phase_EmergencyClosure, At: now, Date: "2023-03-06"}
+	if got := cal.PhaseAt(now); !equal(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if got := cal.Transitions(at(6, 0, 0), at(13, 0, 0)); len(got) != 0 {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func equal(a, b Transition) bool {
+	return a.Phase == b.Phase && a.At.Equal(b.At) && a.Date == b.Date && a.Session == b.Session && a.Holiday == b.Holiday
+}
+
+func checkTransitions(t *testing.T, got, want []Transition) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if !equal(got[i], want[i]) {
+			t.Errorf("transition %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
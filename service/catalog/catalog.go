@@ -0,0 +1,365 @@
+// Package catalog keeps an immutable in-memory snapshot of every product and
+// exchange. A write bumps the catalog version in Redis and publishes it, every
+// replica then loads a new snapshot and swaps it in atomically, readers keep
+// using the snapshot they already hold. The loads are debounced, a burst of
+// writes costs one load per reloadDelay rather than one per write.
+package catalog
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/paper-trade-chatbot/be-common/cache"
+	"github.com/paper-trade-chatbot/be-common/database"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"github.com/paper-trade-chatbot/be-product/dao/exchangeDao"
+	"github.com/paper-trade-chatbot/be-product/dao/productDao"
+	"github.com/paper-trade-chatbot/be-product/dao/productNameDao"
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+)
+
+const (
+	versionKey     = "be-product:catalog:version"
+	versionChannel = "be-product:catalog:version"
+
+	// pollInterval catches the bumps whose message got lost, e.g. while the
+	// subscription was reconnecting.
+	pollInterval = 30 * time.Second
+	// reloadDelay is how long a load waits for more bumps to batch with.
+	reloadDelay = 200 * time.Millisecond
+)
+
+type codeKey struct {
+	exchangeCode string
+	code         string
+}
+
+// Snapshot is never modified once loaded, its getters return copies.
+type Snapshot struct {
+	Version  int64
+	LoadedAt time.Time
+
+	products       map[uint64]*models.ProductModel
+	productsByCode map[codeKey]*models.ProductModel
+	exchanges      map[string]*models.ExchangeModel
+	// names are the localized names of the products, every write to them
+	// touches the product and so bumps the version
+	names map[uint64][]models.ProductNameModel
+
+	// bumps is the number of local bumps the snapshot includes
+	bumps uint64
+}
+
+func (s *Snapshot) Product(id uint64) (*models.ProductModel, bool) {
+	p, ok := s.products[id]
+	if !ok {
+		return nil, false
+	}
+	result := *p
+	return &result, true
+}
+
+func (s *Snapshot) ProductByCode(exchangeCode, code string) (*models.ProductModel, bool) {
+	p, ok := s.productsByCode[codeKey{exchangeCode, code}]
+	if !ok {
+		return nil, false
+	}
+	result := *p
+	return &result, true
+}
+
+func (s *Snapshot) Exchange(code string) (*models.ExchangeModel, bool) {
+	e, ok := s.exchanges[code]
+	if !ok {
+		return nil, false
+	}
+	result := *e
+	return &result, true
+}
+
+// Names returns the localized names of the product, ok is false when the
+// snapshot does not have the product.
+func (s *Snapshot) Names(productID uint64) ([]models.ProductNameModel, bool) {
+	if _, ok := s.products[productID]; !ok {
+		return nil, false
+	}
+	return append([]models.ProductNameModel{}, s.names[productID]...), true
+}
+
+// Exchanges returns every exchange ordered by code
+func (s *Snapshot) Exchanges() []models.ExchangeModel {
+	result := make([]models.ExchangeModel, 0, len(s.exchanges))
+	for _, e := range s.exchanges {
+		result = append(result, *e)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Code < result[j].Code
+	})
+	return result
+}
+
+// Products returns every product ordered by id
+func (s *Snapshot) Products() []models.ProductModel {
+	result := make([]models.ProductModel, 0, len(s.products))
+	for _, p := range s.products {
+		result = append(result, *p)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// ChangedProducts compares the product revisions with previous, changed has
+// the products created or written since, removed those gone.
+func (s *Snapshot) ChangedProducts(previous *Snapshot) (changed []uint64, removed []uint64) {
+	for id, p := range s.products {
+		if old, ok := previous.products[id]; !ok || old.Revision != p.Revision {
+			changed = append(changed, id)
+		}
+	}
+	for id := range previous.products {
+		if _, ok := s.products[id]; !ok {
+			removed = append(removed, id)
+		}
+	}
+	return changed, removed
+}
+
+type Catalog struct {
+	// bumps counts the writes made on this replica, a snapshot loaded before
+	// the last of them is stale for the reads that must see it. First for the
+	// 64-bit alignment atomic needs.
+	bumps   uint64
+	current atomic.Value // *Snapshot
+	// loadMutex makes the loads run one at a time, so that an older load
+	// cannot swap in after a newer one.
+	loadMutex sync.Mutex
+	listeners []func(previous, current *Snapshot)
+
+	changedMutex sync.Mutex
+	changed      chan struct{}
+
+	reload chan struct{}
+}
+
+func New() *Catalog {
+	return &Catalog{
+		changed: make(chan struct{}),
+		reload:  make(chan struct{}, 1),
+	}
+}
+
+// OnSwap registers a listener called after every swap, one swap at a time and
+// in order. previous is nil on the first load. It must be registered before
+// the catalog is shared.
+func (c *Catalog) OnSwap(listener func(previous, current *Snapshot)) {
+	c.listeners = append(c.listeners, listener)
+}
+
+// Changed returns a channel closed by the next swap
+func (c *Catalog) Changed() <-chan struct{} {
+	c.changedMutex.Lock()
+	defer c.changedMutex.Unlock()
+	return c.changed
+}
+
+// Snapshot returns the current snapshot, nil until the first load succeeded.
+func (c *Catalog) Snapshot() *Snapshot {
+	s, _ := c.current.Load().(*Snapshot)
+	return s
+}
+
+// Fresh is Snapshot, but nil while the snapshot misses a write bumped on this
+// replica, so that a read after a write sees it.
+func (c *Catalog) Fresh() *Snapshot {
+	s := c.Snapshot()
+	if s == nil || s.bumps != atomic.LoadUint64(&c.bumps) {
+		return nil
+	}
+	return s
+}
+
+// Load reads the whole catalog and swaps it in. The version is read before
+// the rows, so a bump racing with the load makes the next sync load again.
+func (c *Catalog) Load(ctx context.Context) error {
+	c.loadMutex.Lock()
+	defer c.loadMutex.Unlock()
+
+	previous := c.Snapshot()
+
+	// read before the rows like the version, a bump in between leaves the
+	// snapshot stale until the next load
+	bumps := atomic.LoadUint64(&c.bumps)
+	version, err := remoteVersion(ctx)
+	if err != nil {
+		logging.Error(ctx, "[catalog] read version err: %v", err)
+	}
+	// without Redis the version stays where it is rather than going back to 0
+	if previous != nil && version < previous.Version {
+		version = previous.Version
+	}
+
+	snapshot, err := load(version)
+	if err != nil {
+		return err
+	}
+	snapshot.bumps = bumps
+	c.current.Store(snapshot)
+
+	for _, listener := range c.listeners {
+		listener(previous, snapshot)
+	}
+	c.changedMutex.Lock()
+	close(c.changed)
+	c.changed = make(chan struct{})
+	c.changedMutex.Unlock()
+
+	logging.Info(ctx, "[catalog] version %d loaded, %d products, %d exchanges", version, len(snapshot.products), len(snapshot.exchanges))
+	return nil
+}
+
+// Bump publishes a new catalog version after a committed write and schedules
+// a load of this replica. Until it is done Fresh returns nil, the reads then
+// go to the database.
+func (c *Catalog) Bump(ctx context.Context) {
+	atomic.AddUint64(&c.bumps, 1)
+	c.scheduleLoad()
+
+	r, err := cache.GetRedis()
+	if err == nil {
+		var version int64
+		version, err = r.Incr(ctx, versionKey).Result()
+		if err == nil {
+			err = r.Publish(ctx, versionChannel, version).Err()
+		}
+	}
+	if err != nil {
+		// the other replicas catch up when the next bump goes through
+		logging.Error(ctx, "[catalog] bump err: %v", err)
+	}
+}
+
+// scheduleLoad asks Sync for a load, the requests pending are merged.
+func (c *Catalog) scheduleLoad() {
+	select {
+	case c.reload <- struct{}{}:
+	default:
+	}
+}
+
+// Sync reloads the snapshot whenever this or another replica bumps the
+// version until ctx is done. The loads wait reloadDelay for the bumps to
+// batch with.
+func (c *Catalog) Sync(ctx context.Context) {
+	var messages <-chan *redis.Message
+	if r, err := cache.GetRedis(); err != nil {
+		logging.Error(ctx, "[catalog] subscribe err: %v", err)
+	} else {
+		pubsub := r.Subscribe(ctx, versionChannel)
+		defer pubsub.Close()
+		messages = pubsub.Channel()
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	var delay <-chan time.Time
+	for {
+		var version int64
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.reload:
+			if delay == nil {
+				delay = time.After(reloadDelay)
+			}
+			continue
+		case <-delay:
+			delay = nil
+			if err := c.Load(ctx); err != nil {
+				logging.Error(ctx, "[catalog] load err: %v", err)
+			}
+			continue
+		case m, ok := <-messages:
+			if !ok {
+				messages = nil
+				continue
+			}
+			version, _ = strconv.ParseInt(m.Payload, 10, 64)
+		case <-ticker.C:
+			v, err := remoteVersion(ctx)
+			if err != nil {
+				logging.Error(ctx, "[catalog] read version err: %v", err)
+				continue
+			}
+			version = v
+		}
+
+		current := c.Snapshot()
+		if current != nil && version <= current.Version && c.Fresh() != nil {
+			continue
+		}
+		if delay == nil {
+			delay = time.After(reloadDelay)
+		}
+	}
+}
+
+func remoteVersion(ctx context.Context) (int64, error) {
+	r, err := cache.GetRedis()
+	if err != nil {
+		return 0, err
+	}
+
+	version, err := r.Get(ctx, versionKey).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return version, err
+}
+
+func load(version int64) (*Snapshot, error) {
+	db := database.GetDB()
+
+	productModels, err := productDao.Gets(db, &productDao.QueryModel{})
+	if err != nil {
+		return nil, err
+	}
+	exchangeModels, err := exchangeDao.Gets(db, &exchangeDao.QueryModel{})
+	if err != nil {
+		return nil, err
+	}
+	nameModels, err := productNameDao.Gets(db, &productNameDao.QueryModel{})
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &Snapshot{
+		Version:        version,
+		LoadedAt:       time.Now(),
+		products:       make(map[uint64]*models.ProductModel, len(productModels)),
+		productsByCode: make(map[codeKey]*models.ProductModel, len(productModels)),
+		exchanges:      make(map[string]*models.ExchangeModel, len(exchangeModels)),
+		names:          make(map[uint64][]models.ProductNameModel, len(productModels)),
+	}
+	for i := range productModels {
+		p := &productModels[i]
+		snapshot.products[p.ID] = p
+		snapshot.productsByCode[codeKey{p.ExchangeCode, p.Code}] = p
+	}
+	for i := range exchangeModels {
+		e := &exchangeModels[i]
+		snapshot.exchanges[e.Code] = e
+	}
+	for _, n := range nameModels {
+		snapshot.names[n.ProductID] = append(snapshot.names[n.ProductID], n)
+	}
+	return snapshot, nil
+}
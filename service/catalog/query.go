@@ -0,0 +1,261 @@
+package catalog
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-product/dao/productDao"
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+)
+
+// Query returns the products matching the query the way productDao does, in
+// its Sort order then by id, after the keyset unless it is nil. ok is false
+// for a query the snapshot cannot answer: one on the tags, one including the
+// deleted products it does not hold, or a keyset not matching the sort.
+func (s *Snapshot) Query(query *productDao.QueryModel, after *productDao.Keyset) (result []models.ProductModel, ok bool) {
+	if query.Tag != "" || query.WithDeleted {
+		return nil, false
+	}
+	if after != nil && len(after.Values) != len(query.Sort) {
+		return nil, false
+	}
+
+	result = []models.ProductModel{}
+	for _, p := range s.products {
+		if s.matches(query, p) && (after == nil || compareKeyset(query.Sort, p, after) > 0) {
+			result = append(result, *p)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return compareProducts(query.Sort, &result[i], &result[j]) < 0
+	})
+
+	if query.Offset > 0 {
+		if query.Offset >= len(result) {
+			return []models.ProductModel{}, true
+		}
+		result = result[query.Offset:]
+	}
+	if query.Limit > 0 && query.Limit < len(result) {
+		result = result[:query.Limit]
+	}
+	return result, true
+}
+
+// matches is queryChain of productDao in memory
+func (s *Snapshot) matches(q *productDao.QueryModel, p *models.ProductModel) bool {
+	e := s.exchanges[p.ExchangeCode]
+
+	switch {
+	case q.ID != 0 && p.ID != q.ID,
+		len(q.IDs) > 0 && !containsID(q.IDs, p.ID),
+		q.Code != "" && p.Code != q.Code,
+		q.ExchangeCode != "" && p.ExchangeCode != q.ExchangeCode,
+		len(q.ProductType) > 0 && !containsType(q.ProductType, p.Type),
+		len(q.ExchangeCodes) > 0 && !containsString(q.ExchangeCodes, p.ExchangeCode),
+		q.Status != 0 && p.Status != q.Status,
+		q.Display != 0 && p.Display != q.Display,
+		q.ISIN != "" && p.ISIN.String != q.ISIN,
+		q.CUSIP != "" && p.CUSIP.String != q.CUSIP,
+		q.SEDOL != "" && p.SEDOL.String != q.SEDOL,
+		q.FIGI != "" && p.FIGI.String != q.FIGI,
+		len(q.TaxonomyIDs) > 0 && (!p.TaxonomyID.Valid || !containsID(q.TaxonomyIDs, uint64(p.TaxonomyID.Int64))),
+		q.CodeOrNameLike != "" && !like(p.Code, q.CodeOrNameLike) && !like(p.Name, q.CodeOrNameLike),
+		!inTimeRange(p.UpdatedAt, true, q.UpdatedFrom, time.Time{}),
+		!inTimeRange(p.ListedAt.Time, p.ListedAt.Valid, q.ListedFrom, q.ListedUntil),
+		!inTimeRange(p.DelistedAt.Time, p.DelistedAt.Valid, q.DelistedFrom, q.DelistedUntil):
+		return false
+	}
+
+	if len(q.CurrencyCodes) > 0 {
+		currencyCode := p.CurrencyCode
+		if !currencyCode.Valid && e != nil {
+			currencyCode = e.CurrencyCode
+		}
+		if !currencyCode.Valid || !containsString(q.CurrencyCodes, currencyCode.String) {
+			return false
+		}
+	}
+
+	// an unknown exchange counts as enabled, like the COALESCE of productDao
+	status, display := p.Status, p.Display
+	if e != nil {
+		status, display = moreRestrictive(status, e.Status), moreRestrictive(display, e.Display)
+	}
+	switch {
+	case q.EffectiveStatus != 0 && status != q.EffectiveStatus,
+		len(q.EffectiveStatuses) > 0 && !containsInt(q.EffectiveStatuses, status),
+		q.EffectiveDisplay != 0 && display != q.EffectiveDisplay:
+		return false
+	}
+	return true
+}
+
+// compareProducts orders by the sort fields then by id, like the sortScope of
+// productDao
+func compareProducts(fields []productDao.SortField, a, b *models.ProductModel) int {
+	for _, f := range fields {
+		if c := compareValues(columnValue(a, f.Column), columnValue(b, f.Column)); c != 0 {
+			if f.Desc {
+				return -c
+			}
+			return c
+		}
+	}
+	return compareValues(a.ID, b.ID)
+}
+
+// compareKeyset compares the product with the keyset in the order of
+// compareProducts
+func compareKeyset(fields []productDao.SortField, p *models.ProductModel, after *productDao.Keyset) int {
+	for i, f := range fields {
+		if c := compareValues(columnValue(p, f.Column), after.Values[i]); c != 0 {
+			if f.Desc {
+				return -c
+			}
+			return c
+		}
+	}
+	return compareValues(p.ID, after.ID)
+}
+
+// columnValue reads a sort column of productDao from the product
+func columnValue(p *models.ProductModel, column string) interface{} {
+	switch column {
+	case "code":
+		return p.Code
+	case "name":
+		return p.Name
+	case "created_at":
+		return p.CreatedAt
+	case "updated_at":
+		return p.UpdatedAt
+	case "priority":
+		return p.Priority
+	}
+	return nil
+}
+
+// compareValues compares two values of the same sort column, the strings
+// case-insensitively like the collation of the columns
+func compareValues(a, b interface{}) int {
+	switch a := a.(type) {
+	case string:
+		b, _ := b.(string)
+		return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+	case time.Time:
+		b, _ := b.(time.Time)
+		switch {
+		case a.Before(b):
+			return -1
+		case a.After(b):
+			return 1
+		}
+	case int:
+		b, _ := b.(int)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+	case uint64:
+		b, _ := b.(uint64)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+	}
+	return 0
+}
+
+// like matches s against a LIKE pattern case-insensitively, % matches any
+// run of characters, _ any one, and \ escapes the next character.
+func like(s, pattern string) bool {
+	return likeRunes([]rune(strings.ToLower(s)), []rune(strings.ToLower(pattern)))
+}
+
+func likeRunes(s, pattern []rune) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '%':
+			for i := 0; i <= len(s); i++ {
+				if likeRunes(s[i:], pattern[1:]) {
+					return true
+				}
+			}
+			return false
+		case '_':
+			if len(s) == 0 {
+				return false
+			}
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		}
+		s, pattern = s[1:], pattern[1:]
+	}
+	return len(s) == 0
+}
+
+// inTimeRange matches from <= t <= until like the timeRangeScope of
+// productDao, a NULL column matches no bound
+func inTimeRange(t time.Time, valid bool, from, until time.Time) bool {
+	if from.IsZero() && until.IsZero() {
+		return true
+	}
+	return valid && (from.IsZero() || !t.Before(from)) && (until.IsZero() || !t.After(until))
+}
+
+// moreRestrictive picks disabled (2) over enabled (1)
+func moreRestrictive(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func containsID(ids []uint64, id uint64) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+func containsType(types []models.ProductType, t models.ProductType) bool {
+	for _, i := range types {
+		if i == t {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
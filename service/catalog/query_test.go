@@ -0,0 +1,108 @@
+package catalog
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/paper-trade-chatbot/be-product/dao/productDao"
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+)
+
+func testSnapshot() *Snapshot {
+	s := &Snapshot{
+		products: map[uint64]*models.ProductModel{},
+		exchanges: map[string]*models.ExchangeModel{
+			"TWSE":   {Code: "TWSE", Status: 1, Display: 1, CurrencyCode: sql.NullString{String: "TWD", Valid: true}},
+			"NASDAQ": {Code: "NASDAQ", Status: 2, Display: 1, CurrencyCode: sql.NullString{String: "USD", Valid: true}},
+		},
+	}
+	for _, p := range []*models.ProductModel{
+		{ID: 1, ExchangeCode: "TWSE", Code: "2330", Name: "TSMC", Status: 1, Display: 1, Priority: 3},
+		{ID: 2, ExchangeCode: "TWSE", Code: "2317", Name: "Foxconn", Status: 2, Display: 1, Priority: 1},
+		{ID: 3, ExchangeCode: "NASDAQ", Code: "AAPL", Name: "Apple", Status: 1, Display: 1, Priority: 2},
+		{ID: 4, ExchangeCode: "TWSE", Code: "00878", Name: "ETF_100%", Status: 1, Display: 1, Priority: 3,
+			CurrencyCode: sql.NullString{String: "USD", Valid: true}},
+	} {
+		s.products[p.ID] = p
+	}
+	return s
+}
+
+func ids(rows []models.ProductModel) []uint64 {
+	result := []uint64{}
+	for _, r := range rows {
+		result = append(result, r.ID)
+	}
+	return result
+}
+
+func TestQuery(t *testing.T) {
+	s := testSnapshot()
+
+	cases := map[string]struct {
+		query *productDao.QueryModel
+		after *productDao.Keyset
+		want  []uint64
+	}{
+		"every product by id": {&productDao.QueryModel{}, nil, []uint64{1, 2, 3, 4}},
+		// the exchange of AAPL is disabled
+		"effective status":        {&productDao.QueryModel{EffectiveStatus: 1}, nil, []uint64{1, 4}},
+		"own status":              {&productDao.QueryModel{Status: 1}, nil, []uint64{1, 3, 4}},
+		"inherited currency":      {&productDao.QueryModel{CurrencyCodes: []string{"USD"}}, nil, []uint64{3, 4}},
+		"prefix case-insensitive": {&productDao.QueryModel{CodeOrNameLike: "t%"}, nil, []uint64{1}},
+		"escaped wildcards":       {&productDao.QueryModel{CodeOrNameLike: `%\_100\%%`}, nil, []uint64{4}},
+		"sorted then by id":       {&productDao.QueryModel{Sort: []productDao.SortField{{Column: "priority", Desc: true}}}, nil, []uint64{1, 4, 3, 2}},
+		"after the keyset": {
+			&productDao.QueryModel{Sort: []productDao.SortField{{Column: "priority", Desc: true}}},
+			&productDao.Keyset{Values: []interface{}{3}, ID: 1},
+			[]uint64{4, 3, 2},
+		},
+		"sorted by name":   {&productDao.QueryModel{Sort: []productDao.SortField{{Column: "name"}}}, nil, []uint64{3, 4, 2, 1}},
+		"offset and limit": {&productDao.QueryModel{Offset: 1, Limit: 2}, nil, []uint64{2, 3}},
+	}
+	for name, c := range cases {
+		rows, ok := s.Query(c.query, c.after)
+		if !ok {
+			t.Errorf("%s: not answered", name)
+			continue
+		}
+		if got := ids(rows); fmt.Sprint(got) != fmt.Sprint(c.want) {
+			t.Errorf("%s: got %v, want %v", name, got, c.want)
+		}
+	}
+}
+
+func TestQueryNotAnswered(t *testing.T) {
+	s := testSnapshot()
+
+	for name, query := range map[string]*productDao.QueryModel{
+		"tag":          {Tag: "ai"},
+		"with deleted": {WithDeleted: true},
+	} {
+		if _, ok := s.Query(query, nil); ok {
+			t.Errorf("%s: answered", name)
+		}
+	}
+	if _, ok := s.Query(&productDao.QueryModel{}, &productDao.Keyset{Values: []interface{}{"x"}}); ok {
+		t.Error("keyset not matching the sort answered")
+	}
+}
+
+func TestNames(t *testing.T) {
+	s := testSnapshot()
+	s.names = map[uint64][]models.ProductNameModel{
+		1: {{ProductID: 1, Locale: "en", LongName: "Taiwan Semiconductor"}},
+	}
+
+	if names, ok := s.Names(1); !ok || len(names) != 1 {
+		t.Fatalf("got %v %v", names, ok)
+	}
+	// a product without names is known, one the snapshot lacks is not
+	if names, ok := s.Names(2); !ok || len(names) != 0 {
+		t.Fatalf("got %v %v", names, ok)
+	}
+	if _, ok := s.Names(99); ok {
+		t.Fatal("unknown product has names")
+	}
+}
@@ -0,0 +1,103 @@
+package event
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-common/logging"
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+)
+
+type Type string
+
+const (
+	Type_ProductCreated        Type = Type(models.EventType_ProductCreated)
+	Type_ProductModified       Type = Type(models.EventType_ProductModified)
+	Type_ProductDelisted       Type = Type(models.EventType_ProductDelisted)
+	Type_ProductDeleted        Type = Type(models.EventType_ProductDeleted)
+	Type_ExchangeCreated       Type = Type(models.EventType_ExchangeCreated)
+	Type_ExchangeModified      Type = Type(models.EventType_ExchangeModified)
+	Type_ExchangeStatusChanged Type = Type(models.EventType_ExchangeStatusChanged)
+	Type_HolidayUpdated        Type = Type(models.EventType_HolidayUpdated)
+	Type_HolidayDeleted        Type = Type(models.EventType_HolidayDeleted)
+)
+
+// Event is a change of the catalog other services may react to. An event may
+// be delivered more than once, ID stays the same so that consumers can drop
+// the duplicates.
+type Event struct {
+	ID           uint64
+	Type         Type
+	ProductID    uint64 // set for the product events
+	ExchangeCode string // set for the exchange and holiday events
+	OccurredAt   time.Time
+	Payload      map[string]interface{}
+}
+
+// Publisher delivers events for the relay, an error makes the relay send the
+// event again later.
+type Publisher interface {
+	Publish(ctx context.Context, e *Event) error
+}
+
+var (
+	lock       sync.RWMutex
+	publishers = []Publisher{&LogPublisher{}}
+)
+
+// SetPublishers replaces the publishers every event is sent to.
+func SetPublishers(p ...Publisher) {
+	lock.Lock()
+	defer lock.Unlock()
+	publishers = p
+}
+
+// Publish sends the event to every publisher, a failing publisher does not
+// stop the others. It returns the first error.
+func Publish(ctx context.Context, e *Event) error {
+	if e.OccurredAt.IsZero() {
+		e.OccurredAt = time.Now()
+	}
+
+	lock.RLock()
+	defer lock.RUnlock()
+	var result error
+	for _, p := range publishers {
+		if err := p.Publish(ctx, e); err != nil {
+			logging.Error(ctx, "[Publish] event %d %s err: %v", e.ID, e.Type, err)
+			if result == nil {
+				result = err
+			}
+		}
+	}
+	return result
+}
+
+// LogPublisher writes events to the log, it is the default publisher.
+type LogPublisher struct{}
+
+func (p *LogPublisher) Publish(ctx context.Context, e *Event) error {
+	logging.Info(ctx, "[event] %d %s product %d exchange %s %v", e.ID, e.Type, e.ProductID, e.ExchangeCode, e.Payload)
+	return nil
+}
+
+// MemoryPublisher keeps the events it gets, for local runs.
+type MemoryPublisher struct {
+	mutex  sync.Mutex
+	events []*Event
+}
+
+func (p *MemoryPublisher) Publish(ctx context.Context, e *Event) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.events = append(p.events, e)
+	return nil
+}
+
+// Events returns the events published so far, in order
+func (p *MemoryPublisher) Events() []*Event {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return append([]*Event(nil), p.events...)
+}
@@ -0,0 +1,214 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-common/database"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"github.com/paper-trade-chatbot/be-product/dao/eventOutboxDao"
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+	"gorm.io/gorm"
+)
+
+const (
+	relayInterval = time.Second
+	relayBatch    = 100
+
+	// a batch is leased to the relay which claimed it for relayLease, it
+	// gets relayPublishTimeout to publish it. Past the lease another relay
+	// publishes the rows again.
+	relayLease          = 2 * time.Minute
+	relayPublishTimeout = time.Minute
+
+	// an event still failing after relayMaxAttempts is dead-lettered, it
+	// stays in the outbox with the dead status and its last error.
+	relayMaxAttempts = 10
+	relayRetryBase   = time.Second
+	relayRetryMax    = 10 * time.Minute
+
+	// the published rows are kept for relayRetention, for investigations
+	relayRetention       = 7 * 24 * time.Hour
+	relayCleanupInterval = time.Hour
+
+	lastErrorMaxLength = 512
+)
+
+// StartRelay publishes the events of the outbox until ctx is done. Every
+// event is published at least once, in order for each product or exchange.
+// Any number of replicas can run it, a row is leased to one of them at a
+// time.
+func StartRelay(ctx context.Context) {
+	ticker := time.NewTicker(relayInterval)
+	defer ticker.Stop()
+	cleanup := time.NewTicker(relayCleanupInterval)
+	defer cleanup.Stop()
+
+	for {
+		// a full batch means more rows are due
+		for {
+			n, err := relay(ctx, time.Now())
+			if err != nil {
+				logging.Error(ctx, "[StartRelay] err: %v", err)
+				break
+			}
+			if n < relayBatch {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-cleanup.C:
+			deletePublished(ctx, time.Now().Add(-relayRetention))
+		case <-ticker.C:
+		}
+	}
+}
+
+// relay publishes one batch of due rows and returns how many it took. The
+// rows are claimed in a transaction of their own, so that no lock is held
+// while they are published, then marked in another one.
+func relay(ctx context.Context, now time.Time) (int, error) {
+	db := database.GetDB()
+
+	var rows []models.EventOutboxModel
+	err := database.Transaction(db, func(tx *gorm.DB) error {
+		var err error
+		rows, err = eventOutboxDao.GetsDue(tx, now, relayBatch)
+		if err != nil {
+			return err
+		}
+
+		ids := make([]uint64, 0, len(rows))
+		for i := range rows {
+			ids = append(ids, rows[i].ID)
+			rows[i].Attempts++
+		}
+		return eventOutboxDao.Claim(tx, ids, now.Add(relayLease))
+	})
+	if err != nil || len(rows) == 0 {
+		return 0, err
+	}
+
+	publishCtx, cancel := context.WithTimeout(ctx, relayPublishTimeout)
+	defer cancel()
+	updates := make([]map[string]interface{}, len(rows))
+	for i := range rows {
+		updates[i] = publish(publishCtx, &rows[i], now)
+	}
+
+	err = database.Transaction(db, func(tx *gorm.DB) error {
+		for i := range rows {
+			row := &rows[i]
+			ok, err := eventOutboxDao.ModifyClaimed(tx, row, updates[i])
+			if err != nil {
+				return err
+			}
+			if !ok {
+				logging.Warn(ctx, "[relay] event %d claimed again before it was marked", row.ID)
+			}
+		}
+		return nil
+	})
+	return len(rows), err
+}
+
+// publish sends the row and returns how to update it, row.Attempts already
+// counts this attempt.
+func publish(ctx context.Context, row *models.EventOutboxModel, now time.Time) map[string]interface{} {
+	attempts := row.Attempts
+
+	e, err := toEvent(row)
+	if err != nil {
+		// a row that cannot be read will not get any better
+		logging.Error(ctx, "[relay] event %d dead: %v", row.ID, err)
+		return map[string]interface{}{
+			"status":     models.EventOutboxStatus_Dead,
+			"last_error": lastError(err),
+		}
+	}
+
+	if err := Publish(ctx, e); err != nil {
+		updates := map[string]interface{}{
+			"last_error": lastError(err),
+		}
+		if attempts >= relayMaxAttempts {
+			logging.Error(ctx, "[relay] event %d %s dead after %d attempts: %v", row.ID, row.EventType, attempts, err)
+			updates["status"] = models.EventOutboxStatus_Dead
+		} else {
+			updates["next_attempt_at"] = now.Add(retryDelay(attempts))
+		}
+		return updates
+	}
+
+	return map[string]interface{}{
+		"status":       models.EventOutboxStatus_Published,
+		"published_at": now,
+	}
+}
+
+func toEvent(row *models.EventOutboxModel) (*Event, error) {
+	payload := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(row.Payload), &payload); err != nil {
+		return nil, fmt.Errorf("payload: %w", err)
+	}
+
+	e := &Event{
+		ID:         row.ID,
+		Type:       Type(row.EventType),
+		OccurredAt: row.CreatedAt,
+		Payload:    payload,
+	}
+	switch row.AggregateType {
+	case models.AggregateType_Product:
+		id, err := strconv.ParseUint(row.AggregateID, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("product id: %w", err)
+		}
+		e.ProductID = id
+	case models.AggregateType_Exchange:
+		e.ExchangeCode = row.AggregateID
+	default:
+		return nil, fmt.Errorf("unknown aggregate type %q", row.AggregateType)
+	}
+	return e, nil
+}
+
+// retryDelay doubles from relayRetryBase up to relayRetryMax
+func retryDelay(attempts int) time.Duration {
+	delay := relayRetryBase
+	for i := 1; i < attempts && delay < relayRetryMax; i++ {
+		delay *= 2
+	}
+	if delay > relayRetryMax {
+		delay = relayRetryMax
+	}
+	return delay
+}
+
+func lastError(err error) string {
+	message := err.Error()
+	if len(message) > lastErrorMaxLength {
+		message = message[:lastErrorMaxLength]
+	}
+	return message
+}
+
+func deletePublished(ctx context.Context, before time.Time) {
+	db := database.GetDB()
+	for {
+		n, err := eventOutboxDao.DeletePublished(db, before, relayBatch)
+		if err != nil {
+			logging.Error(ctx, "[deletePublished] err: %v", err)
+			return
+		}
+		if n < relayBatch {
+			return
+		}
+	}
+}
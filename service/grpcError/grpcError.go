@@ -0,0 +1,229 @@
+// Package grpcError turns the errors of the handlers into gRPC statuses with
+// canonical codes. Handlers either return one of the typed errors below or
+// let Translate work out what a DAO or be-common error means.
+package grpcError
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/go-sql-driver/mysql"
+	"github.com/golang/protobuf/proto"
+	common "github.com/paper-trade-chatbot/be-common"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+const domain = "be-product"
+
+// mysql error numbers
+const (
+	mysqlErrDuplicateEntry    = 1062
+	mysqlErrLockWaitTimeout   = 1205
+	mysqlErrDeadlock          = 1213
+	mysqlErrNoReferencedRow2  = 1216
+	mysqlErrRowIsReferenced2  = 1217
+	mysqlErrOutOfRangeValue   = 1264
+	mysqlErrTruncatedWrongVal = 1292
+	mysqlErrDataTooLong       = 1406
+	mysqlErrRowIsReferenced   = 1451
+	mysqlErrNoReferencedRow   = 1452
+)
+
+// legacyCodes maps the be-common error codes, which are no gRPC codes, to the
+// canonical code closest to them.
+var legacyCodes = map[common.ErrCode]codes.Code{
+	common.ErrCode_NoQueryCondition: codes.InvalidArgument,
+	common.ErrCode_NotImplemented:   codes.Unimplemented,
+	common.ErrCode_Unknown:          codes.Unknown,
+	common.ErrCode_Internal:         codes.Internal,
+	common.ErrCode_NoRequiredParam:  codes.InvalidArgument,
+	common.ErrCode_InvalidParam:     codes.InvalidArgument,
+	common.ErrCode_NoPermission:     codes.PermissionDenied,
+	common.ErrCode_NoSuchProduct:    codes.NotFound,
+}
+
+// NotFoundError reports that the resource identified by Key does not exist.
+type NotFoundError struct {
+	Resource string
+	Key      string
+}
+
+func NotFound(resource string, key interface{}) error {
+	return &NotFoundError{Resource: resource, Key: fmt.Sprint(key)}
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s %s not found", e.Resource, e.Key)
+}
+
+func (e *NotFoundError) GRPCStatus() *status.Status {
+	return withDetails(status.New(codes.NotFound, e.Error()), &errdetails.ResourceInfo{
+		ResourceType: e.Resource,
+		ResourceName: e.Key,
+	})
+}
+
+// FieldError reports the fields of a request that are invalid, or that clash
+// with an existing resource.
+type FieldError struct {
+	Code       codes.Code
+	Violations []*errdetails.BadRequest_FieldViolation
+}
+
+func (e *FieldError) Error() string {
+	if len(e.Violations) == 0 {
+		return e.Code.String()
+	}
+	return fmt.Sprintf("%s: %s", e.Violations[0].Field, e.Violations[0].Description)
+}
+
+func (e *FieldError) GRPCStatus() *status.Status {
+	return withDetails(status.New(e.Code, e.Error()), &errdetails.BadRequest{FieldViolations: e.Violations})
+}
+
+// Violations collects what is wrong with a request so that the caller sees
+// every field at once instead of fixing them one by one.
+type Violations []*errdetails.BadRequest_FieldViolation
+
+func (v *Violations) Add(field, format string, args ...interface{}) {
+	*v = append(*v, &errdetails.BadRequest_FieldViolation{
+		Field:       field,
+		Description: fmt.Sprintf(format, args...),
+	})
+}
+
+// AddValidation adds the failures of govalidator.ValidateStruct, one per
+// field. The struct validated should carry json tags, the violations are
+// named after them.
+func (v *Violations) AddValidation(err error) {
+	var errs govalidator.Errors
+	var fieldErr govalidator.Error
+	switch {
+	case errors.As(err, &errs):
+		for _, e := range errs {
+			v.AddValidation(e)
+		}
+	case errors.As(err, &fieldErr):
+		v.Add(fieldErr.Name, "%s", fieldErr.Err)
+	case err != nil:
+		v.Add("", "%s", err)
+	}
+}
+
+// InvalidArgument returns the violations as an InvalidArgument error, nil
+// when there is none.
+func (v Violations) InvalidArgument() error {
+	return v.err(codes.InvalidArgument)
+}
+
+// AlreadyExists returns the violations as an AlreadyExists error, nil when
+// there is none.
+func (v Violations) AlreadyExists() error {
+	return v.err(codes.AlreadyExists)
+}
+
+func (v Violations) err(code codes.Code) error {
+	if len(v) == 0 {
+		return nil
+	}
+	return &FieldError{Code: code, Violations: v}
+}
+
+// InvalidArgument is a shortcut for a single violation.
+func InvalidArgument(field, format string, args ...interface{}) error {
+	v := Violations{}
+	v.Add(field, format, args...)
+	return v.InvalidArgument()
+}
+
+// AlreadyExists is a shortcut for a single violation.
+func AlreadyExists(field, format string, args ...interface{}) error {
+	v := Violations{}
+	v.Add(field, format, args...)
+	return v.AlreadyExists()
+}
+
+// Translate returns err as a gRPC status error with a canonical code. An
+// error that cannot be classified becomes Internal without its message,
+// which may leak SQL.
+func Translate(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var notFound *NotFoundError
+	var fieldErr *FieldError
+	var mysqlErr *mysql.MySQLError
+	switch {
+	case errors.As(err, &notFound):
+		return notFound.GRPCStatus().Err()
+	case errors.As(err, &fieldErr):
+		return fieldErr.GRPCStatus().Err()
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return status.Error(codes.NotFound, "record not found")
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.As(err, &mysqlErr):
+		return translateMySQL(mysqlErr)
+	}
+
+	if st, ok := status.FromError(err); ok {
+		return translateStatus(st)
+	}
+
+	return status.Error(codes.Internal, "internal error")
+}
+
+func translateMySQL(err *mysql.MySQLError) error {
+	switch err.Number {
+	case mysqlErrDuplicateEntry:
+		return status.Error(codes.AlreadyExists, "duplicate entry")
+	case mysqlErrDeadlock, mysqlErrLockWaitTimeout:
+		return status.Error(codes.Aborted, "transaction aborted, retry")
+	case mysqlErrNoReferencedRow, mysqlErrNoReferencedRow2:
+		return status.Error(codes.InvalidArgument, "referenced resource does not exist")
+	case mysqlErrRowIsReferenced, mysqlErrRowIsReferenced2:
+		return status.Error(codes.FailedPrecondition, "resource is still referenced")
+	case mysqlErrDataTooLong, mysqlErrOutOfRangeValue, mysqlErrTruncatedWrongVal:
+		return status.Error(codes.InvalidArgument, "value out of range")
+	}
+	return status.Error(codes.Internal, "internal error")
+}
+
+// translateStatus keeps a canonical status and maps a be-common one, the
+// be-common code stays available in an ErrorInfo for the callers that still
+// switch on it.
+func translateStatus(st *status.Status) error {
+	if st.Code() <= codes.Unauthenticated {
+		return st.Err()
+	}
+
+	legacy := common.ErrCode(st.Code())
+	code, ok := legacyCodes[legacy]
+	if !ok {
+		code = codes.Unknown
+	}
+
+	return withDetails(status.New(code, st.Message()), &errdetails.ErrorInfo{
+		Reason:   "LEGACY_ERROR_CODE",
+		Domain:   domain,
+		Metadata: map[string]string{"errCode": strconv.FormatUint(uint64(legacy), 10)},
+	}).Err()
+}
+
+// withDetails falls back to the bare status if the details cannot be attached
+func withDetails(st *status.Status, details ...proto.Message) *status.Status {
+	withDetails, err := st.WithDetails(details...)
+	if err != nil {
+		return st
+	}
+	return withDetails
+}
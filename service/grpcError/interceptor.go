@@ -0,0 +1,42 @@
+package grpcError
+
+import (
+	"context"
+
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor translates the error of every unary handler.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		if err != nil {
+			err = translateAndLog(ctx, info.FullMethod, err)
+		}
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor translates the error a stream handler ends with.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		err := handler(srv, ss)
+		if err != nil {
+			err = translateAndLog(ss.Context(), info.FullMethod, err)
+		}
+		return err
+	}
+}
+
+// translateAndLog logs the original error of an Internal status, the caller
+// only gets a generic message.
+func translateAndLog(ctx context.Context, method string, err error) error {
+	translated := Translate(err)
+	if status.Code(translated) == codes.Internal {
+		logging.Error(ctx, "[%s] err: %v", method, err)
+	}
+	return translated
+}
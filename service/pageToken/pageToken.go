@@ -0,0 +1,192 @@
+// Package pageToken issues the opaque tokens of the cursor pagination. A token
+// holds the sort key of the last row of a page and is signed with HMAC-SHA256,
+// so that a client can neither forge one nor reuse it with another query. The
+// secret is shared by the replicas through Redis, a replica falls back to a
+// secret of its own while Redis is down.
+package pageToken
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-common/cache"
+	"github.com/paper-trade-chatbot/be-common/logging"
+)
+
+const (
+	secretKey   = "be-product:page-token:secret"
+	secretBytes = 32
+	macBytes    = 16
+	version     = 1
+
+	// while Redis is down the shared secret is read again after a delay
+	// doubling from retryMin up to retryMax
+	retryMin = time.Second
+	retryMax = time.Minute
+)
+
+// ErrInvalid is returned for a token that was tampered with, or issued for
+// another query.
+var ErrInvalid = errors.New("invalid page token")
+
+type payload struct {
+	Version int               `json:"v"`
+	Key     []json.RawMessage `json:"k"`
+}
+
+var (
+	lock   sync.Mutex
+	shared []byte
+	local  []byte
+	// loading is set while a caller reads the shared secret, the others sign
+	// with the local one meanwhile
+	loading    bool
+	retryAt    time.Time
+	retryDelay time.Duration
+)
+
+// Encode returns the token of the page after the row with the key. scope
+// describes the query, the token is only accepted for the same scope.
+func Encode(ctx context.Context, scope string, key ...interface{}) (string, error) {
+	p := payload{Version: version}
+	for _, k := range key {
+		b, err := json.Marshal(k)
+		if err != nil {
+			return "", err
+		}
+		p.Key = append(p.Key, b)
+	}
+	b, err := json.Marshal(&p)
+	if err != nil {
+		return "", err
+	}
+
+	body := base64.RawURLEncoding.EncodeToString(b)
+	secrets := secrets(ctx)
+	return body + "." + base64.RawURLEncoding.EncodeToString(mac(secrets[0], scope, body)), nil
+}
+
+// Decode checks the token against the scope and unmarshals its key into the
+// targets, which have to be as many as the values encoded.
+func Decode(ctx context.Context, token, scope string, targets ...interface{}) error {
+	body, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return ErrInvalid
+	}
+	signed, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return ErrInvalid
+	}
+
+	valid := false
+	for _, secret := range secrets(ctx) {
+		if hmac.Equal(signed, mac(secret, scope, body)) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return ErrInvalid
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		return ErrInvalid
+	}
+	p := payload{}
+	if err := json.Unmarshal(b, &p); err != nil || p.Version != version || len(p.Key) != len(targets) {
+		return ErrInvalid
+	}
+	for i, target := range targets {
+		decoder := json.NewDecoder(bytes.NewReader(p.Key[i]))
+		decoder.UseNumber()
+		if err := decoder.Decode(target); err != nil {
+			return ErrInvalid
+		}
+	}
+	return nil
+}
+
+func mac(secret []byte, scope, body string) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(scope))
+	h.Write([]byte("."))
+	h.Write([]byte(body))
+	return h.Sum(nil)[:macBytes]
+}
+
+// secrets returns the secret to sign with first, then the other one still
+// accepted. Redis is read outside of the lock, by one caller at a time and
+// not again before retryAt after a failure.
+func secrets(ctx context.Context) [][]byte {
+	lock.Lock()
+	if local == nil {
+		local = randomSecret()
+	}
+	if shared != nil {
+		defer lock.Unlock()
+		return [][]byte{shared, local}
+	}
+	if loading || time.Now().Before(retryAt) {
+		defer lock.Unlock()
+		return [][]byte{local}
+	}
+	loading = true
+	lock.Unlock()
+
+	secret, err := loadShared(ctx)
+
+	lock.Lock()
+	defer lock.Unlock()
+	loading = false
+	if err != nil {
+		retryDelay *= 2
+		if retryDelay < retryMin {
+			retryDelay = retryMin
+		}
+		if retryDelay > retryMax {
+			retryDelay = retryMax
+		}
+		retryAt = time.Now().Add(retryDelay)
+		logging.Error(ctx, "[pageToken] load secret err: %v, retry in %v", err, retryDelay)
+		return [][]byte{local}
+	}
+	shared = secret
+	retryDelay = 0
+	return [][]byte{shared, local}
+}
+
+// loadShared stores a new secret in Redis unless another replica already did,
+// and returns the one stored.
+func loadShared(ctx context.Context) ([]byte, error) {
+	r, err := cache.GetRedis()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.SetNX(ctx, secretKey, hex.EncodeToString(randomSecret()), 0).Err(); err != nil {
+		return nil, err
+	}
+	value, err := r.Get(ctx, secretKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(value)
+}
+
+func randomSecret() []byte {
+	b := make([]byte, secretBytes)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b
+}
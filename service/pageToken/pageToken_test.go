@@ -0,0 +1,100 @@
+package pageToken
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redismock/v8"
+	"github.com/paper-trade-chatbot/be-common/cache"
+)
+
+// reset forgets the secrets and points the package at a mocked Redis
+func reset(t *testing.T) redismock.ClientMock {
+	mock, closeRedis := cache.SetRedisMock()
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		closeRedis()
+	})
+
+	lock.Lock()
+	defer lock.Unlock()
+	shared, local = nil, nil
+	loading, retryAt, retryDelay = false, time.Time{}, 0
+	return mock
+}
+
+func TestEncodeDecode(t *testing.T) {
+	mock := reset(t)
+	secret := randomSecret()
+	mock.Regexp().ExpectSetNX(secretKey, ".*", 0).SetVal(true)
+	mock.ExpectGet(secretKey).SetVal(hex.EncodeToString(secret))
+
+	ctx := context.Background()
+	token, err := Encode(ctx, "products", "TWSE", 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var code string
+	var id int
+	if err := Decode(ctx, token, "products", &code, &id); err != nil {
+		t.Fatal(err)
+	}
+	if code != "TWSE" || id != 42 {
+		t.Fatalf("got %s %d", code, id)
+	}
+
+	if err := Decode(ctx, token, "exchanges", &code, &id); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("other scope: %v", err)
+	}
+	if err := Decode(ctx, token+"x", "products", &code, &id); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("tampered: %v", err)
+	}
+}
+
+func TestRedisDownBacksOff(t *testing.T) {
+	mock := reset(t)
+	mock.Regexp().ExpectSetNX(secretKey, ".*", 0).SetErr(errors.New("connection refused"))
+
+	ctx := context.Background()
+	// only the first call goes to Redis, the others sign with the local
+	// secret until retryAt
+	for i := 0; i < 10; i++ {
+		token, err := Encode(ctx, "products", i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded int
+		if err := Decode(ctx, token, "products", &decoded); err != nil || decoded != i {
+			t.Fatalf("got %d, %v", decoded, err)
+		}
+	}
+	if retryDelay != retryMin {
+		t.Fatalf("retry delay %v", retryDelay)
+	}
+
+	// Redis is back once retryAt passed, tokens signed meanwhile stay valid
+	token, err := Encode(ctx, "products", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock.Lock()
+	retryAt = time.Now()
+	lock.Unlock()
+	secret := randomSecret()
+	mock.Regexp().ExpectSetNX(secretKey, ".*", 0).SetVal(false)
+	mock.ExpectGet(secretKey).SetVal(hex.EncodeToString(secret))
+
+	var decoded int
+	if err := Decode(ctx, token, "products", &decoded); err != nil || decoded != 1 {
+		t.Fatalf("got %d, %v", decoded, err)
+	}
+	if s := secrets(ctx); len(s) != 2 || hex.EncodeToString(s[0]) != hex.EncodeToString(secret) {
+		t.Fatal("shared secret not used")
+	}
+}
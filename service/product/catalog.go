@@ -0,0 +1,123 @@
+package product
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"github.com/paper-trade-chatbot/be-product/dao/exchangeDao"
+	"github.com/paper-trade-chatbot/be-product/dao/productDao"
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+	"github.com/paper-trade-chatbot/be-product/service/readCache"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"gorm.io/gorm"
+)
+
+// catalogVersionHeader is the response header carrying the catalog version a
+// read was served from.
+const catalogVersionHeader = "x-catalog-version"
+
+// StartCatalogSync follows the catalog versions published by the other
+// replicas until ctx is done.
+func (impl *ProductImpl) StartCatalogSync(ctx context.Context) {
+	impl.catalog.Sync(ctx)
+}
+
+// lookupProduct serves a lookup by id or by code from the catalog snapshot.
+// Anything else, a product the snapshot does not know yet, and every lookup
+// while the snapshot misses a write of this replica go through the read cache.
+func (impl *ProductImpl) lookupProduct(ctx context.Context, db *gorm.DB, query *productDao.QueryModel) (*models.ProductModel, error) {
+	if snapshot := impl.catalog.Fresh(); snapshot != nil {
+		var model *models.ProductModel
+		var ok bool
+		switch {
+		case query.IsByID():
+			model, ok = snapshot.Product(query.ID)
+		case query.IsByCode():
+			model, ok = snapshot.ProductByCode(query.ExchangeCode, query.Code)
+		}
+		if ok {
+			setCatalogVersion(ctx, snapshot.Version)
+			return model, nil
+		}
+	}
+	return readCache.GetProduct(ctx, db, query)
+}
+
+// lookupExchange is lookupProduct for exchanges.
+func (impl *ProductImpl) lookupExchange(ctx context.Context, db *gorm.DB, query *exchangeDao.QueryModel) (*models.ExchangeModel, error) {
+	if snapshot := impl.catalog.Fresh(); snapshot != nil && query.IsByCode() {
+		if model, ok := snapshot.Exchange(query.Code); ok {
+			setCatalogVersion(ctx, snapshot.Version)
+			return model, nil
+		}
+	}
+	return readCache.GetExchange(ctx, db, query)
+}
+
+// exchangesByCode returns every exchange by code, from the catalog snapshot
+// once one is loaded and has the writes of this replica.
+func (impl *ProductImpl) exchangesByCode(db *gorm.DB) (map[string]*models.ExchangeModel, error) {
+	var exchanges []models.ExchangeModel
+	if snapshot := impl.catalog.Fresh(); snapshot != nil {
+		exchanges = snapshot.Exchanges()
+	} else {
+		var err error
+		if exchanges, err = exchangeDao.Gets(db, &exchangeDao.QueryModel{}); err != nil {
+			return nil, err
+		}
+	}
+
+	byCode := make(map[string]*models.ExchangeModel, len(exchanges))
+	for i := range exchanges {
+		byCode[exchanges[i].Code] = &exchanges[i]
+	}
+	return byCode, nil
+}
+
+// touchProducts gives the products their next revision and records the
+// changes on each of them, in tx. It returns them for productsChanged.
+func touchProducts(tx *gorm.DB, productModels []models.ProductModel, changes map[string]interface{}) ([]*models.ProductModel, error) {
+	touched := make([]*models.ProductModel, 0, len(productModels))
+	for i := range productModels {
+		if err := productDao.Touch(tx, &productModels[i], changes); err != nil {
+			return nil, err
+		}
+		touched = append(touched, &productModels[i])
+	}
+	return touched, nil
+}
+
+// productsChanged drops the products from the read cache and publishes a new
+// catalog version, after the write is committed.
+func (impl *ProductImpl) productsChanged(ctx context.Context, products ...*models.ProductModel) {
+	if len(products) == 0 {
+		return
+	}
+	readCache.InvalidateProducts(ctx, products...)
+	impl.catalog.Bump(ctx)
+}
+
+// allProductsChanged is productsChanged for the bulk writes.
+func (impl *ProductImpl) allProductsChanged(ctx context.Context) {
+	readCache.InvalidateAllProducts(ctx)
+	impl.catalog.Bump(ctx)
+}
+
+// exchangesChanged is productsChanged for exchanges.
+func (impl *ProductImpl) exchangesChanged(ctx context.Context, codes ...string) {
+	readCache.InvalidateExchanges(ctx, codes...)
+	impl.catalog.Bump(ctx)
+}
+
+// setCatalogVersion reports the snapshot version in the response header, it
+// is a no-op outside of a gRPC call.
+func setCatalogVersion(ctx context.Context, version int64) {
+	if grpc.ServerTransportStreamFromContext(ctx) == nil {
+		return
+	}
+	if err := grpc.SetHeader(ctx, metadata.Pairs(catalogVersionHeader, strconv.FormatInt(version, 10))); err != nil {
+		logging.Error(ctx, "[setCatalogVersion] err: %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package product
+
+import (
+	"context"
+
+	"github.com/paper-trade-chatbot/be-common/database"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"github.com/paper-trade-chatbot/be-product/dao/catalogRevisionDao"
+	"github.com/paper-trade-chatbot/be-product/dao/productDao"
+	"github.com/paper-trade-chatbot/be-product/service/grpcError"
+)
+
+const (
+	productChangesDefaultLimit = 500
+	productChangesMaxLimit     = 5000
+)
+
+// GetProductChangesReq asks for the products changed after SinceRevision, 0
+// for every product. AfterProductID continues a page cut short, it is the
+// AfterProductID of the previous response.
+type GetProductChangesReq struct {
+	SinceRevision  int64
+	AfterProductID int64
+	Limit          int32
+}
+
+// GetProductChangesRes lists the products to fetch again and those to drop.
+// The next request carries Revision as SinceRevision, and AfterProductID while
+// HasMore is set.
+type GetProductChangesRes struct {
+	Upserted       []int64
+	Deleted        []int64
+	Revision       int64
+	AfterProductID int64
+	HasMore        bool
+	// Reset is set when SinceRevision is ahead of the catalog, the client has
+	// to drop its copy and sync from revision 0
+	Reset bool
+}
+
+// GetProductChanges returns the products created, modified or deleted after a
+// catalog revision. Every product and exchange write takes the next revision,
+// a product changes with the writes of its exchange too. A deleted product is
+// kept as a tombstone, so that it is reported to the clients syncing later.
+func (impl *ProductImpl) GetProductChanges(ctx context.Context, in *GetProductChangesReq) (*GetProductChangesRes, error) {
+	db := database.GetDB()
+
+	v := grpcError.Violations{}
+	if in.SinceRevision < 0 {
+		v.Add("sinceRevision", "must not be negative")
+	}
+	if in.AfterProductID < 0 {
+		v.Add("afterProductID", "must not be negative")
+	}
+	if in.Limit < 0 || in.Limit > productChangesMaxLimit {
+		v.Add("limit", "must be between 0 and %d", productChangesMaxLimit)
+	}
+	if err := v.InvalidArgument(); err != nil {
+		return nil, err
+	}
+	limit := int(in.Limit)
+	if limit == 0 {
+		limit = productChangesDefaultLimit
+	}
+
+	// read first, a write committed meanwhile is left for the next request
+	current, err := catalogRevisionDao.Current(db)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(in.SinceRevision) > current {
+		logging.Info(ctx, "[GetProductChanges] revision %d ahead of %d", in.SinceRevision, current)
+		return &GetProductChangesRes{
+			Revision: int64(current),
+			Reset:    true,
+		}, nil
+	}
+
+	// a client syncing from scratch has nothing to delete
+	changes, err := productDao.GetsChanged(db, uint64(in.SinceRevision), uint64(in.AfterProductID), current, in.SinceRevision > 0, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &GetProductChangesRes{
+		Upserted: []int64{},
+		Deleted:  []int64{},
+		Revision: int64(current),
+	}
+	if len(changes) > limit {
+		changes = changes[:limit]
+		last := changes[len(changes)-1]
+		res.Revision = int64(last.Revision)
+		res.AfterProductID = int64(last.ID)
+		res.HasMore = true
+	}
+	for _, c := range changes {
+		if c.DeletedAt.Valid {
+			res.Deleted = append(res.Deleted, int64(c.ID))
+		} else {
+			res.Upserted = append(res.Upserted, int64(c.ID))
+		}
+	}
+
+	return res, nil
+}
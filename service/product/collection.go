@@ -0,0 +1,580 @@
+package product
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/paper-trade-chatbot/be-common/database"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"github.com/paper-trade-chatbot/be-product/dao/collectionDao"
+	"github.com/paper-trade-chatbot/be-product/dao/collectionMemberDao"
+	"github.com/paper-trade-chatbot/be-product/dao/collectionNameDao"
+	"github.com/paper-trade-chatbot/be-product/dao/productDao"
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+	"github.com/paper-trade-chatbot/be-product/service/grpcError"
+	"github.com/paper-trade-chatbot/be-proto/general"
+	"github.com/paper-trade-chatbot/be-proto/product"
+	"gorm.io/gorm"
+)
+
+type Collection struct {
+	ID          int64
+	Code        string
+	Title       string
+	Description string
+	// Locale is the locale Title and Description were taken from, empty for
+	// the default title
+	Locale    string
+	Status    product.Status
+	Display   product.Display
+	CreatedAt int64
+	UpdatedAt int64
+}
+
+type LocalizedCollectionName struct {
+	Locale      string
+	Title       string
+	Description string
+}
+
+type CreateCollectionReq struct {
+	Code        string
+	Title       string
+	Description string
+	Name        []*LocalizedCollectionName
+	Status      product.Status
+	Display     product.Display
+}
+
+type CreateCollectionRes struct {
+	ID int64
+}
+
+type GetCollectionReq struct {
+	ID     int64
+	Code   string
+	Locale string
+}
+
+type GetCollectionRes struct {
+	Collection *Collection
+	Name       []*LocalizedCollectionName
+}
+
+type GetCollectionsReq struct {
+	Status  *product.Status
+	Display *product.Display
+	Locale  string
+}
+
+type GetCollectionsRes struct {
+	Collection []*Collection
+}
+
+type ModifyCollectionReq struct {
+	ID          int64
+	Title       *string
+	Description *string
+	Status      *product.Status
+	Display     *product.Display
+	// Name is upserted by locale, the other locales are kept
+	Name []*LocalizedCollectionName
+}
+
+type ModifyCollectionRes struct{}
+
+type DeleteCollectionReq struct {
+	ID int64
+}
+
+type DeleteCollectionRes struct{}
+
+type SetCollectionMembersReq struct {
+	CollectionID int64
+	// ProductID is the new member list, in display order
+	ProductID []int64
+}
+
+type SetCollectionMembersRes struct{}
+
+type GetCollectionMembersReq struct {
+	CollectionID int64
+	Locale       string
+	Pagination   *general.Pagination
+}
+
+type GetCollectionMembersRes struct {
+	Product        []*product.Product
+	ProductExt     []*ProductExt
+	PaginationInfo *general.PaginationInfo
+}
+
+func (impl *ProductImpl) CreateCollection(ctx context.Context, in *CreateCollectionReq) (*CreateCollectionRes, error) {
+	db := database.GetDB()
+
+	logging.Info(ctx, "[CreateCollection] %s", in.Code)
+
+	code := strings.TrimSpace(in.Code)
+	title := strings.TrimSpace(in.Title)
+	v := grpcError.Violations{}
+	if code == "" {
+		v.Add("code", "is required")
+	}
+	if title == "" {
+		v.Add("title", "is required")
+	}
+	names := collectionNameModels(&v, in.Name)
+	if err := v.InvalidArgument(); err != nil {
+		return nil, err
+	}
+
+	taken, err := collectionDao.Get(db, &collectionDao.QueryModel{Code: code})
+	if err != nil {
+		return nil, err
+	}
+	if taken != nil {
+		return nil, grpcError.AlreadyExists("code", "%s is used by collection %d", code, taken.ID)
+	}
+
+	if in.Status == 0 {
+		in.Status = 1
+	}
+	if in.Display == 0 {
+		in.Display = 1
+	}
+
+	var id uint64
+	err = database.Transaction(db, func(tx *gorm.DB) error {
+		id, err = collectionDao.New(tx, &models.CollectionModel{
+			Code:        code,
+			Title:       title,
+			Description: strings.TrimSpace(in.Description),
+			Status:      int(in.Status),
+			Display:     int(in.Display),
+		})
+		if err != nil {
+			return err
+		}
+		for _, n := range names {
+			n.CollectionID = id
+			if err := collectionNameDao.Upsert(tx, n); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &CreateCollectionRes{
+		ID: int64(id),
+	}, nil
+}
+
+func (impl *ProductImpl) GetCollection(ctx context.Context, in *GetCollectionReq) (*GetCollectionRes, error) {
+	db := database.GetDB()
+
+	if in.ID == 0 && in.Code == "" {
+		return nil, grpcError.InvalidArgument("collection", "id or code is required")
+	}
+
+	model, err := collectionDao.Get(db, &collectionDao.QueryModel{
+		ID:   uint64(in.ID),
+		Code: strings.TrimSpace(in.Code),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if model == nil {
+		if in.ID != 0 {
+			return nil, grpcError.NotFound("collection", in.ID)
+		}
+		return nil, grpcError.NotFound("collection", strings.TrimSpace(in.Code))
+	}
+
+	nameModels, err := collectionNameDao.Gets(db, &collectionNameDao.QueryModel{CollectionID: model.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]*LocalizedCollectionName, 0, len(nameModels))
+	for _, n := range nameModels {
+		names = append(names, &LocalizedCollectionName{
+			Locale:      n.Locale,
+			Title:       n.Title,
+			Description: n.Description,
+		})
+	}
+
+	return &GetCollectionRes{
+		Collection: collectionModelToService(model, localizeCollectionName(nameModels, in.Locale)),
+		Name:       names,
+	}, nil
+}
+
+func (impl *ProductImpl) GetCollections(ctx context.Context, in *GetCollectionsReq) (*GetCollectionsRes, error) {
+	db := database.GetDB()
+
+	queryModel := &collectionDao.QueryModel{}
+	if in.Status != nil {
+		queryModel.Status = int(*in.Status)
+	}
+	if in.Display != nil {
+		queryModel.Display = int(*in.Display)
+	}
+
+	collectionModels, err := collectionDao.Gets(db, queryModel)
+	if err != nil {
+		return nil, err
+	}
+
+	collections := make([]*Collection, 0, len(collectionModels))
+	if len(collectionModels) == 0 {
+		return &GetCollectionsRes{
+			Collection: collections,
+		}, nil
+	}
+
+	ids := make([]uint64, 0, len(collectionModels))
+	for _, c := range collectionModels {
+		ids = append(ids, c.ID)
+	}
+	nameModels, err := collectionNameDao.Gets(db, &collectionNameDao.QueryModel{
+		CollectionIDs: ids,
+		Locales:       localeFallbacks(in.Locale),
+	})
+	if err != nil {
+		return nil, err
+	}
+	namesByCollection := map[uint64][]models.CollectionNameModel{}
+	for _, n := range nameModels {
+		namesByCollection[n.CollectionID] = append(namesByCollection[n.CollectionID], n)
+	}
+
+	for i := range collectionModels {
+		c := &collectionModels[i]
+		collections = append(collections, collectionModelToService(c, localizeCollectionName(namesByCollection[c.ID], in.Locale)))
+	}
+
+	return &GetCollectionsRes{
+		Collection: collections,
+	}, nil
+}
+
+func (impl *ProductImpl) ModifyCollection(ctx context.Context, in *ModifyCollectionReq) (*ModifyCollectionRes, error) {
+	db := database.GetDB()
+
+	logging.Info(ctx, "[ModifyCollection] %d", in.ID)
+
+	v := grpcError.Violations{}
+	if in.ID == 0 {
+		v.Add("id", "is required")
+	}
+	names := collectionNameModels(&v, in.Name)
+	if err := v.InvalidArgument(); err != nil {
+		return nil, err
+	}
+
+	model, err := collectionDao.Get(db, &collectionDao.QueryModel{ID: uint64(in.ID)})
+	if err != nil {
+		return nil, err
+	}
+	if model == nil {
+		return nil, grpcError.NotFound("collection", in.ID)
+	}
+
+	updates := map[string]interface{}{}
+	if in.Title != nil {
+		title := strings.TrimSpace(*in.Title)
+		if title == "" {
+			return nil, grpcError.InvalidArgument("title", "must not be empty")
+		}
+		updates["title"] = title
+	}
+	if in.Description != nil {
+		updates["description"] = strings.TrimSpace(*in.Description)
+	}
+	if in.Status != nil {
+		updates["status"] = int(*in.Status)
+	}
+	if in.Display != nil {
+		updates["display"] = int(*in.Display)
+	}
+
+	err = database.Transaction(db, func(tx *gorm.DB) error {
+		if len(updates) > 0 {
+			if err := collectionDao.Modify(tx, model, updates); err != nil {
+				return err
+			}
+		}
+		for _, n := range names {
+			n.CollectionID = model.ID
+			if err := collectionNameDao.Upsert(tx, n); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ModifyCollectionRes{}, nil
+}
+
+// DeleteCollection deletes the collection with its names and members, the
+// products themselves are untouched.
+func (impl *ProductImpl) DeleteCollection(ctx context.Context, in *DeleteCollectionReq) (*DeleteCollectionRes, error) {
+	db := database.GetDB()
+
+	logging.Info(ctx, "[DeleteCollection] %d", in.ID)
+
+	if in.ID == 0 {
+		return nil, grpcError.InvalidArgument("id", "is required")
+	}
+
+	model, err := collectionDao.Get(db, &collectionDao.QueryModel{ID: uint64(in.ID)})
+	if err != nil {
+		return nil, err
+	}
+	if model == nil {
+		return nil, grpcError.NotFound("collection", in.ID)
+	}
+
+	var changed []*models.ProductModel
+	err = database.Transaction(db, func(tx *gorm.DB) error {
+		members, err := collectionMemberDao.Gets(tx, &collectionMemberDao.QueryModel{CollectionID: model.ID})
+		if err != nil {
+			return err
+		}
+		if err := collectionDao.Delete(tx, model); err != nil {
+			return err
+		}
+
+		ids := make([]uint64, 0, len(members))
+		for _, m := range members {
+			ids = append(ids, m.ProductID)
+		}
+		changed, err = touchMembers(tx, ids, model.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	impl.productsChanged(ctx, changed...)
+
+	return &DeleteCollectionRes{}, nil
+}
+
+// touchMembers records the change of the membership of the collection on the
+// products joining or leaving it.
+func touchMembers(tx *gorm.DB, productIDs []uint64, collectionID uint64) ([]*models.ProductModel, error) {
+	if len(productIDs) == 0 {
+		return nil, nil
+	}
+	productModels, err := productDao.Gets(tx, &productDao.QueryModel{IDs: productIDs})
+	if err != nil {
+		return nil, err
+	}
+	return touchProducts(tx, productModels, map[string]interface{}{
+		"collectionID": collectionID,
+	})
+}
+
+// SetCollectionMembers replaces the members of the collection, keeping the
+// order of the request.
+func (impl *ProductImpl) SetCollectionMembers(ctx context.Context, in *SetCollectionMembersReq) (*SetCollectionMembersRes, error) {
+	db := database.GetDB()
+
+	logging.Info(ctx, "[SetCollectionMembers] collection %d, %d members", in.CollectionID, len(in.ProductID))
+
+	if in.CollectionID == 0 {
+		return nil, grpcError.InvalidArgument("collectionID", "is required")
+	}
+
+	model, err := collectionDao.Get(db, &collectionDao.QueryModel{ID: uint64(in.CollectionID)})
+	if err != nil {
+		return nil, err
+	}
+	if model == nil {
+		return nil, grpcError.NotFound("collection", in.CollectionID)
+	}
+
+	ids := []uint64{}
+	seen := map[uint64]bool{}
+	for _, id := range in.ProductID {
+		if id == 0 || seen[uint64(id)] {
+			continue
+		}
+		seen[uint64(id)] = true
+		ids = append(ids, uint64(id))
+	}
+
+	var changed []*models.ProductModel
+	err = database.Transaction(db, func(tx *gorm.DB) error {
+		if len(ids) > 0 {
+			productModels, err := productDao.Gets(tx, &productDao.QueryModel{IDs: ids})
+			if err != nil {
+				return err
+			}
+			if len(productModels) != len(ids) {
+				return grpcError.NotFound("product", missingProduct(ids, productModels))
+			}
+		}
+
+		// the products leaving the collection change as well
+		previous, err := collectionMemberDao.Gets(tx, &collectionMemberDao.QueryModel{CollectionID: model.ID})
+		if err != nil {
+			return err
+		}
+
+		if err := collectionMemberDao.Delete(tx, &collectionMemberDao.QueryModel{CollectionID: model.ID}); err != nil {
+			return err
+		}
+		for i, id := range ids {
+			if _, err := collectionMemberDao.New(tx, &models.CollectionMemberModel{
+				CollectionID: model.ID,
+				ProductID:    id,
+				SortOrder:    i + 1,
+			}); err != nil {
+				return err
+			}
+		}
+
+		members := append([]uint64{}, ids...)
+		for _, m := range previous {
+			if !seen[m.ProductID] {
+				members = append(members, m.ProductID)
+			}
+		}
+		changed, err = touchMembers(tx, members, model.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	impl.productsChanged(ctx, changed...)
+
+	return &SetCollectionMembersRes{}, nil
+}
+
+// GetCollectionMembers pages through the members in collection order, with
+// the same product payload as GetProducts.
+func (impl *ProductImpl) GetCollectionMembers(ctx context.Context, in *GetCollectionMembersReq) (*GetCollectionMembersRes, error) {
+	db := database.GetDB()
+
+	if in.CollectionID == 0 {
+		return nil, grpcError.InvalidArgument("collectionID", "is required")
+	}
+	if err := checkPagination(in.Pagination); err != nil {
+		return nil, err
+	}
+
+	members, paginationInfo, err := collectionMemberDao.GetsWithPagination(db, &collectionMemberDao.QueryModel{
+		CollectionID:     uint64(in.CollectionID),
+		ExistingProducts: true,
+	}, in.Pagination)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &GetCollectionMembersRes{
+		Product:        []*product.Product{},
+		ProductExt:     []*ProductExt{},
+		PaginationInfo: paginationInfo,
+	}
+	if len(members) == 0 {
+		return res, nil
+	}
+
+	ids := make([]uint64, 0, len(members))
+	for _, m := range members {
+		ids = append(ids, m.ProductID)
+	}
+
+	productModels, err := productDao.Gets(db, &productDao.QueryModel{IDs: ids})
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uint64]*models.ProductModel, len(productModels))
+	for i := range productModels {
+		byID[productModels[i].ID] = &productModels[i]
+	}
+
+	names, err := impl.localizeNames(db, ids, in.Locale)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		m, ok := byID[id]
+		if !ok {
+			continue
+		}
+		p := productModelToGrpc(m)
+		pExt := productModelToExt(m)
+		applyLocalizedName(p, pExt, names[id])
+		res.Product = append(res.Product, p)
+		res.ProductExt = append(res.ProductExt, pExt)
+	}
+	if err := impl.applyExchange(ctx, db, res.Product, res.ProductExt); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// collectionNameModels validates the localized names of a request
+func collectionNameModels(v *grpcError.Violations, names []*LocalizedCollectionName) []*models.CollectionNameModel {
+	result := make([]*models.CollectionNameModel, 0, len(names))
+	for i, n := range names {
+		if n == nil || strings.TrimSpace(n.Title) == "" {
+			v.Add(fmt.Sprintf("name[%d].title", i), "is required")
+			continue
+		}
+		locale, err := canonicalLocale(n.Locale)
+		if err != nil {
+			v.Add(fmt.Sprintf("name[%d].locale", i), "%q is not a BCP 47 tag", n.Locale)
+			continue
+		}
+		result = append(result, &models.CollectionNameModel{
+			Locale:      locale,
+			Title:       strings.TrimSpace(n.Title),
+			Description: strings.TrimSpace(n.Description),
+		})
+	}
+	return result
+}
+
+// localizeCollectionName picks the best name among the names of one collection
+func localizeCollectionName(names []models.CollectionNameModel, locale string) *models.CollectionNameModel {
+	for _, f := range localeFallbacks(locale) {
+		for i := range names {
+			if names[i].Locale == f {
+				return &names[i]
+			}
+		}
+	}
+	return nil
+}
+
+func collectionModelToService(model *models.CollectionModel, name *models.CollectionNameModel) *Collection {
+	c := &Collection{
+		ID:          int64(model.ID),
+		Code:        model.Code,
+		Title:       model.Title,
+		Description: model.Description,
+		Status:      product.Status(model.Status),
+		Display:     product.Display(model.Display),
+		CreatedAt:   model.CreatedAt.Unix(),
+		UpdatedAt:   model.UpdatedAt.Unix(),
+	}
+	if name != nil {
+		c.Title = name.Title
+		c.Description = name.Description
+		c.Locale = name.Locale
+	}
+	return c
+}
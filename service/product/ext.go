@@ -0,0 +1,160 @@
+package product
+
+import (
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+	"github.com/paper-trade-chatbot/be-proto/product"
+)
+
+// The Ext types carry fields of existing messages that are not in the
+// be-proto release pinned in go.mod yet. The generated handlers call their
+// *WithExt variant with a nil ext, so moving a field into be-proto only means
+// reading it from the generated message instead.
+//
+// None of this is on the wire. The be-proto release pinned in go.mod is not
+// bumped by these changes, so main.go registers only the seven RPCs of
+// product.ProductServiceServer: GetExchange, GetExchanges, CreateProduct,
+// GetProduct, GetProducts, ModifyProduct and DeleteProduct. The Ext fields
+// and every other method of ProductIntf, with their Req/Res types, are an
+// in-process API until the matching messages and RPCs are added to be-proto
+// and the dependency is bumped.
+
+// CreateProductExt extends CreateProductReq.
+type CreateProductExt struct {
+	Identifiers *SecurityIdentifiers
+	ListedAt    *int64 // unix time
+	DelistedAt  *int64 // unix time
+	// CreateProductReq has the currency, tick unit and minimum order, left
+	// empty they are inherited from the exchange.
+	LotSize        *float64
+	PriceLimitRule *PriceLimitRule
+	// Priority is the custom sort order, see ProductSortField_Priority
+	Priority int32
+}
+
+// GetProductExt extends GetProductReq.
+type GetProductExt struct {
+	// Identifier is the oneof variant next to GetProductReq_Id and GetProductReq_Code.
+	Identifier *SecurityIdentifier
+	// Locale picks the localized name, falling back to defaultLocale.
+	Locale string
+	// IncludeProfile adds the company profile to ProductExt.
+	IncludeProfile bool
+}
+
+// GetProductsExt extends GetProductsReq.
+type GetProductsExt struct {
+	Locale string
+	// TaxonomyID matches the products of the node and of every node below it
+	TaxonomyID int64
+	// Tag matches the products carrying the tag
+	Tag string
+	// ListedWithinDays matches the products listed in the last N days
+	ListedWithinDays int32
+	// DelistingWithinDays matches the products to be delisted in the next N days
+	DelistingWithinDays int32
+	// CurrencyCodes match the currency of the products, inherited from their
+	// exchange when they have none
+	CurrencyCodes []string
+	// Statuses match the effective status, on top of GetProductsReq.Status
+	Statuses []product.Status
+	// Search matches the code or the name by prefix, anywhere in them with
+	// SearchContains
+	Search         string
+	SearchContains bool
+	// UpdatedSince matches the products updated at or after it, unix time
+	UpdatedSince int64
+	// Sort orders the products, then by id. They are ordered by id alone when
+	// it is empty.
+	Sort []ProductSort
+	// Page replaces GetProductsReq.Pagination by a cursor
+	Page *CursorPage
+}
+
+// ModifyProductExt extends ModifyProductReq.
+type ModifyProductExt struct {
+	Name        *string
+	Identifiers *SecurityIdentifiers
+	ListedAt    *int64 // unix time, 0 clears it
+	DelistedAt  *int64 // unix time, 0 clears it
+	Trading     *TradingOverride
+	Priority    *int32
+}
+
+// ProductExt extends Product.
+type ProductExt struct {
+	Identifiers *SecurityIdentifiers
+	// LocalizedName is the name Product.Name was taken from, nil when the
+	// product has no localized name.
+	LocalizedName *LocalizedName
+	TaxonomyID    *int64
+	ListedAt      *int64
+	DelistedAt    *int64
+	// Product.Status and Product.Display are the effective values, taking the
+	// exchange into account, ProductStatus and ProductDisplay are the ones
+	// set on the product itself.
+	ProductStatus  product.Status
+	ProductDisplay product.Display
+	// Trading has the effective trading attributes, Product.CurrencyCode,
+	// Product.TickUnit and Product.MinimumOrder are taken from it.
+	Trading *TradingAttributes
+	// Profile is only set by GetProductWithExt with IncludeProfile, and nil
+	// when the product has no profile.
+	Profile  *ProductProfile
+	Priority int32
+}
+
+type GetProductExtRes struct {
+	*product.GetProductRes
+	ProductExt *ProductExt
+}
+
+type GetProductsExtRes struct {
+	*product.GetProductsRes
+	// ProductExt is parallel to GetProductsRes.Product
+	ProductExt []*ProductExt
+	// PageResult is set instead of GetProductsRes.PaginationInfo for a Page
+	PageResult *CursorPageResult
+}
+
+// GetExchangesExt extends GetExchangesReq.
+type GetExchangesExt struct {
+	// Page replaces GetExchangesReq.Pagination by a cursor
+	Page *CursorPage
+}
+
+type GetExchangesExtRes struct {
+	*product.GetExchangesRes
+	// PageResult is set instead of GetExchangesRes.PaginationInfo for a Page
+	PageResult *CursorPageResult
+}
+
+// applyLocalizedName replaces the product name with its localized long name.
+func applyLocalizedName(p *product.Product, ext *ProductExt, name *LocalizedName) {
+	if name == nil {
+		return
+	}
+	p.Name = name.LongName
+	ext.LocalizedName = name
+}
+
+func productModelToExt(model *models.ProductModel) *ProductExt {
+	var taxonomyID *int64
+	if model.TaxonomyID.Valid {
+		id := model.TaxonomyID.Int64
+		taxonomyID = &id
+	}
+
+	return &ProductExt{
+		TaxonomyID: taxonomyID,
+		Trading:    productTradingAttributes(model),
+		ListedAt:   nullTimeToUnix(model.ListedAt),
+		DelistedAt: nullTimeToUnix(model.DelistedAt),
+		Priority:   int32(model.Priority),
+		Identifiers: &SecurityIdentifiers{
+			ISIN:  fromNullString(model.ISIN),
+			CUSIP: fromNullString(model.CUSIP),
+			SEDOL: fromNullString(model.SEDOL),
+			FIGI:  fromNullString(model.FIGI),
+		},
+	}
+}
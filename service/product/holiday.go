@@ -0,0 +1,250 @@
+package product
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-common/database"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"github.com/paper-trade-chatbot/be-product/dao/exchangeDao"
+	"github.com/paper-trade-chatbot/be-product/dao/exchangeHolidayDao"
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+	"github.com/paper-trade-chatbot/be-product/service/grpcError"
+)
+
+const (
+	holidayDateLayout     = "2006-01-02"
+	holidayClockLayout    = "15:04"
+	holidayNameMaxLength  = 32
+	holidayMemoMaxLength  = 128
+	holidayMaxDays        = 31
+	holidayDefaultHistory = 30 * 24 * time.Hour
+)
+
+type HolidayType string
+
+const (
+	HolidayType_FullDay HolidayType = HolidayType(models.ExchangeHolidayType_FullDay)
+	HolidayType_HalfDay HolidayType = HolidayType(models.ExchangeHolidayType_HalfDay)
+)
+
+type ExchangeHoliday struct {
+	ExchangeCode string
+	Date         string // 2006-01-02
+	// EndDate is the last day of a holiday of several days
+	EndDate *string
+	Type    HolidayType
+	Name    string
+	// HalfDayCloseTime is the local close of a half day, 15:04
+	HalfDayCloseTime *string
+	Memo             *string
+}
+
+type SetExchangeHolidayReq struct {
+	Holiday *ExchangeHoliday
+}
+
+type SetExchangeHolidayRes struct{}
+
+type DeleteExchangeHolidayReq struct {
+	ExchangeCode string
+	Date         string
+}
+
+type DeleteExchangeHolidayRes struct{}
+
+type GetExchangeHolidaysReq struct {
+	ExchangeCode string
+	// From keeps the holidays ending on or after it, 30 days ago when empty
+	From string
+}
+
+type GetExchangeHolidaysRes struct {
+	Holiday []*ExchangeHoliday
+}
+
+// SetExchangeHoliday adds the holiday of an exchange starting on its date, or
+// replaces the one already starting on that date.
+func (impl *ProductImpl) SetExchangeHoliday(ctx context.Context, in *SetExchangeHolidayReq) (*SetExchangeHolidayRes, error) {
+	db := database.GetDB()
+
+	h := in.Holiday
+	if h == nil {
+		return nil, grpcError.InvalidArgument("holiday", "is required")
+	}
+	logging.Info(ctx, "[SetExchangeHoliday] %s %s %s", h.ExchangeCode, h.Date, h.Type)
+
+	v := grpcError.Violations{}
+	model := &models.ExchangeHolidayModel{
+		Name: strings.TrimSpace(h.Name),
+		Type: models.ExchangeHolidayType(h.Type),
+		Memo: toNullString(strings.TrimSpace(fromOptional(h.Memo))),
+	}
+
+	date, ok := parseHolidayDate(h.Date)
+	if !ok {
+		v.Add("date", "%q is not a date", h.Date)
+	}
+	model.Date = date
+	if h.EndDate != nil && *h.EndDate != "" {
+		endDate, ok := parseHolidayDate(*h.EndDate)
+		switch {
+		case !ok:
+			v.Add("endDate", "%q is not a date", *h.EndDate)
+		case endDate.Before(date) || endDate.After(date.AddDate(0, 0, holidayMaxDays)):
+			v.Add("endDate", "must be within %d days from date", holidayMaxDays)
+		}
+		model.EndDate = sql.NullTime{Time: endDate, Valid: true}
+	}
+
+	switch h.Type {
+	case HolidayType_FullDay:
+		if h.HalfDayCloseTime != nil {
+			v.Add("halfDayCloseTime", "only for a half day")
+		}
+	case HolidayType_HalfDay:
+		if h.HalfDayCloseTime != nil {
+			closeAt, err := time.ParseInLocation(holidayClockLayout, *h.HalfDayCloseTime, time.Local)
+			if err != nil {
+				v.Add("halfDayCloseTime", "%q is not a time, e.g. 12:30", *h.HalfDayCloseTime)
+			}
+			// a TIMESTAMP cannot hold year 0, only the clock is used
+			model.HalfDayCloseTime = sql.NullTime{Time: closeAt.AddDate(2000, 0, 0), Valid: true}
+		}
+	default:
+		v.Add("type", "must be %s or %s", HolidayType_FullDay, HolidayType_HalfDay)
+	}
+
+	if model.Name == "" || len(model.Name) > holidayNameMaxLength {
+		v.Add("name", "must be 1 to %d characters", holidayNameMaxLength)
+	}
+	if len(model.Memo.String) > holidayMemoMaxLength {
+		v.Add("memo", "longer than %d", holidayMemoMaxLength)
+	}
+	if err := v.InvalidArgument(); err != nil {
+		return nil, err
+	}
+
+	if h.ExchangeCode == "" {
+		return nil, grpcError.NotFound("exchange", h.ExchangeCode)
+	}
+	exchange, err := exchangeDao.Get(db, &exchangeDao.QueryModel{Code: h.ExchangeCode})
+	if err != nil {
+		return nil, err
+	}
+	if exchange == nil {
+		return nil, grpcError.NotFound("exchange", h.ExchangeCode)
+	}
+	model.ExchangeID = exchange.ID
+
+	if err := exchangeHolidayDao.Upsert(db, model, exchange.Code); err != nil {
+		return nil, err
+	}
+	impl.exchangesChanged(ctx, exchange.Code)
+
+	return &SetExchangeHolidayRes{}, nil
+}
+
+func (impl *ProductImpl) DeleteExchangeHoliday(ctx context.Context, in *DeleteExchangeHolidayReq) (*DeleteExchangeHolidayRes, error) {
+	db := database.GetDB()
+
+	logging.Info(ctx, "[DeleteExchangeHoliday] %s %s", in.ExchangeCode, in.Date)
+
+	date, ok := parseHolidayDate(in.Date)
+	if !ok {
+		return nil, grpcError.InvalidArgument("date", "%q is not a date", in.Date)
+	}
+
+	if in.ExchangeCode == "" {
+		return nil, grpcError.NotFound("exchange", in.ExchangeCode)
+	}
+	exchange, err := exchangeDao.Get(db, &exchangeDao.QueryModel{Code: in.ExchangeCode})
+	if err != nil {
+		return nil, err
+	}
+	if exchange == nil {
+		return nil, grpcError.NotFound("exchange", in.ExchangeCode)
+	}
+
+	deleted, err := exchangeHolidayDao.Delete(db, exchange.ID, date, exchange.Code)
+	if err != nil {
+		return nil, err
+	}
+	if !deleted {
+		return nil, grpcError.NotFound("holiday", exchange.Code+":"+in.Date)
+	}
+	impl.exchangesChanged(ctx, exchange.Code)
+
+	return &DeleteExchangeHolidayRes{}, nil
+}
+
+func (impl *ProductImpl) GetExchangeHolidays(ctx context.Context, in *GetExchangeHolidaysReq) (*GetExchangeHolidaysRes, error) {
+	db := database.GetDB()
+
+	from := time.Now().Add(-holidayDefaultHistory)
+	if in.From != "" {
+		var ok bool
+		if from, ok = parseHolidayDate(in.From); !ok {
+			return nil, grpcError.InvalidArgument("from", "%q is not a date", in.From)
+		}
+	}
+
+	if in.ExchangeCode == "" {
+		return nil, grpcError.NotFound("exchange", in.ExchangeCode)
+	}
+	exchange, err := exchangeDao.Get(db, &exchangeDao.QueryModel{Code: in.ExchangeCode})
+	if err != nil {
+		return nil, err
+	}
+	if exchange == nil {
+		return nil, grpcError.NotFound("exchange", in.ExchangeCode)
+	}
+
+	holidays, err := exchangeHolidayDao.Gets(db, &exchangeHolidayDao.QueryModel{
+		ExchangeID: exchange.ID,
+		EndsFrom:   from,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*ExchangeHoliday, 0, len(holidays))
+	for _, h := range holidays {
+		holiday := &ExchangeHoliday{
+			ExchangeCode: exchange.Code,
+			Date:         h.Date.Format(holidayDateLayout),
+			Type:         HolidayType(h.Type),
+			Name:         h.Name,
+			Memo:         fromNullString(h.Memo),
+		}
+		if h.EndDate.Valid {
+			endDate := h.EndDate.Time.Format(holidayDateLayout)
+			holiday.EndDate = &endDate
+		}
+		if h.HalfDayCloseTime.Valid {
+			closeAt := h.HalfDayCloseTime.Time.Format(holidayClockLayout)
+			holiday.HalfDayCloseTime = &closeAt
+		}
+		result = append(result, holiday)
+	}
+
+	return &GetExchangeHolidaysRes{
+		Holiday: result,
+	}, nil
+}
+
+// parseHolidayDate reads a date the way the driver writes a DATE, in the
+// local time zone
+func parseHolidayDate(value string) (time.Time, bool) {
+	date, err := time.ParseInLocation(holidayDateLayout, value, time.Local)
+	return date, err == nil
+}
+
+func fromOptional(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
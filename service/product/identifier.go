@@ -0,0 +1,339 @@
+package product
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/paper-trade-chatbot/be-product/dao/productDao"
+	"github.com/paper-trade-chatbot/be-product/service/grpcError"
+	"gorm.io/gorm"
+)
+
+type SecurityIdentifierType int
+
+const (
+	SecurityIdentifierType_None SecurityIdentifierType = iota
+	SecurityIdentifierType_ISIN
+	SecurityIdentifierType_CUSIP
+	SecurityIdentifierType_SEDOL
+	SecurityIdentifierType_FIGI
+)
+
+type SecurityIdentifier struct {
+	Type  SecurityIdentifierType
+	Value string
+}
+
+// SecurityIdentifiers are the optional global identifiers of a product.
+// A nil field is left untouched, an empty string clears the identifier.
+type SecurityIdentifiers struct {
+	ISIN  *string
+	CUSIP *string
+	SEDOL *string
+	FIGI  *string
+}
+
+// normalize upper-cases every identifier and validates its check digit, it
+// reports every invalid identifier at once.
+func (ids *SecurityIdentifiers) normalize() error {
+	if ids == nil {
+		return nil
+	}
+
+	violations := grpcError.Violations{}
+	for _, f := range []struct {
+		field    string
+		value    **string
+		validate func(string) error
+	}{
+		{"identifiers.isin", &ids.ISIN, validateISIN},
+		{"identifiers.cusip", &ids.CUSIP, validateCUSIP},
+		{"identifiers.sedol", &ids.SEDOL, validateSEDOL},
+		{"identifiers.figi", &ids.FIGI, validateFIGI},
+	} {
+		if *f.value == nil {
+			continue
+		}
+		v := strings.ToUpper(strings.TrimSpace(**f.value))
+		*f.value = &v
+		if v == "" {
+			continue
+		}
+		if err := f.validate(v); err != nil {
+			violations.Add(f.field, "%v", err)
+		}
+	}
+	return violations.InvalidArgument()
+}
+
+// updates returns the product columns to write for the identifiers that are set.
+func (ids *SecurityIdentifiers) updates() map[string]interface{} {
+	updates := map[string]interface{}{}
+	if ids == nil {
+		return updates
+	}
+
+	for column, value := range map[string]*string{
+		"isin":  ids.ISIN,
+		"cusip": ids.CUSIP,
+		"sedol": ids.SEDOL,
+		"figi":  ids.FIGI,
+	} {
+		if value != nil {
+			updates[column] = toNullString(*value)
+		}
+	}
+	return updates
+}
+
+// identifierValue returns the value of the identifier if it is set and not empty.
+func identifierValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+func toNullString(value string) sql.NullString {
+	return sql.NullString{
+		String: value,
+		Valid:  value != "",
+	}
+}
+
+func fromNullString(value sql.NullString) *string {
+	if !value.Valid {
+		return nil
+	}
+	v := value.String
+	return &v
+}
+
+// alphanumericValue maps 0-9 to 0-9 and A-Z to 10-35.
+func alphanumericValue(c byte) (int, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0'), true
+	case c >= 'A' && c <= 'Z':
+		return int(c-'A') + 10, true
+	}
+	return 0, false
+}
+
+// validateISIN checks the 2 letter country prefix and the Luhn check digit
+// over the letter-expanded digits, e.g. TW0002330008.
+func validateISIN(isin string) error {
+	if len(isin) != 12 {
+		return fmt.Errorf("isin %s: length must be 12", isin)
+	}
+	if isin[0] < 'A' || isin[0] > 'Z' || isin[1] < 'A' || isin[1] > 'Z' {
+		return fmt.Errorf("isin %s: invalid country code", isin)
+	}
+
+	digits := make([]int, 0, 24)
+	for i := 0; i < 11; i++ {
+		v, ok := alphanumericValue(isin[i])
+		if !ok {
+			return fmt.Errorf("isin %s: invalid character %q", isin, isin[i])
+		}
+		if v >= 10 {
+			digits = append(digits, v/10)
+		}
+		digits = append(digits, v%10)
+	}
+
+	// Luhn, doubling from the rightmost digit since the check digit is excluded
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := digits[i]
+		if (len(digits)-1-i)%2 == 0 {
+			d *= 2
+		}
+		sum += d/10 + d%10
+	}
+
+	check := byte('0' + (10-sum%10)%10)
+	if isin[11] != check {
+		return fmt.Errorf("isin %s: check digit mismatch", isin)
+	}
+	return nil
+}
+
+// validateCUSIP checks the modulus 10 double-add-double check digit, e.g. 037833100.
+func validateCUSIP(cusip string) error {
+	if len(cusip) != 9 {
+		return fmt.Errorf("cusip %s: length must be 9", cusip)
+	}
+
+	sum := 0
+	for i := 0; i < 8; i++ {
+		v, ok := alphanumericValue(cusip[i])
+		if !ok {
+			switch cusip[i] {
+			case '*':
+				v = 36
+			case '@':
+				v = 37
+			case '#':
+				v = 38
+			default:
+				return fmt.Errorf("cusip %s: invalid character %q", cusip, cusip[i])
+			}
+		}
+		if i%2 == 1 {
+			v *= 2
+		}
+		sum += v/10 + v%10
+	}
+
+	check := byte('0' + (10-sum%10)%10)
+	if cusip[8] != check {
+		return fmt.Errorf("cusip %s: check digit mismatch", cusip)
+	}
+	return nil
+}
+
+// validateSEDOL checks the weighted check digit, vowels are not allowed, e.g. 0263494.
+func validateSEDOL(sedol string) error {
+	if len(sedol) != 7 {
+		return fmt.Errorf("sedol %s: length must be 7", sedol)
+	}
+
+	weights := []int{1, 3, 1, 7, 3, 9}
+	sum := 0
+	for i := 0; i < 6; i++ {
+		if strings.IndexByte("AEIOU", sedol[i]) >= 0 {
+			return fmt.Errorf("sedol %s: vowels are not allowed", sedol)
+		}
+		v, ok := alphanumericValue(sedol[i])
+		if !ok {
+			return fmt.Errorf("sedol %s: invalid character %q", sedol, sedol[i])
+		}
+		sum += v * weights[i]
+	}
+
+	check := byte('0' + (10-sum%10)%10)
+	if sedol[6] != check {
+		return fmt.Errorf("sedol %s: check digit mismatch", sedol)
+	}
+	return nil
+}
+
+// validateFIGI checks the OpenFIGI format and check digit, e.g. BBG000BLNNH6.
+func validateFIGI(figi string) error {
+	if len(figi) != 12 {
+		return fmt.Errorf("figi %s: length must be 12", figi)
+	}
+	switch figi[:2] {
+	case "BS", "BM", "GG", "GB", "GH", "KY", "VG":
+		return fmt.Errorf("figi %s: invalid prefix", figi)
+	}
+	if figi[2] != 'G' {
+		return fmt.Errorf("figi %s: third character must be G", figi)
+	}
+
+	sum := 0
+	for i := 0; i < 11; i++ {
+		if strings.IndexByte("AEIOU", figi[i]) >= 0 {
+			return fmt.Errorf("figi %s: vowels are not allowed", figi)
+		}
+		v, ok := alphanumericValue(figi[i])
+		if !ok {
+			return fmt.Errorf("figi %s: invalid character %q", figi, figi[i])
+		}
+		if i%2 == 1 {
+			v *= 2
+		}
+		sum += v/10 + v%10
+	}
+
+	check := byte('0' + (10-sum%10)%10)
+	if figi[11] != check {
+		return fmt.Errorf("figi %s: check digit mismatch", figi)
+	}
+	return nil
+}
+
+func (ids *SecurityIdentifiers) GetISIN() *string {
+	if ids == nil {
+		return nil
+	}
+	return ids.ISIN
+}
+
+func (ids *SecurityIdentifiers) GetCUSIP() *string {
+	if ids == nil {
+		return nil
+	}
+	return ids.CUSIP
+}
+
+func (ids *SecurityIdentifiers) GetSEDOL() *string {
+	if ids == nil {
+		return nil
+	}
+	return ids.SEDOL
+}
+
+func (ids *SecurityIdentifiers) GetFIGI() *string {
+	if ids == nil {
+		return nil
+	}
+	return ids.FIGI
+}
+
+// apply validates the identifier and sets it as a product query condition.
+func (id *SecurityIdentifier) apply(queryModel *productDao.QueryModel) error {
+	value := strings.ToUpper(strings.TrimSpace(id.Value))
+
+	switch id.Type {
+	case SecurityIdentifierType_ISIN:
+		queryModel.ISIN = value
+		return validateISIN(value)
+	case SecurityIdentifierType_CUSIP:
+		queryModel.CUSIP = value
+		return validateCUSIP(value)
+	case SecurityIdentifierType_SEDOL:
+		queryModel.SEDOL = value
+		return validateSEDOL(value)
+	case SecurityIdentifierType_FIGI:
+		queryModel.FIGI = value
+		return validateFIGI(value)
+	}
+	return fmt.Errorf("unknown identifier type %d", id.Type)
+}
+
+// checkIdentifiersAvailable makes sure no other product already holds one of the identifiers,
+// a deleted product keeps its identifiers.
+func checkIdentifiersAvailable(db *gorm.DB, ids *SecurityIdentifiers, productID uint64) error {
+	if ids == nil {
+		return nil
+	}
+
+	violations := grpcError.Violations{}
+	for _, f := range []struct {
+		field      string
+		queryModel *productDao.QueryModel
+	}{
+		{"identifiers.isin", &productDao.QueryModel{ISIN: identifierValue(ids.ISIN)}},
+		{"identifiers.cusip", &productDao.QueryModel{CUSIP: identifierValue(ids.CUSIP)}},
+		{"identifiers.sedol", &productDao.QueryModel{SEDOL: identifierValue(ids.SEDOL)}},
+		{"identifiers.figi", &productDao.QueryModel{FIGI: identifierValue(ids.FIGI)}},
+	} {
+		q := f.queryModel
+		if q.ISIN == "" && q.CUSIP == "" && q.SEDOL == "" && q.FIGI == "" {
+			continue
+		}
+		q.WithDeleted = true
+
+		model, err := productDao.Get(db, q)
+		if err != nil {
+			return err
+		}
+		if model != nil && model.ID != productID {
+			violations.Add(f.field, "already used by product %d", model.ID)
+		}
+	}
+	return violations.AlreadyExists()
+}
@@ -0,0 +1,97 @@
+package product
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-common/database"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"github.com/paper-trade-chatbot/be-product/dao/productDao"
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+)
+
+// lifecycleInterval is how late a product may be disabled after its delisted_at
+const lifecycleInterval = time.Minute
+
+// StartLifecycleJob disables delisted products until ctx is done. Every
+// replica runs it, Delist makes sure a product is only delisted once.
+func (impl *ProductImpl) StartLifecycleJob(ctx context.Context) {
+	ticker := time.NewTicker(lifecycleInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := impl.delistDue(ctx, time.Now()); err != nil {
+			logging.Error(ctx, "[StartLifecycleJob] err: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// delistDue disables every product whose delisted_at has passed, productDao
+// records a delisted event for each of them.
+func (impl *ProductImpl) delistDue(ctx context.Context, now time.Time) error {
+	db := database.GetDB()
+
+	due := map[uint64]models.ProductModel{}
+	for _, queryModel := range []*productDao.QueryModel{
+		{DelistedUntil: now, Status: 1},
+		{DelistedUntil: now, Display: 1},
+	} {
+		productModels, err := productDao.Gets(db, queryModel)
+		if err != nil {
+			return err
+		}
+		for _, m := range productModels {
+			due[m.ID] = m
+		}
+	}
+
+	delisted := make([]*models.ProductModel, 0, len(due))
+	defer func() {
+		impl.productsChanged(ctx, delisted...)
+	}()
+
+	for _, m := range due {
+		m := m
+		ok, err := productDao.Delist(db, &m, now)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		delisted = append(delisted, &m)
+
+		logging.Info(ctx, "[delistDue] product %d %s %s delisted at %v", m.ID, m.ExchangeCode, m.Code, m.DelistedAt.Time)
+
+		impl.refreshSearchIndex(ctx, m.ID)
+	}
+	return nil
+}
+
+// listingTime converts an optional unix time of a request, 0 clears it
+func listingTime(value *int64) sql.NullTime {
+	if value == nil || *value == 0 {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: time.Unix(*value, 0).UTC(), Valid: true}
+}
+
+// validListing checks that a product is not delisted before it is listed
+func validListing(listedAt, delistedAt sql.NullTime) bool {
+	return !listedAt.Valid || !delistedAt.Valid || delistedAt.Time.After(listedAt.Time)
+}
+
+func nullTimeToUnix(value sql.NullTime) *int64 {
+	if !value.Valid {
+		return nil
+	}
+	t := value.Time.Unix()
+	return &t
+}
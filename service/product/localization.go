@@ -0,0 +1,297 @@
+package product
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/paper-trade-chatbot/be-common/database"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"github.com/paper-trade-chatbot/be-product/dao/productAliasDao"
+	"github.com/paper-trade-chatbot/be-product/dao/productDao"
+	"github.com/paper-trade-chatbot/be-product/dao/productNameDao"
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+	"github.com/paper-trade-chatbot/be-product/service/grpcError"
+	"golang.org/x/text/language"
+	"gorm.io/gorm"
+)
+
+// defaultLocale is used when a product has no name in the requested locale
+const defaultLocale = "zh-TW"
+
+type LocalizedName struct {
+	Locale    string
+	ShortName string
+	LongName  string
+}
+
+type SetProductNamesReq struct {
+	ProductID int64
+	Name      []*LocalizedName
+}
+
+type SetProductNamesRes struct{}
+
+type SetProductAliasesReq struct {
+	ProductID int64
+	Alias     []string
+}
+
+type SetProductAliasesRes struct{}
+
+type GetProductNamesReq struct {
+	ProductID int64
+}
+
+type GetProductNamesRes struct {
+	Name  []*LocalizedName
+	Alias []string
+}
+
+func (impl *ProductImpl) SetProductNames(ctx context.Context, in *SetProductNamesReq) (*SetProductNamesRes, error) {
+	db := database.GetDB()
+
+	logging.Info(ctx, "[SetProductNames] product %d, %d names", in.ProductID, len(in.Name))
+
+	v := grpcError.Violations{}
+	if in.ProductID == 0 {
+		v.Add("productID", "is required")
+	}
+	if len(in.Name) == 0 {
+		v.Add("name", "is required")
+	}
+
+	names := make([]*models.ProductNameModel, 0, len(in.Name))
+	for i, n := range in.Name {
+		if n == nil || strings.TrimSpace(n.LongName) == "" {
+			v.Add(fmt.Sprintf("name[%d].longName", i), "is required")
+			continue
+		}
+		locale, err := canonicalLocale(n.Locale)
+		if err != nil {
+			logging.Info(ctx, "[SetProductNames] err: %v", err)
+			v.Add(fmt.Sprintf("name[%d].locale", i), "%q is not a BCP 47 tag", n.Locale)
+			continue
+		}
+
+		shortName := strings.TrimSpace(n.ShortName)
+		if shortName == "" {
+			shortName = strings.TrimSpace(n.LongName)
+		}
+		names = append(names, &models.ProductNameModel{
+			Locale:    locale,
+			ShortName: shortName,
+			LongName:  strings.TrimSpace(n.LongName),
+		})
+	}
+	if err := v.InvalidArgument(); err != nil {
+		return nil, err
+	}
+
+	model, err := productDao.Get(db, &productDao.QueryModel{ID: uint64(in.ProductID)})
+	if err != nil {
+		return nil, err
+	}
+	if model == nil {
+		return nil, grpcError.NotFound("product", in.ProductID)
+	}
+
+	err = database.Transaction(db, func(tx *gorm.DB) error {
+		locales := make([]string, 0, len(names))
+		for _, n := range names {
+			n.ProductID = model.ID
+			if err := productNameDao.Upsert(tx, n); err != nil {
+				return err
+			}
+			locales = append(locales, n.Locale)
+		}
+		if err := rebuildPhonetic(tx, model.ID); err != nil {
+			return err
+		}
+		return productDao.Touch(tx, model, map[string]interface{}{
+			"names": locales,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	impl.productsChanged(ctx, model)
+	impl.refreshSearchIndex(ctx, model.ID)
+
+	return &SetProductNamesRes{}, nil
+}
+
+// SetProductAliases replaces every alias of the product.
+func (impl *ProductImpl) SetProductAliases(ctx context.Context, in *SetProductAliasesReq) (*SetProductAliasesRes, error) {
+	db := database.GetDB()
+
+	logging.Info(ctx, "[SetProductAliases] product %d, %d aliases", in.ProductID, len(in.Alias))
+
+	if in.ProductID == 0 {
+		return nil, grpcError.InvalidArgument("productID", "is required")
+	}
+
+	model, err := productDao.Get(db, &productDao.QueryModel{ID: uint64(in.ProductID)})
+	if err != nil {
+		return nil, err
+	}
+	if model == nil {
+		return nil, grpcError.NotFound("product", in.ProductID)
+	}
+
+	aliases := []string{}
+	seen := map[string]bool{}
+	for _, a := range in.Alias {
+		a = strings.TrimSpace(a)
+		if a == "" || seen[strings.ToLower(a)] {
+			continue
+		}
+		seen[strings.ToLower(a)] = true
+		aliases = append(aliases, a)
+	}
+
+	err = database.Transaction(db, func(tx *gorm.DB) error {
+		if err := productAliasDao.Delete(tx, &productAliasDao.QueryModel{ProductID: model.ID}); err != nil {
+			return err
+		}
+		for _, a := range aliases {
+			if _, err := productAliasDao.New(tx, &models.ProductAliasModel{
+				ProductID: model.ID,
+				Alias:     a,
+			}); err != nil {
+				return err
+			}
+		}
+		if err := rebuildPhonetic(tx, model.ID); err != nil {
+			return err
+		}
+		return productDao.Touch(tx, model, map[string]interface{}{
+			"aliases": aliases,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	impl.productsChanged(ctx, model)
+	impl.refreshSearchIndex(ctx, model.ID)
+
+	return &SetProductAliasesRes{}, nil
+}
+
+func (impl *ProductImpl) GetProductNames(ctx context.Context, in *GetProductNamesReq) (*GetProductNamesRes, error) {
+	db := database.GetDB()
+
+	if in.ProductID == 0 {
+		return nil, grpcError.InvalidArgument("productID", "is required")
+	}
+
+	names, err := productNameDao.Gets(db, &productNameDao.QueryModel{ProductID: uint64(in.ProductID)})
+	if err != nil {
+		return nil, err
+	}
+	aliases, err := productAliasDao.Gets(db, &productAliasDao.QueryModel{ProductID: uint64(in.ProductID)})
+	if err != nil {
+		return nil, err
+	}
+
+	res := &GetProductNamesRes{
+		Name:  []*LocalizedName{},
+		Alias: []string{},
+	}
+	for _, n := range names {
+		res.Name = append(res.Name, &LocalizedName{
+			Locale:    n.Locale,
+			ShortName: n.ShortName,
+			LongName:  n.LongName,
+		})
+	}
+	for _, a := range aliases {
+		res.Alias = append(res.Alias, a.Alias)
+	}
+
+	return res, nil
+}
+
+// canonicalLocale formats a BCP 47 tag the way it is stored, e.g. zh-tw to zh-TW
+func canonicalLocale(locale string) (string, error) {
+	tag, err := language.Parse(strings.TrimSpace(locale))
+	if err != nil {
+		return "", err
+	}
+	return tag.String(), nil
+}
+
+// localeFallbacks lists the locales to try in order: the requested one, its
+// base language, then the default locale.
+func localeFallbacks(locale string) []string {
+	fallbacks := []string{}
+	if tag, err := language.Parse(strings.TrimSpace(locale)); err == nil {
+		fallbacks = append(fallbacks, tag.String())
+		if base, confidence := tag.Base(); confidence != language.No && base.String() != tag.String() {
+			fallbacks = append(fallbacks, base.String())
+		}
+	}
+	for _, f := range fallbacks {
+		if f == defaultLocale {
+			return fallbacks
+		}
+	}
+	return append(fallbacks, defaultLocale)
+}
+
+// localizeNames picks the best localized name of every product, products
+// without any name in the fallback locales are left out. The names come from
+// the catalog snapshot once it has the writes of this replica, those of the
+// products it does not know yet from the database.
+func (impl *ProductImpl) localizeNames(db *gorm.DB, productIDs []uint64, locale string) (map[uint64]*LocalizedName, error) {
+	result := map[uint64]*LocalizedName{}
+	if len(productIDs) == 0 {
+		return result, nil
+	}
+
+	fallbacks := localeFallbacks(locale)
+	names := []models.ProductNameModel{}
+	missing := productIDs
+	if snapshot := impl.catalog.Fresh(); snapshot != nil {
+		missing = []uint64{}
+		for _, id := range productIDs {
+			if n, ok := snapshot.Names(id); ok {
+				names = append(names, n...)
+			} else {
+				missing = append(missing, id)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		loaded, err := productNameDao.Gets(db, &productNameDao.QueryModel{
+			ProductIDs: missing,
+			Locales:    fallbacks,
+		})
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, loaded...)
+	}
+
+	rank := make(map[string]int, len(fallbacks))
+	for i, f := range fallbacks {
+		rank[f] = i
+	}
+	for _, n := range names {
+		r, ok := rank[n.Locale]
+		if !ok {
+			continue
+		}
+		if current, ok := result[n.ProductID]; ok && rank[current.Locale] <= r {
+			continue
+		}
+		result[n.ProductID] = &LocalizedName{
+			Locale:    n.Locale,
+			ShortName: n.ShortName,
+			LongName:  n.LongName,
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,293 @@
+package product
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-common/database"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"github.com/paper-trade-chatbot/be-product/dao/exchangeHolidayDao"
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+	"github.com/paper-trade-chatbot/be-product/service/calendar"
+	"github.com/paper-trade-chatbot/be-product/service/catalog"
+	"github.com/paper-trade-chatbot/be-product/service/grpcError"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultAdvanceWarning = 5 * time.Minute
+	maxAdvanceWarning     = 24 * time.Hour
+	maxAdvanceWarnings    = 10
+
+	// marketStatusHorizon is how long a stream waits at most before it works
+	// out its next event again.
+	marketStatusHorizon = time.Hour
+
+	marketHolidayTTL   = time.Hour
+	marketHolidayRetry = time.Minute
+	// marketHolidayLookBack covers how far back the calendar looks for the
+	// current phase.
+	marketHolidayLookBack = 8 * 24 * time.Hour
+)
+
+type MarketPhase int
+
+const (
+	MarketPhase_PreOpen          MarketPhase = MarketPhase(calendar.Phase_PreOpen)
+	MarketPhase_Open             MarketPhase = MarketPhase(calendar.Phase_Open)
+	MarketPhase_Break            MarketPhase = MarketPhase(calendar.Phase_Break)
+	MarketPhase_Closed           MarketPhase = MarketPhase(calendar.Phase_Closed)
+	MarketPhase_Holiday          MarketPhase = MarketPhase(calendar.Phase_Holiday)
+	MarketPhase_EmergencyClosure MarketPhase = MarketPhase(calendar.Phase_EmergencyClosure)
+)
+
+type WatchMarketStatusReq struct {
+	// ExchangeCode is empty for every exchange
+	ExchangeCode []string
+	// AdvanceWarningSeconds announces every transition that long before it,
+	// 5 minutes when empty.
+	AdvanceWarningSeconds []int64
+}
+
+// MarketStatusEvent is a transition of an exchange, or a warning of one.
+type MarketStatusEvent struct {
+	ExchangeCode string
+	Phase        MarketPhase
+	// At is when Phase starts, or started for the current phase. An
+	// emergency closure starts when it is noticed.
+	At int64
+	// Current is set on the phase an exchange is in when the stream starts
+	Current bool
+	// AdvanceWarningSeconds is set on a warning, which is sent that long
+	// before At, or right away when the stream starts later than that.
+	AdvanceWarningSeconds int64
+	Date                  string // local trading date
+	Session               int32
+	Holiday               string
+}
+
+// MarketStatusStream is the server side of the WatchMarketStatus stream.
+type MarketStatusStream interface {
+	Send(*MarketStatusEvent) error
+	Context() context.Context
+}
+
+type marketWarning struct {
+	exchangeCode string
+	at           int64
+	phase        calendar.Phase
+	advance      time.Duration
+}
+
+// WatchMarketStatus sends the phase every exchange is in, then each of their
+// transitions and the warnings before them until the caller is gone. A
+// disabled exchange is in an emergency closure.
+func (impl *ProductImpl) WatchMarketStatus(in *WatchMarketStatusReq, stream MarketStatusStream) error {
+	ctx := stream.Context()
+
+	warnings, err := advanceWarnings(in.AdvanceWarningSeconds)
+	if err != nil {
+		return err
+	}
+
+	snapshot := impl.catalog.Snapshot()
+	if snapshot == nil {
+		return status.Error(codes.Unavailable, "catalog not loaded yet")
+	}
+	for _, code := range in.ExchangeCode {
+		if _, ok := snapshot.Exchange(code); !ok {
+			return grpcError.NotFound("exchange", code)
+		}
+	}
+
+	logging.Info(ctx, "[WatchMarketStatus] exchanges %v, warnings %v", in.ExchangeCode, warnings)
+
+	phases := map[string]calendar.Phase{}
+	warned := map[marketWarning]bool{}
+	for {
+		// taken before the snapshot, a swap in between wakes the stream up
+		changed := impl.catalog.Changed()
+		now := time.Now()
+		calendars := impl.marketCalendars(ctx, impl.catalog.Snapshot(), in.ExchangeCode)
+
+		codes := make([]string, 0, len(calendars))
+		for code := range calendars {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+
+		next := now.Add(marketStatusHorizon)
+		events := []*MarketStatusEvent{}
+		for _, code := range codes {
+			c := calendars[code]
+
+			current := c.PhaseAt(now)
+			if last, ok := phases[code]; !ok || last != current.Phase {
+				event := marketStatusEvent(code, current)
+				event.Current = !ok
+				events = append(events, event)
+				phases[code] = current.Phase
+			}
+
+			for _, t := range c.Transitions(now, now.Add(warnings[len(warnings)-1]+marketStatusHorizon)) {
+				if t.At.Before(next) {
+					next = t.At
+				}
+				for _, advance := range warnings {
+					warnAt := t.At.Add(-advance)
+					if warnAt.After(now) {
+						if warnAt.Before(next) {
+							next = warnAt
+						}
+						continue
+					}
+					key := marketWarning{code, t.At.Unix(), t.Phase, advance}
+					if !warned[key] {
+						warned[key] = true
+						event := marketStatusEvent(code, t)
+						event.AdvanceWarningSeconds = int64(advance / time.Second)
+						events = append(events, event)
+					}
+				}
+			}
+		}
+
+		for code := range phases {
+			if calendars[code] == nil {
+				delete(phases, code)
+			}
+		}
+		for key := range warned {
+			if key.at < now.Unix() {
+				delete(warned, key)
+			}
+		}
+
+		for _, event := range events {
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-changed:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// advanceWarnings returns the warnings in ascending order
+func advanceWarnings(seconds []int64) ([]time.Duration, error) {
+	if len(seconds) == 0 {
+		return []time.Duration{defaultAdvanceWarning}, nil
+	}
+	if len(seconds) > maxAdvanceWarnings {
+		return nil, grpcError.InvalidArgument("advanceWarningSeconds", "at most %d warnings", maxAdvanceWarnings)
+	}
+
+	v := grpcError.Violations{}
+	seen := map[int64]bool{}
+	warnings := []time.Duration{}
+	for _, s := range seconds {
+		w := time.Duration(s) * time.Second
+		if w <= 0 || w > maxAdvanceWarning {
+			v.Add("advanceWarningSeconds", "%d is not between 1 and %d", s, int64(maxAdvanceWarning/time.Second))
+			continue
+		}
+		if !seen[s] {
+			seen[s] = true
+			warnings = append(warnings, w)
+		}
+	}
+	if err := v.InvalidArgument(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(warnings, func(i, j int) bool { return warnings[i] < warnings[j] })
+	return warnings, nil
+}
+
+func marketStatusEvent(exchangeCode string, t calendar.Transition) *MarketStatusEvent {
+	return &MarketStatusEvent{
+		ExchangeCode: exchangeCode,
+		Phase:        MarketPhase(t.Phase),
+		At:           t.At.Unix(),
+		Date:         t.Date,
+		Session:      int32(t.Session),
+		Holiday:      t.Holiday,
+	}
+}
+
+// marketCalendars builds the calendars of the exchanges, every exchange when
+// codes is empty. An exchange whose calendar is broken is left out.
+func (impl *ProductImpl) marketCalendars(ctx context.Context, snapshot *catalog.Snapshot, codes []string) map[string]*calendar.Calendar {
+	wanted := map[string]bool{}
+	for _, code := range codes {
+		wanted[code] = true
+	}
+	holidays := impl.marketHolidays.get(ctx)
+
+	result := map[string]*calendar.Calendar{}
+	for _, e := range snapshot.Exchanges() {
+		if len(wanted) > 0 && !wanted[e.Code] {
+			continue
+		}
+		e := e
+		c, err := calendar.New(&e, holidays[e.ID])
+		if err != nil {
+			logging.Error(ctx, "[marketCalendars] err: %v", err)
+			continue
+		}
+		result[e.Code] = c
+	}
+	return result
+}
+
+// marketHolidays caches the holidays of every exchange. A holiday write bumps
+// the catalog, which drops the cache on every replica.
+type marketHolidays struct {
+	mutex      sync.Mutex
+	expiresAt  time.Time
+	byExchange map[uint64][]models.ExchangeHolidayModel
+}
+
+func (h *marketHolidays) invalidate() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.expiresAt = time.Time{}
+}
+
+// get keeps the holidays it has when they cannot be reloaded
+func (h *marketHolidays) get(ctx context.Context) map[uint64][]models.ExchangeHolidayModel {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	now := time.Now()
+	if now.Before(h.expiresAt) {
+		return h.byExchange
+	}
+
+	holidays, err := exchangeHolidayDao.Gets(database.GetDB(), &exchangeHolidayDao.QueryModel{
+		EndsFrom: now.Add(-marketHolidayLookBack),
+	})
+	if err != nil {
+		logging.Error(ctx, "[marketHolidays] err: %v", err)
+		h.expiresAt = now.Add(marketHolidayRetry)
+		return h.byExchange
+	}
+
+	byExchange := map[uint64][]models.ExchangeHolidayModel{}
+	for _, holiday := range holidays {
+		byExchange[holiday.ExchangeID] = append(byExchange[holiday.ExchangeID], holiday)
+	}
+	h.byExchange, h.expiresAt = byExchange, now.Add(marketHolidayTTL)
+	return h.byExchange
+}
@@ -0,0 +1,440 @@
+package product
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/paper-trade-chatbot/be-common/database"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"github.com/paper-trade-chatbot/be-product/dao/optionContractDao"
+	"github.com/paper-trade-chatbot/be-product/dao/productDao"
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+	"github.com/paper-trade-chatbot/be-product/service/grpcError"
+	"github.com/paper-trade-chatbot/be-proto/product"
+	"gorm.io/gorm"
+)
+
+// maxStrikesPerExpiry guards against a strike rule that would explode into
+// thousands of rows, e.g. a 0.01 interval over a 0~10000 range.
+const maxStrikesPerExpiry = 500
+
+// the generated codes and names have to fit product.code and product.name
+const (
+	optionCodeMaxLength = 32
+	optionNameMaxLength = 32
+)
+
+// StrikeIntervalRule sets the strike interval used below a price.
+// A rule with Below == 0 applies to every price above the other rules.
+type StrikeIntervalRule struct {
+	Below    float64
+	Interval float64
+}
+
+type GenerateOptionChainReq struct {
+	UnderlyingID  int64
+	ExpiryDates   []int64 // unix time, only the date part is used
+	MinStrike     float64
+	MaxStrike     float64
+	IntervalRules []*StrikeIntervalRule
+	Multiplier    float64
+	CurrencyCode  string
+	TickUnit      float64
+	MinimumOrder  *float64
+	Status        product.Status
+	Display       product.Display
+}
+
+type GenerateOptionChainRes struct {
+	ProductID []int64
+}
+
+type GetOptionChainReq struct {
+	UnderlyingID int64
+	ExpiryDates  []int64
+	Status       *product.Status
+	Display      *product.Display
+}
+
+type GetOptionChainRes struct {
+	Underlying *product.Product
+	Expiry     []*OptionChainExpiry
+}
+
+type OptionChainExpiry struct {
+	ExpiryDate int64
+	Strike     []*OptionChainStrike
+}
+
+type OptionChainStrike struct {
+	StrikePrice float64
+	Call        *product.Product
+	Put         *product.Product
+}
+
+func (impl *ProductImpl) GenerateOptionChain(ctx context.Context, in *GenerateOptionChainReq) (*GenerateOptionChainRes, error) {
+	db := database.GetDB()
+
+	logging.Info(ctx, "[GenerateOptionChain] underlying %d, %d expiries", in.UnderlyingID, len(in.ExpiryDates))
+
+	v := grpcError.Violations{}
+	if in.UnderlyingID == 0 {
+		v.Add("underlyingID", "is required")
+	}
+	if len(in.ExpiryDates) == 0 {
+		v.Add("expiryDates", "is required")
+	}
+	if len(in.IntervalRules) == 0 {
+		v.Add("intervalRules", "is required")
+	}
+	if in.MinStrike <= 0 {
+		v.Add("minStrike", "must be positive")
+	}
+	if in.MaxStrike < in.MinStrike {
+		v.Add("maxStrike", "must not be below minStrike")
+	}
+	if err := v.InvalidArgument(); err != nil {
+		return nil, err
+	}
+
+	underlying, err := productDao.Get(db, &productDao.QueryModel{ID: uint64(in.UnderlyingID)})
+	if err != nil {
+		return nil, err
+	}
+	if underlying == nil {
+		return nil, grpcError.NotFound("product", in.UnderlyingID)
+	}
+	if underlying.Type == models.ProductType_Option {
+		return nil, grpcError.InvalidArgument("underlyingID", "product %d is an option", underlying.ID)
+	}
+
+	strikes, err := generateStrikes(in.MinStrike, in.MaxStrike, in.IntervalRules)
+	if err != nil {
+		return nil, grpcError.InvalidArgument("intervalRules", "%v", err)
+	}
+
+	expiryDates := make([]time.Time, 0, len(in.ExpiryDates))
+	for _, e := range in.ExpiryDates {
+		expiryDates = append(expiryDates, truncateDate(time.Unix(e, 0).UTC()))
+	}
+	if err := checkOptionLabels(underlying.Code, expiryDates, strikes); err != nil {
+		logging.Info(ctx, "[GenerateOptionChain] err: %v", err)
+		return nil, err
+	}
+
+	if in.Multiplier == 0 {
+		in.Multiplier = 1
+	}
+	// left empty they follow the underlying, which may inherit from the exchange
+	currencyCode := underlying.CurrencyCode
+	if in.CurrencyCode != "" {
+		currencyCode = toNullString(in.CurrencyCode)
+	}
+	tickUnit := underlying.TickUnit
+	if in.TickUnit != 0 {
+		tickUnit = toNullFloat64(in.TickUnit)
+	}
+	if in.Status == 0 {
+		in.Status = 1
+	}
+	if in.Display == 0 {
+		in.Display = 1
+	}
+
+	var minimumOrder sql.NullFloat64
+	if in.MinimumOrder != nil {
+		minimumOrder.Valid = true
+		minimumOrder.Float64 = *in.MinimumOrder
+	}
+
+	productIDs := []int64{}
+	created := []*models.ProductModel{}
+	err = database.Transaction(db, func(tx *gorm.DB) error {
+
+		existing, err := optionContractDao.Gets(tx, &optionContractDao.QueryModel{
+			UnderlyingID: underlying.ID,
+			ExpiryDates:  expiryDates,
+		})
+		if err != nil {
+			return err
+		}
+		exists := map[string]bool{}
+		for _, e := range existing {
+			exists[optionContractKey(e.ExpiryDate, e.StrikePrice, e.OptionRight)] = true
+		}
+
+		for _, expiry := range expiryDates {
+			for _, strike := range strikes {
+				for _, right := range []models.OptionRight{models.OptionRight_Call, models.OptionRight_Put} {
+					if exists[optionContractKey(expiry, strike, right)] {
+						continue
+					}
+
+					model := &models.ProductModel{
+						Type:         models.ProductType_Option,
+						ExchangeID:   underlying.ExchangeID,
+						ExchangeCode: underlying.ExchangeCode,
+						Code:         optionCode(underlying.Code, expiry, strike, right),
+						Name:         optionName(underlying.Code, expiry, strike, right),
+						Status:       int(in.Status),
+						Display:      int(in.Display),
+						CurrencyCode: currencyCode,
+						TickUnit:     tickUnit,
+						MinimumOrder: minimumOrder,
+					}
+					id, err := productDao.New(tx, model)
+					if err != nil {
+						return err
+					}
+					model.ID = id
+					created = append(created, model)
+
+					if _, err := optionContractDao.New(tx, &models.OptionContractModel{
+						ProductID:    id,
+						UnderlyingID: underlying.ID,
+						ExpiryDate:   expiry,
+						StrikePrice:  strike,
+						OptionRight:  right,
+						Multiplier:   in.Multiplier,
+					}); err != nil {
+						return err
+					}
+					productIDs = append(productIDs, int64(id))
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint64, 0, len(productIDs))
+	for _, id := range productIDs {
+		ids = append(ids, uint64(id))
+	}
+	impl.productsChanged(ctx, created...)
+	impl.refreshSearchIndex(ctx, ids...)
+
+	return &GenerateOptionChainRes{
+		ProductID: productIDs,
+	}, nil
+}
+
+func (impl *ProductImpl) GetOptionChain(ctx context.Context, in *GetOptionChainReq) (*GetOptionChainRes, error) {
+	db := database.GetDB()
+
+	if in.UnderlyingID == 0 {
+		return nil, grpcError.InvalidArgument("underlyingID", "is required")
+	}
+
+	underlying, err := productDao.Get(db, &productDao.QueryModel{ID: uint64(in.UnderlyingID)})
+	if err != nil {
+		return nil, err
+	}
+	if underlying == nil {
+		return nil, grpcError.NotFound("product", in.UnderlyingID)
+	}
+
+	contractQuery := &optionContractDao.QueryModel{
+		UnderlyingID: underlying.ID,
+	}
+	for _, e := range in.ExpiryDates {
+		contractQuery.ExpiryDates = append(contractQuery.ExpiryDates, truncateDate(time.Unix(e, 0).UTC()))
+	}
+
+	contracts, err := optionContractDao.Gets(db, contractQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &GetOptionChainRes{
+		Underlying: productModelToGrpc(underlying),
+		Expiry:     []*OptionChainExpiry{},
+	}
+	if err := impl.applyExchangeDefaults(ctx, db, []*product.Product{res.Underlying}); err != nil {
+		return nil, err
+	}
+	if len(contracts) == 0 {
+		return res, nil
+	}
+
+	productQuery := &productDao.QueryModel{}
+	for _, c := range contracts {
+		productQuery.IDs = append(productQuery.IDs, c.ProductID)
+	}
+	if in.Status != nil {
+		productQuery.Status = int(in.GetStatus())
+	}
+	if in.Display != nil {
+		productQuery.Display = int(in.GetDisplay())
+	}
+
+	productModels, err := productDao.Gets(db, productQuery)
+	if err != nil {
+		return nil, err
+	}
+	productMap := make(map[uint64]*product.Product, len(productModels))
+	products := make([]*product.Product, 0, len(productModels))
+	for i := range productModels {
+		p := productModelToGrpc(&productModels[i])
+		productMap[productModels[i].ID] = p
+		products = append(products, p)
+	}
+	if err := impl.applyExchangeDefaults(ctx, db, products); err != nil {
+		return nil, err
+	}
+
+	// contracts are ordered by expiry, strike, right
+	var expiry *OptionChainExpiry
+	var strike *OptionChainStrike
+	for _, c := range contracts {
+		p, ok := productMap[c.ProductID]
+		if !ok {
+			continue
+		}
+
+		if expiry == nil || expiry.ExpiryDate != c.ExpiryDate.Unix() {
+			expiry = &OptionChainExpiry{
+				ExpiryDate: c.ExpiryDate.Unix(),
+				Strike:     []*OptionChainStrike{},
+			}
+			res.Expiry = append(res.Expiry, expiry)
+			strike = nil
+		}
+		if strike == nil || strike.StrikePrice != c.StrikePrice {
+			strike = &OptionChainStrike{
+				StrikePrice: c.StrikePrice,
+			}
+			expiry.Strike = append(expiry.Strike, strike)
+		}
+
+		switch c.OptionRight {
+		case models.OptionRight_Call:
+			strike.Call = p
+		case models.OptionRight_Put:
+			strike.Put = p
+		}
+	}
+
+	return res, nil
+}
+
+func (in *GetOptionChainReq) GetStatus() product.Status {
+	if in != nil && in.Status != nil {
+		return *in.Status
+	}
+	return product.Status_Status_None
+}
+
+func (in *GetOptionChainReq) GetDisplay() product.Display {
+	if in != nil && in.Display != nil {
+		return *in.Display
+	}
+	return product.Display_Display_None
+}
+
+// generateStrikes walks from min to max, picking the interval of the rule
+// that covers the current strike.
+func generateStrikes(min, max float64, rules []*StrikeIntervalRule) ([]float64, error) {
+
+	sorted := make([]*StrikeIntervalRule, 0, len(rules))
+	for _, r := range rules {
+		if r == nil || r.Interval <= 0 || r.Below < 0 {
+			return nil, fmt.Errorf("invalid strike interval rule %v", r)
+		}
+		sorted = append(sorted, r)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Below == 0 {
+			return false
+		}
+		if sorted[j].Below == 0 {
+			return true
+		}
+		return sorted[i].Below < sorted[j].Below
+	})
+
+	intervalOf := func(price float64) float64 {
+		for _, r := range sorted {
+			if r.Below == 0 || price < r.Below {
+				return r.Interval
+			}
+		}
+		return 0
+	}
+
+	strikes := []float64{}
+	interval := intervalOf(min)
+	if interval == 0 {
+		return nil, fmt.Errorf("no strike interval rule covers %v", min)
+	}
+	strike := roundStrike(math.Ceil(roundStrike(min/interval)) * interval)
+	for strike <= max {
+		strikes = append(strikes, strike)
+		if len(strikes) > maxStrikesPerExpiry {
+			return nil, fmt.Errorf("more than %d strikes between %v and %v", maxStrikesPerExpiry, min, max)
+		}
+
+		interval = intervalOf(strike)
+		if interval == 0 {
+			break
+		}
+		strike = roundStrike(strike + interval)
+	}
+
+	return strikes, nil
+}
+
+// checkOptionLabels rejects a chain whose codes or names would not fit the
+// product columns, a long underlying code with a fractional strike easily
+// passes 32 characters.
+func checkOptionLabels(underlyingCode string, expiryDates []time.Time, strikes []float64) error {
+	for _, expiry := range expiryDates {
+		for _, strike := range strikes {
+			// the call and put labels only differ by one letter
+			if code := optionCode(underlyingCode, expiry, strike, models.OptionRight_Call); utf8.RuneCountInString(code) > optionCodeMaxLength {
+				return grpcError.InvalidArgument("underlyingID", "option code %s longer than %d", code, optionCodeMaxLength)
+			}
+			if name := optionName(underlyingCode, expiry, strike, models.OptionRight_Call); utf8.RuneCountInString(name) > optionNameMaxLength {
+				return grpcError.InvalidArgument("underlyingID", "option name %s longer than %d", name, optionNameMaxLength)
+			}
+		}
+	}
+	return nil
+}
+
+func roundStrike(strike float64) float64 {
+	return math.Round(strike*1e8) / 1e8
+}
+
+func truncateDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func optionContractKey(expiry time.Time, strike float64, right models.OptionRight) string {
+	return fmt.Sprintf("%s:%s:%d", expiry.Format("20060102"), strconv.FormatFloat(strike, 'f', -1, 64), right)
+}
+
+func optionRightLetter(right models.OptionRight) string {
+	if right == models.OptionRight_Put {
+		return "P"
+	}
+	return "C"
+}
+
+// optionCode builds the exchange-local code, e.g. 2330230215C550
+func optionCode(underlyingCode string, expiry time.Time, strike float64, right models.OptionRight) string {
+	return underlyingCode + expiry.Format("060102") + optionRightLetter(right) + strconv.FormatFloat(strike, 'f', -1, 64)
+}
+
+// optionName builds the display name, e.g. 2330 2023-02-15 C 550
+func optionName(underlyingCode string, expiry time.Time, strike float64, right models.OptionRight) string {
+	return fmt.Sprintf("%s %s %s %s", underlyingCode, expiry.Format("2006-01-02"), optionRightLetter(right), strconv.FormatFloat(strike, 'f', -1, 64))
+}
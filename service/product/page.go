@@ -0,0 +1,269 @@
+package product
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+
+	"github.com/paper-trade-chatbot/be-common/pagination"
+	"github.com/paper-trade-chatbot/be-product/dao/exchangeDao"
+	"github.com/paper-trade-chatbot/be-product/dao/productDao"
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+	"github.com/paper-trade-chatbot/be-product/service/grpcError"
+	"github.com/paper-trade-chatbot/be-product/service/pageToken"
+	"github.com/paper-trade-chatbot/be-proto/general"
+	"github.com/paper-trade-chatbot/be-proto/product"
+	"gorm.io/gorm"
+)
+
+const (
+	cursorPageDefaultSize = 50
+	cursorPageMaxSize     = 500
+)
+
+// CursorPage asks for the page after Token, the first page without one.
+// Unlike general.Pagination a page does not shift when rows are added or
+// removed before it, and no count is run unless IncludeTotal is set.
+type CursorPage struct {
+	Size  int32
+	Token string
+	// IncludeTotal counts every row matching the query, it costs a query on
+	// every page.
+	IncludeTotal bool
+}
+
+type CursorPageResult struct {
+	// NextToken is empty on the last page
+	NextToken  string
+	TotalCount *int64
+}
+
+// size returns the page size, the default when Size is not set
+func (p *CursorPage) size() (int, error) {
+	switch {
+	case p.Size == 0:
+		return cursorPageDefaultSize, nil
+	case p.Size < 0 || p.Size > cursorPageMaxSize:
+		return 0, grpcError.InvalidArgument("page.size", "must be between 1 and %d", cursorPageMaxSize)
+	}
+	return int(p.Size), nil
+}
+
+// checkPagination validates an offset page, its size divides the count.
+func checkPagination(p *general.Pagination) error {
+	if p == nil {
+		return grpcError.InvalidArgument("pagination", "is required")
+	}
+	v := grpcError.Violations{}
+	if p.Page < 1 {
+		v.Add("pagination.page", "must be at least 1")
+	}
+	if p.PageSize < 1 {
+		v.Add("pagination.pageSize", "must be at least 1")
+	}
+	return v.InvalidArgument()
+}
+
+// decode reads the key of the token into the targets, it reports false for
+// the first page. scope has to be the one the token was issued with.
+func (p *CursorPage) decode(ctx context.Context, scope string, targets ...interface{}) (bool, error) {
+	if p.Token == "" {
+		return false, nil
+	}
+	if err := pageToken.Decode(ctx, p.Token, scope, targets...); err != nil {
+		if errors.Is(err, pageToken.ErrInvalid) {
+			return false, grpcError.InvalidArgument("page.token", "not a token of this query")
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// pageScope describes a query for the page tokens, a token is only valid for
+// the query it was issued for.
+func pageScope(name string, query ...interface{}) string {
+	b, err := json.Marshal(query)
+	if err != nil {
+		// every query is made of plain values
+		panic(err)
+	}
+	return name + ":" + string(b)
+}
+
+// productsPage returns a page of the products matching the query, sorted by
+// the columns of queryModel.Sort
+func (impl *ProductImpl) productsPage(ctx context.Context, db *gorm.DB, queryModel *productDao.QueryModel, columns []productSortColumn, scope string, page *CursorPage) ([]models.ProductModel, *CursorPageResult, error) {
+	size, err := page.size()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var after *productDao.Keyset
+	targets := productKeyTargets(columns)
+	if ok, err := page.decode(ctx, scope, targets...); err != nil {
+		return nil, nil, err
+	} else if ok {
+		after = productKeyset(columns, targets)
+	}
+
+	result := &CursorPageResult{}
+	rows, count, ok := impl.snapshotProducts(ctx, queryModel, after)
+	if ok {
+		if page.IncludeTotal {
+			result.TotalCount = &count
+		}
+	} else {
+		// one more row tells whether there is a next page
+		if rows, err = productDao.GetsByKeyset(db, queryModel, after, size+1); err != nil {
+			return nil, nil, err
+		}
+		if page.IncludeTotal {
+			count, err := productDao.Count(db, queryModel)
+			if err != nil {
+				return nil, nil, err
+			}
+			result.TotalCount = &count
+		}
+	}
+
+	if len(rows) > size {
+		rows = rows[:size]
+		if result.NextToken, err = pageToken.Encode(ctx, scope, productSortKey(columns, &rows[size-1])...); err != nil {
+			return nil, nil, err
+		}
+	}
+	return rows, result, nil
+}
+
+// productsWithPagination returns an offset page of the products matching the
+// query, sorted by the columns of queryModel.Sort
+func (impl *ProductImpl) productsWithPagination(ctx context.Context, db *gorm.DB, queryModel *productDao.QueryModel, paginate *general.Pagination) ([]models.ProductModel, *general.PaginationInfo, error) {
+	rows, count, ok := impl.snapshotProducts(ctx, queryModel, nil)
+	if !ok {
+		return productDao.GetsWithPagination(db, queryModel, paginate)
+	}
+
+	offset, limit := pagination.GetOffsetAndLimit(paginate)
+	paginationInfo := pagination.SetPaginationDto(paginate.Page, paginate.PageSize, int32(count), int32(offset))
+	if offset >= len(rows) {
+		return []models.ProductModel{}, paginationInfo, nil
+	}
+	if rows = rows[offset:]; len(rows) > limit {
+		rows = rows[:limit]
+	}
+	return rows, paginationInfo, nil
+}
+
+// snapshotProducts answers a products query from the catalog snapshot, the
+// rows after the keyset unless it is nil and the count of every row matching.
+// ok is false while the snapshot misses a write of this replica, or for a
+// query it cannot answer.
+func (impl *ProductImpl) snapshotProducts(ctx context.Context, queryModel *productDao.QueryModel, after *productDao.Keyset) ([]models.ProductModel, int64, bool) {
+	snapshot := impl.catalog.Fresh()
+	if snapshot == nil {
+		return nil, 0, false
+	}
+
+	rows, ok := snapshot.Query(queryModel, nil)
+	if !ok {
+		return nil, 0, false
+	}
+	count := int64(len(rows))
+	if after != nil {
+		if rows, ok = snapshot.Query(queryModel, after); !ok {
+			return nil, 0, false
+		}
+	}
+	setCatalogVersion(ctx, snapshot.Version)
+	return rows, count, true
+}
+
+// productsPageScope is the scope of the page tokens of GetProducts, made of
+// everything but the pagination and the locale.
+func productsPageScope(in *product.GetProductsReq, ext *GetProductsExt) string {
+	filters := *ext
+	filters.Page, filters.Locale = nil, ""
+	return pageScope("products", in.ExchangeCode, in.ProductType, in.Status, in.Display, filters)
+}
+
+// exchangesPage returns a page of the exchanges ordered by code
+func (impl *ProductImpl) exchangesPage(ctx context.Context, db *gorm.DB, queryModel *exchangeDao.QueryModel, page *CursorPage) ([]models.ExchangeModel, *CursorPageResult, error) {
+	size, err := page.size()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	scope := pageScope("exchanges", queryModel)
+	afterCode := ""
+	if _, err := page.decode(ctx, scope, &afterCode); err != nil {
+		return nil, nil, err
+	}
+
+	result := &CursorPageResult{}
+	rows, ok := impl.snapshotExchanges(ctx, queryModel)
+	if ok {
+		if page.IncludeTotal {
+			count := int64(len(rows))
+			result.TotalCount = &count
+		}
+		// the rows are ordered by code
+		after := sort.Search(len(rows), func(i int) bool {
+			return rows[i].Code > afterCode
+		})
+		rows = rows[after:]
+	} else {
+		// one more row tells whether there is a next page
+		if rows, err = exchangeDao.GetsByKeyset(db, queryModel, afterCode, size+1); err != nil {
+			return nil, nil, err
+		}
+		if page.IncludeTotal {
+			count, err := exchangeDao.Count(db, queryModel)
+			if err != nil {
+				return nil, nil, err
+			}
+			result.TotalCount = &count
+		}
+	}
+
+	if len(rows) > size {
+		rows = rows[:size]
+		if result.NextToken, err = pageToken.Encode(ctx, scope, rows[size-1].Code); err != nil {
+			return nil, nil, err
+		}
+	}
+	return rows, result, nil
+}
+
+// exchangesWithPagination returns an offset page of the exchanges ordered by
+// code
+func (impl *ProductImpl) exchangesWithPagination(ctx context.Context, db *gorm.DB, queryModel *exchangeDao.QueryModel, paginate *general.Pagination) ([]models.ExchangeModel, *general.PaginationInfo, error) {
+	rows, ok := impl.snapshotExchanges(ctx, queryModel)
+	if !ok {
+		return exchangeDao.GetsWithPagination(db, queryModel, paginate)
+	}
+
+	offset, limit := pagination.GetOffsetAndLimit(paginate)
+	paginationInfo := pagination.SetPaginationDto(paginate.Page, paginate.PageSize, int32(len(rows)), int32(offset))
+	if offset >= len(rows) {
+		return []models.ExchangeModel{}, paginationInfo, nil
+	}
+	if rows = rows[offset:]; len(rows) > limit {
+		rows = rows[:limit]
+	}
+	return rows, paginationInfo, nil
+}
+
+// snapshotExchanges is snapshotProducts for the exchanges, the snapshot only
+// answers the query for every exchange.
+func (impl *ProductImpl) snapshotExchanges(ctx context.Context, queryModel *exchangeDao.QueryModel) ([]models.ExchangeModel, bool) {
+	if queryModel.Code != "" || len(queryModel.Codes) > 0 || queryModel.Status != 0 || queryModel.Display != 0 {
+		return nil, false
+	}
+	snapshot := impl.catalog.Fresh()
+	if snapshot == nil {
+		return nil, false
+	}
+	setCatalogVersion(ctx, snapshot.Version)
+	return snapshot.Exchanges(), true
+}
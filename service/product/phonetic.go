@@ -0,0 +1,250 @@
+package product
+
+import (
+	"context"
+	"strings"
+	"unicode"
+
+	"github.com/mozillazg/go-pinyin"
+	"github.com/paper-trade-chatbot/be-common/database"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"github.com/paper-trade-chatbot/be-product/dao/productAliasDao"
+	"github.com/paper-trade-chatbot/be-product/dao/productDao"
+	"github.com/paper-trade-chatbot/be-product/dao/productNameDao"
+	"github.com/paper-trade-chatbot/be-product/dao/productPhoneticDao"
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+	"gorm.io/gorm"
+)
+
+type RebuildPhoneticIndexReq struct {
+	// ProductID limits the rebuild, every product is rebuilt when empty
+	ProductID []int64
+}
+
+type RebuildPhoneticIndexRes struct {
+	Rebuilt int32
+}
+
+var zhuyinInitials = map[string]string{
+	"b": "ㄅ", "p": "ㄆ", "m": "ㄇ", "f": "ㄈ",
+	"d": "ㄉ", "t": "ㄊ", "n": "ㄋ", "l": "ㄌ",
+	"g": "ㄍ", "k": "ㄎ", "h": "ㄏ",
+	"j": "ㄐ", "q": "ㄑ", "x": "ㄒ",
+	"zh": "ㄓ", "ch": "ㄔ", "sh": "ㄕ", "r": "ㄖ",
+	"z": "ㄗ", "c": "ㄘ", "s": "ㄙ",
+}
+
+var zhuyinFinals = map[string]string{
+	"a": "ㄚ", "o": "ㄛ", "e": "ㄜ", "ai": "ㄞ", "ei": "ㄟ", "ao": "ㄠ", "ou": "ㄡ",
+	"an": "ㄢ", "en": "ㄣ", "ang": "ㄤ", "eng": "ㄥ", "er": "ㄦ", "ong": "ㄨㄥ",
+	"i": "ㄧ", "ia": "ㄧㄚ", "ie": "ㄧㄝ", "iao": "ㄧㄠ", "iu": "ㄧㄡ", "ian": "ㄧㄢ",
+	"in": "ㄧㄣ", "iang": "ㄧㄤ", "ing": "ㄧㄥ", "iong": "ㄩㄥ",
+	"u": "ㄨ", "ua": "ㄨㄚ", "uo": "ㄨㄛ", "uai": "ㄨㄞ", "ui": "ㄨㄟ", "uan": "ㄨㄢ",
+	"un": "ㄨㄣ", "uang": "ㄨㄤ", "ueng": "ㄨㄥ",
+	"v": "ㄩ", "ve": "ㄩㄝ", "van": "ㄩㄢ", "vn": "ㄩㄣ",
+}
+
+// zhuyinWhole covers syllables that do not split into initial + final
+var zhuyinWhole = map[string]string{
+	"zhi": "ㄓ", "chi": "ㄔ", "shi": "ㄕ", "ri": "ㄖ", "zi": "ㄗ", "ci": "ㄘ", "si": "ㄙ",
+	"yi": "ㄧ", "ya": "ㄧㄚ", "yo": "ㄧㄛ", "ye": "ㄧㄝ", "yao": "ㄧㄠ", "you": "ㄧㄡ",
+	"yan": "ㄧㄢ", "yin": "ㄧㄣ", "yang": "ㄧㄤ", "ying": "ㄧㄥ", "yong": "ㄩㄥ",
+	"yu": "ㄩ", "yue": "ㄩㄝ", "yuan": "ㄩㄢ", "yun": "ㄩㄣ",
+	"wu": "ㄨ", "wa": "ㄨㄚ", "wo": "ㄨㄛ", "wai": "ㄨㄞ", "wei": "ㄨㄟ",
+	"wan": "ㄨㄢ", "wen": "ㄨㄣ", "wang": "ㄨㄤ", "weng": "ㄨㄥ",
+}
+
+// zhuyinToneMarks are dropped from queries, the index is toneless
+const zhuyinToneMarks = "ˉˊˇˋ˙"
+
+func (impl *ProductImpl) RebuildPhoneticIndex(ctx context.Context, in *RebuildPhoneticIndexReq) (*RebuildPhoneticIndexRes, error) {
+	db := database.GetDB()
+
+	queryModel := &productDao.QueryModel{}
+	for _, id := range in.ProductID {
+		queryModel.IDs = append(queryModel.IDs, uint64(id))
+	}
+
+	productModels, err := productDao.Gets(db, queryModel)
+	if err != nil {
+		return nil, err
+	}
+
+	logging.Info(ctx, "[RebuildPhoneticIndex] %d products", len(productModels))
+
+	for _, m := range productModels {
+		if err := database.Transaction(db, func(tx *gorm.DB) error {
+			return rebuildPhonetic(tx, m.ID)
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	// a full rebuild is also the way to resync the search index by hand
+	if len(in.ProductID) == 0 {
+		if err := impl.loadSearchIndex(ctx); err != nil {
+			return nil, err
+		}
+	} else {
+		impl.refreshSearchIndex(ctx, queryModel.IDs...)
+	}
+
+	return &RebuildPhoneticIndexRes{
+		Rebuilt: int32(len(productModels)),
+	}, nil
+}
+
+// rebuildPhonetic replaces the phonetic rows of a product with the ones
+// computed from its current name, Chinese localized names and aliases.
+func rebuildPhonetic(tx *gorm.DB, productID uint64) error {
+
+	model, err := productDao.Get(tx, &productDao.QueryModel{ID: productID})
+	if err != nil {
+		return err
+	}
+	if model == nil {
+		return nil
+	}
+
+	sources := []string{model.Name}
+
+	names, err := productNameDao.Gets(tx, &productNameDao.QueryModel{ProductID: productID})
+	if err != nil {
+		return err
+	}
+	for _, n := range names {
+		if strings.HasPrefix(n.Locale, "zh") {
+			sources = append(sources, n.ShortName, n.LongName)
+		}
+	}
+
+	aliases, err := productAliasDao.Gets(tx, &productAliasDao.QueryModel{ProductID: productID})
+	if err != nil {
+		return err
+	}
+	for _, a := range aliases {
+		sources = append(sources, a.Alias)
+	}
+
+	if err := productPhoneticDao.Delete(tx, &productPhoneticDao.QueryModel{ProductID: productID}); err != nil {
+		return err
+	}
+
+	seen := map[string]bool{}
+	for _, source := range sources {
+		if seen[source] {
+			continue
+		}
+		seen[source] = true
+
+		phonetic := phoneticOf(source)
+		if phonetic == nil {
+			continue
+		}
+		phonetic.ProductID = productID
+		if _, err := productPhoneticDao.New(tx, phonetic); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// phoneticOf computes the toneless pinyin and zhuyin of the Han characters in
+// text, e.g. 台積電 gives taijidian, tjd, ㄊㄞㄐㄧㄉㄧㄢ and ㄊㄐㄉ. It returns nil
+// when text has no Han character.
+func phoneticOf(text string) *models.ProductPhoneticModel {
+	hasHan := false
+	for _, r := range text {
+		if unicode.Is(unicode.Han, r) {
+			hasHan = true
+			break
+		}
+	}
+	if !hasHan {
+		return nil
+	}
+
+	syllables := pinyin.LazyPinyin(text, pinyin.NewArgs())
+	if len(syllables) == 0 {
+		return nil
+	}
+
+	var py, pyInitials, zy, zyInitials strings.Builder
+	for _, s := range syllables {
+		py.WriteString(s)
+		pyInitials.WriteString(s[:1])
+
+		z := pinyinToZhuyin(s)
+		if z == "" {
+			continue
+		}
+		zy.WriteString(z)
+		for _, r := range z {
+			zyInitials.WriteRune(r)
+			break
+		}
+	}
+
+	return &models.ProductPhoneticModel{
+		Source:         text,
+		Pinyin:         py.String(),
+		PinyinInitials: pyInitials.String(),
+		Zhuyin:         zy.String(),
+		ZhuyinInitials: zyInitials.String(),
+	}
+}
+
+// pinyinToZhuyin converts a toneless pinyin syllable, with ü written as v,
+// to bopomofo. It returns an empty string for an unknown syllable.
+func pinyinToZhuyin(syllable string) string {
+	if z, ok := zhuyinWhole[syllable]; ok {
+		return z
+	}
+
+	initial := ""
+	for _, i := range []string{"zh", "ch", "sh"} {
+		if strings.HasPrefix(syllable, i) {
+			initial = i
+			break
+		}
+	}
+	if initial == "" && len(syllable) > 1 {
+		if _, ok := zhuyinInitials[syllable[:1]]; ok {
+			initial = syllable[:1]
+		}
+	}
+
+	final := strings.TrimPrefix(syllable, initial)
+	// after j, q and x the u is written for ü
+	if initial == "j" || initial == "q" || initial == "x" {
+		if strings.HasPrefix(final, "u") {
+			final = "v" + final[1:]
+		}
+	}
+
+	z, ok := zhuyinFinals[final]
+	if !ok {
+		return ""
+	}
+	return zhuyinInitials[initial] + z
+}
+
+// normalizePhoneticQuery drops spaces and zhuyin tone marks, e.g. "tai ji" to "taiji"
+func normalizePhoneticQuery(query string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || strings.ContainsRune(zhuyinToneMarks, r) {
+			return -1
+		}
+		return r
+	}, query)
+}
+
+// stripZhuyinToneMarks keeps spaces, unlike normalizePhoneticQuery
+func stripZhuyinToneMarks(query string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(zhuyinToneMarks, r) {
+			return -1
+		}
+		return r
+	}, query)
+}
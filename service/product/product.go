@@ -3,33 +3,123 @@ package product
 import (
 	"context"
 	"database/sql"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/asaskevich/govalidator"
-	common "github.com/paper-trade-chatbot/be-common"
 	"github.com/paper-trade-chatbot/be-common/database"
 	"github.com/paper-trade-chatbot/be-common/logging"
 	"github.com/paper-trade-chatbot/be-product/dao/exchangeDao"
 	"github.com/paper-trade-chatbot/be-product/dao/productDao"
 	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+	"github.com/paper-trade-chatbot/be-product/service/catalog"
+	"github.com/paper-trade-chatbot/be-product/service/grpcError"
+	"github.com/paper-trade-chatbot/be-product/service/searchIndex"
+	"github.com/paper-trade-chatbot/be-proto/general"
 	"github.com/paper-trade-chatbot/be-proto/product"
+	"golang.org/x/text/currency"
+	"gorm.io/gorm"
 )
 
 type ProductIntf interface {
 	GetExchange(ctx context.Context, in *product.GetExchangeReq) (*product.GetExchangeRes, error)
 	GetExchanges(ctx context.Context, in *product.GetExchangesReq) (*product.GetExchangesRes, error)
+	GetExchangesWithExt(ctx context.Context, in *product.GetExchangesReq, ext *GetExchangesExt) (*GetExchangesExtRes, error)
 	CreateProduct(ctx context.Context, in *product.CreateProductReq) (*product.CreateProductRes, error)
 	GetProduct(ctx context.Context, in *product.GetProductReq) (*product.GetProductRes, error)
 	GetProducts(ctx context.Context, in *product.GetProductsReq) (*product.GetProductsRes, error)
 	ModifyProduct(ctx context.Context, in *product.ModifyProductReq) (*product.ModifyProductRes, error)
 	DeleteProduct(ctx context.Context, in *product.DeleteProductReq) (*product.DeleteProductRes, error)
+	GenerateOptionChain(ctx context.Context, in *GenerateOptionChainReq) (*GenerateOptionChainRes, error)
+	GetOptionChain(ctx context.Context, in *GetOptionChainReq) (*GetOptionChainRes, error)
+	SetVendorSymbols(ctx context.Context, in *SetVendorSymbolsReq) (*SetVendorSymbolsRes, error)
+	DeleteVendorSymbol(ctx context.Context, in *DeleteVendorSymbolReq) (*DeleteVendorSymbolRes, error)
+	GetProductByVendorSymbol(ctx context.Context, in *GetProductByVendorSymbolReq) (*GetProductByVendorSymbolRes, error)
+	ExportVendorSymbols(ctx context.Context, in *ExportVendorSymbolsReq) (*ExportVendorSymbolsRes, error)
+	CreateProductWithExt(ctx context.Context, in *product.CreateProductReq, ext *CreateProductExt) (*product.CreateProductRes, error)
+	GetProductWithExt(ctx context.Context, in *product.GetProductReq, ext *GetProductExt) (*GetProductExtRes, error)
+	ModifyProductWithExt(ctx context.Context, in *product.ModifyProductReq, ext *ModifyProductExt) (*product.ModifyProductRes, error)
+	ResolveProduct(ctx context.Context, in *ResolveProductReq) (*ResolveProductRes, error)
+	GetProductsWithExt(ctx context.Context, in *product.GetProductsReq, ext *GetProductsExt) (*GetProductsExtRes, error)
+	SetProductNames(ctx context.Context, in *SetProductNamesReq) (*SetProductNamesRes, error)
+	SetProductAliases(ctx context.Context, in *SetProductAliasesReq) (*SetProductAliasesRes, error)
+	GetProductNames(ctx context.Context, in *GetProductNamesReq) (*GetProductNamesRes, error)
+	RebuildPhoneticIndex(ctx context.Context, in *RebuildPhoneticIndexReq) (*RebuildPhoneticIndexRes, error)
+	SuggestProducts(ctx context.Context, in *SuggestProductsReq) (*SuggestProductsRes, error)
+	CreateTaxonomy(ctx context.Context, in *CreateTaxonomyReq) (*CreateTaxonomyRes, error)
+	GetTaxonomy(ctx context.Context, in *GetTaxonomyReq) (*GetTaxonomyRes, error)
+	GetTaxonomies(ctx context.Context, in *GetTaxonomiesReq) (*GetTaxonomiesRes, error)
+	ModifyTaxonomy(ctx context.Context, in *ModifyTaxonomyReq) (*ModifyTaxonomyRes, error)
+	DeleteTaxonomy(ctx context.Context, in *DeleteTaxonomyReq) (*DeleteTaxonomyRes, error)
+	SetProductTaxonomy(ctx context.Context, in *SetProductTaxonomyReq) (*SetProductTaxonomyRes, error)
+	SetProductTags(ctx context.Context, in *SetProductTagsReq) (*SetProductTagsRes, error)
+	GetProductTags(ctx context.Context, in *GetProductTagsReq) (*GetProductTagsRes, error)
+	CreateCollection(ctx context.Context, in *CreateCollectionReq) (*CreateCollectionRes, error)
+	GetCollection(ctx context.Context, in *GetCollectionReq) (*GetCollectionRes, error)
+	GetCollections(ctx context.Context, in *GetCollectionsReq) (*GetCollectionsRes, error)
+	ModifyCollection(ctx context.Context, in *ModifyCollectionReq) (*ModifyCollectionRes, error)
+	DeleteCollection(ctx context.Context, in *DeleteCollectionReq) (*DeleteCollectionRes, error)
+	SetCollectionMembers(ctx context.Context, in *SetCollectionMembersReq) (*SetCollectionMembersRes, error)
+	GetCollectionMembers(ctx context.Context, in *GetCollectionMembersReq) (*GetCollectionMembersRes, error)
+	SetConstituents(ctx context.Context, in *SetConstituentsReq) (*SetConstituentsRes, error)
+	SetProductRelation(ctx context.Context, in *SetProductRelationReq) (*SetProductRelationRes, error)
+	DeleteProductRelation(ctx context.Context, in *DeleteProductRelationReq) (*DeleteProductRelationRes, error)
+	GetProductRelations(ctx context.Context, in *GetProductRelationsReq) (*GetProductRelationsRes, error)
+	GetProductProfile(ctx context.Context, in *GetProductProfileReq) (*GetProductProfileRes, error)
+	UpsertProductProfile(ctx context.Context, in *UpsertProductProfileReq) (*UpsertProductProfileRes, error)
+	StartLifecycleJob(ctx context.Context)
+	StartCatalogSync(ctx context.Context)
+	SetProductsStatus(ctx context.Context, in *SetProductsStatusReq) (*SetProductsStatusRes, error)
+	GetProductStatusAudits(ctx context.Context, in *GetProductStatusAuditsReq) (*GetProductStatusAuditsRes, error)
+	GetExchangeTradingDefaults(ctx context.Context, in *GetExchangeTradingDefaultsReq) (*GetExchangeTradingDefaultsRes, error)
+	SetExchangeTradingDefaults(ctx context.Context, in *SetExchangeTradingDefaultsReq) (*SetExchangeTradingDefaultsRes, error)
+	WatchProducts(in *WatchProductsReq, stream ProductWatchStream) error
+	WatchMarketStatus(in *WatchMarketStatusReq, stream MarketStatusStream) error
+	SetExchangeStatus(ctx context.Context, in *SetExchangeStatusReq) (*SetExchangeStatusRes, error)
+	SetExchangeHoliday(ctx context.Context, in *SetExchangeHolidayReq) (*SetExchangeHolidayRes, error)
+	DeleteExchangeHoliday(ctx context.Context, in *DeleteExchangeHolidayReq) (*DeleteExchangeHolidayRes, error)
+	GetExchangeHolidays(ctx context.Context, in *GetExchangeHolidaysReq) (*GetExchangeHolidaysRes, error)
+	CreateWebhook(ctx context.Context, in *CreateWebhookReq) (*CreateWebhookRes, error)
+	GetWebhooks(ctx context.Context, in *GetWebhooksReq) (*GetWebhooksRes, error)
+	ModifyWebhook(ctx context.Context, in *ModifyWebhookReq) (*ModifyWebhookRes, error)
+	DeleteWebhook(ctx context.Context, in *DeleteWebhookReq) (*DeleteWebhookRes, error)
+	GetWebhookDeliveries(ctx context.Context, in *GetWebhookDeliveriesReq) (*GetWebhookDeliveriesRes, error)
+	GetProductChanges(ctx context.Context, in *GetProductChangesReq) (*GetProductChangesRes, error)
 }
 
 type ProductImpl struct {
-	ProductClient product.ProductServiceClient
+	ProductClient  product.ProductServiceClient
+	searchIndex    *searchIndex.Index
+	catalog        *catalog.Catalog
+	watchHub       *productWatchHub
+	marketHolidays *marketHolidays
+	// searchIndexStale asks the next catalog swap for a full rebuild, it is
+	// only used by syncSearchIndex
+	searchIndexStale bool
 }
 
 func New() ProductIntf {
-	return &ProductImpl{}
+	impl := &ProductImpl{
+		searchIndex:    searchIndex.New(),
+		catalog:        catalog.New(),
+		watchHub:       newProductWatchHub(),
+		marketHolidays: &marketHolidays{},
+	}
+	impl.catalog.OnSwap(impl.watchHub.onSwap)
+	impl.catalog.OnSwap(func(_, _ *catalog.Snapshot) {
+		impl.marketHolidays.invalidate()
+	})
+	impl.catalog.OnSwap(impl.syncSearchIndex)
+
+	// reads go through the read cache and suggestions stay empty until a
+	// snapshot is loaded, StartCatalogSync retries every poll interval
+	ctx := context.Background()
+	if err := impl.catalog.Load(ctx); err != nil {
+		logging.Error(ctx, "[New] load catalog err: %v", err)
+	}
+
+	return impl
 }
 
 func (impl *ProductImpl) GetExchange(ctx context.Context, in *product.GetExchangeReq) (*product.GetExchangeRes, error) {
@@ -41,13 +131,13 @@ func (impl *ProductImpl) GetExchange(ctx context.Context, in *product.GetExchang
 		Display: int(in.GetDisplay()),
 	}
 
-	model, err := exchangeDao.Get(db, queryModel)
+	model, err := impl.lookupExchange(ctx, db, queryModel)
 	if err != nil {
 		return nil, err
 	}
 
 	if model == nil {
-		return &product.GetExchangeRes{}, nil
+		return nil, grpcError.NotFound("exchange", in.GetCode())
 	}
 
 	var openTime, closeTime *int64
@@ -83,25 +173,50 @@ func (impl *ProductImpl) GetExchange(ctx context.Context, in *product.GetExchang
 }
 
 func (impl *ProductImpl) GetExchanges(ctx context.Context, in *product.GetExchangesReq) (*product.GetExchangesRes, error) {
+	res, err := impl.GetExchangesWithExt(ctx, in, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.GetExchangesRes, nil
+}
+
+func (impl *ProductImpl) GetExchangesWithExt(ctx context.Context, in *product.GetExchangesReq, ext *GetExchangesExt) (*GetExchangesExtRes, error) {
 	db := database.GetDB()
 
+	if ext == nil {
+		ext = &GetExchangesExt{}
+	}
+
 	queryModel := &exchangeDao.QueryModel{}
 
-	models, paginationInfo, err := exchangeDao.GetsWithPagination(db, queryModel, in.Pagination)
+	var (
+		rows           []models.ExchangeModel
+		paginationInfo *general.PaginationInfo
+		pageResult     *CursorPageResult
+		err            error
+	)
+	if ext.Page != nil {
+		rows, pageResult, err = impl.exchangesPage(ctx, db, queryModel, ext.Page)
+	} else if err = checkPagination(in.Pagination); err == nil {
+		rows, paginationInfo, err = impl.exchangesWithPagination(ctx, db, queryModel, in.Pagination)
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	exchanges := []*product.Exchange{}
 
-	if len(models) == 0 {
-		return &product.GetExchangesRes{
-			Exchange:       exchanges,
-			PaginationInfo: paginationInfo,
+	if len(rows) == 0 {
+		return &GetExchangesExtRes{
+			GetExchangesRes: &product.GetExchangesRes{
+				Exchange:       exchanges,
+				PaginationInfo: paginationInfo,
+			},
+			PageResult: pageResult,
 		}, nil
 	}
 
-	for _, m := range models {
+	for _, m := range rows {
 
 		var openTime, closeTime *int64
 		if m.OpenTime.Valid {
@@ -127,26 +242,38 @@ func (impl *ProductImpl) GetExchanges(ctx context.Context, in *product.GetExchan
 			ExchangeDay:    nil,
 			ExceptionTime:  nil,
 			CreatedAt:      m.CreatedAt.Unix(),
-			UpdatedAt:      m.CreatedAt.Unix(),
+			UpdatedAt:      m.UpdatedAt.Unix(),
 		}
 		exchanges = append(exchanges, e)
 	}
 
-	return &product.GetExchangesRes{
-		Exchange:       exchanges,
-		PaginationInfo: paginationInfo,
+	return &GetExchangesExtRes{
+		GetExchangesRes: &product.GetExchangesRes{
+			Exchange:       exchanges,
+			PaginationInfo: paginationInfo,
+		},
+		PageResult: pageResult,
 	}, nil
 }
 
 func (impl *ProductImpl) CreateProduct(ctx context.Context, in *product.CreateProductReq) (*product.CreateProductRes, error) {
+	return impl.CreateProductWithExt(ctx, in, nil)
+}
+
+func (impl *ProductImpl) CreateProductWithExt(ctx context.Context, in *product.CreateProductReq, ext *CreateProductExt) (*product.CreateProductRes, error) {
 	db := database.GetDB()
 
+	if ext == nil {
+		ext = &CreateProductExt{}
+	}
+
 	logging.Info(ctx, "[CreateProduct] %s %s", in.ExchangeCode, in.Code)
 
 	checkProductForm := struct {
-		Type         int    `valid:"range(1|4)"`
-		ExchangeCode string `valid:"required"`
-		ProductCode  string `valid:"required"`
+		// options are only created by GenerateOptionChain, with their contract
+		Type         int    `json:"type" valid:"range(1|4)"`
+		ExchangeCode string `json:"exchangeCode" valid:"required"`
+		ProductCode  string `json:"code" valid:"required"`
 	}{
 		Type:         int(in.Type),
 		ExchangeCode: in.ExchangeCode,
@@ -155,7 +282,25 @@ func (impl *ProductImpl) CreateProduct(ctx context.Context, in *product.CreatePr
 
 	if _, err := govalidator.ValidateStruct(checkProductForm); err != nil {
 		logging.Info(ctx, "[CreateProduct] err: %v", err)
-		return nil, common.ErrNoRequiredParam
+		v := grpcError.Violations{}
+		v.AddValidation(err)
+		return nil, v.InvalidArgument()
+	}
+
+	if err := ext.Identifiers.normalize(); err != nil {
+		logging.Info(ctx, "[CreateProduct] err: %v", err)
+		return nil, err
+	}
+	if err := checkIdentifiersAvailable(db, ext.Identifiers, 0); err != nil {
+		logging.Info(ctx, "[CreateProduct] err: %v", err)
+		return nil, err
+	}
+
+	listedAt := listingTime(ext.ListedAt)
+	delistedAt := listingTime(ext.DelistedAt)
+	if !validListing(listedAt, delistedAt) {
+		logging.Info(ctx, "[CreateProduct] delisted at %v before listed at %v", delistedAt.Time, listedAt.Time)
+		return nil, grpcError.InvalidArgument("delistedAt", "must be after listedAt")
 	}
 
 	if in.Status == 0 {
@@ -166,10 +311,22 @@ func (impl *ProductImpl) CreateProduct(ctx context.Context, in *product.CreatePr
 		in.Display = 1
 	}
 
-	var minimumOrder sql.NullFloat64
-	if in.MinimumOrder != nil {
-		minimumOrder.Valid = true
-		minimumOrder.Float64 = in.GetMinimumOrder()
+	exchange, err := checkProductReferences(db, in)
+	if err != nil {
+		logging.Info(ctx, "[CreateProduct] err: %v", err)
+		return nil, err
+	}
+
+	trading := &TradingOverride{
+		CurrencyCode:   &in.CurrencyCode,
+		TickUnit:       &in.TickUnit,
+		LotSize:        ext.LotSize,
+		MinimumOrder:   in.MinimumOrder,
+		PriceLimitRule: ext.PriceLimitRule,
+	}
+	if err := trading.normalize(); err != nil {
+		logging.Info(ctx, "[CreateProduct] err: %v", err)
+		return nil, err
 	}
 
 	var iconID sql.NullString
@@ -178,28 +335,60 @@ func (impl *ProductImpl) CreateProduct(ctx context.Context, in *product.CreatePr
 		iconID.String = in.GetIconID()
 	}
 
-	_, err := productDao.New(db, &models.ProductModel{
-		Type:         models.ProductType(in.GetType()),
-		ExchangeCode: in.GetExchangeCode(),
-		Code:         in.GetCode(),
-		Name:         in.GetName(),
-		Status:       int(in.GetStatus()),
-		Display:      int(in.GetDisplay()),
-		CurrencyCode: in.GetCurrencyCode(),
-		TickUnit:     in.GetTickUnit(),
-		MinimumOrder: minimumOrder,
-		IconID:       iconID,
+	var model *models.ProductModel
+	err = database.Transaction(db, func(tx *gorm.DB) error {
+		model = &models.ProductModel{
+			Type:         models.ProductType(in.GetType()),
+			ExchangeID:   exchange.ID,
+			ExchangeCode: exchange.Code,
+			Code:         in.GetCode(),
+			Name:         in.GetName(),
+			Status:       int(in.GetStatus()),
+			Display:      int(in.GetDisplay()),
+			IconID:       iconID,
+			ISIN:         toNullString(identifierValue(ext.Identifiers.GetISIN())),
+			CUSIP:        toNullString(identifierValue(ext.Identifiers.GetCUSIP())),
+			SEDOL:        toNullString(identifierValue(ext.Identifiers.GetSEDOL())),
+			FIGI:         toNullString(identifierValue(ext.Identifiers.GetFIGI())),
+			ListedAt:     listedAt,
+			DelistedAt:   delistedAt,
+			Priority:     int(ext.Priority),
+		}
+		trading.apply(model)
+
+		id, err := productDao.New(tx, model)
+		if err != nil {
+			return err
+		}
+		model.ID = id
+
+		return rebuildPhonetic(tx, id)
 	})
 	if err != nil {
 		return nil, err
 	}
 
+	impl.productsChanged(ctx, model)
+	impl.refreshSearchIndex(ctx, model.ID)
+
 	return &product.CreateProductRes{}, nil
 }
 
 func (impl *ProductImpl) GetProduct(ctx context.Context, in *product.GetProductReq) (*product.GetProductRes, error) {
+	res, err := impl.GetProductWithExt(ctx, in, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.GetProductRes, nil
+}
+
+func (impl *ProductImpl) GetProductWithExt(ctx context.Context, in *product.GetProductReq, ext *GetProductExt) (*GetProductExtRes, error) {
 	db := database.GetDB()
 
+	if ext == nil {
+		ext = &GetProductExt{}
+	}
+
 	queryModel := &productDao.QueryModel{}
 
 	switch query := in.GetProduct().(type) {
@@ -208,52 +397,74 @@ func (impl *ProductImpl) GetProduct(ctx context.Context, in *product.GetProductR
 	case *product.GetProductReq_Code:
 		queryModel.ExchangeCode = query.Code.GetExchangeCode()
 		queryModel.Code = query.Code.GetProductCode()
+	default:
+		if ext.Identifier == nil || ext.Identifier.Value == "" {
+			return nil, grpcError.InvalidArgument("product", "id, code or identifier is required")
+		}
+		if err := ext.Identifier.apply(queryModel); err != nil {
+			logging.Info(ctx, "[GetProduct] err: %v", err)
+			return nil, grpcError.InvalidArgument("identifier", "%v", err)
+		}
 	}
 
-	model, err := productDao.Get(db, queryModel)
+	model, err := impl.lookupProduct(ctx, db, queryModel)
 	if err != nil {
 		return nil, err
 	}
 
 	if model == nil {
-		return &product.GetProductRes{}, nil
+		return nil, grpcError.NotFound("product", productKey(queryModel))
 	}
 
-	var minimumOrder *float64
-	if model.MinimumOrder.Valid {
-		minimumOrderObject := model.MinimumOrder.Float64
-		minimumOrder = &minimumOrderObject
+	names, err := impl.localizeNames(db, []uint64{model.ID}, ext.Locale)
+	if err != nil {
+		return nil, err
 	}
-	var iconID *string
-	if model.IconID.Valid {
-		iconIDObject := model.IconID.String
-		iconID = &iconIDObject
+
+	p := productModelToGrpc(model)
+	pExt := productModelToExt(model)
+	applyLocalizedName(p, pExt, names[model.ID])
+	if err := impl.applyExchange(ctx, db, []*product.Product{p}, []*ProductExt{pExt}); err != nil {
+		return nil, err
 	}
 
-	return &product.GetProductRes{
-		Product: &product.Product{
-			Id:           int64(model.ID),
-			Type:         product.ProductType(model.Type),
-			ExchangeCode: model.ExchangeCode,
-			Code:         model.Code,
-			Name:         model.Name,
-			Status:       product.Status(model.Status),
-			Display:      product.Display(model.Display),
-			CurrencyCode: model.CurrencyCode,
-			TickUnit:     model.TickUnit,
-			MinimumOrder: minimumOrder,
-			IconID:       iconID,
-			CreatedAt:    model.CreatedAt.Unix(),
-			UpdatedAt:    model.UpdatedAt.Unix(),
+	if ext.IncludeProfile {
+		pExt.Profile, err = productProfile(db, model.ID, ext.Locale)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &GetProductExtRes{
+		GetProductRes: &product.GetProductRes{
+			Product: p,
 		},
+		ProductExt: pExt,
 	}, nil
 }
 
 func (impl *ProductImpl) GetProducts(ctx context.Context, in *product.GetProductsReq) (*product.GetProductsRes, error) {
+	res, err := impl.GetProductsWithExt(ctx, in, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.GetProductsRes, nil
+}
+
+func (impl *ProductImpl) GetProductsWithExt(ctx context.Context, in *product.GetProductsReq, ext *GetProductsExt) (*GetProductsExtRes, error) {
 	db := database.GetDB()
 
+	if ext == nil {
+		ext = &GetProductsExt{}
+	}
+
+	v := grpcError.Violations{}
+	sortColumns := productSort(&v, ext.Sort)
+
 	queryModel := &productDao.QueryModel{
-		ExchangeCodes: in.ExchangeCode,
+		ExchangeCodes:  in.ExchangeCode,
+		CurrencyCodes:  normalizeCurrencyCodes(&v, ext.CurrencyCodes),
+		CodeOrNameLike: productSearchPattern(&v, ext.Search, ext.SearchContains),
 	}
 
 	for _, t := range in.ProductType {
@@ -261,67 +472,371 @@ func (impl *ProductImpl) GetProducts(ctx context.Context, in *product.GetProduct
 	}
 
 	if in.Status != nil {
-		queryModel.Status = int(in.GetStatus())
+		queryModel.EffectiveStatus = int(in.GetStatus())
+	}
+
+	for _, s := range ext.Statuses {
+		if !validToggle(int(s)) {
+			v.Add("statuses", "%d is not enabled or disabled", s)
+		}
+		queryModel.EffectiveStatuses = append(queryModel.EffectiveStatuses, int(s))
+	}
+
+	switch {
+	case ext.UpdatedSince < 0:
+		v.Add("updatedSince", "must not be negative")
+	case ext.UpdatedSince > 0:
+		queryModel.UpdatedFrom = time.Unix(ext.UpdatedSince, 0)
+	}
+
+	if err := v.InvalidArgument(); err != nil {
+		return nil, err
 	}
+	queryModel.Sort = productSortFields(ext.Sort)
 
 	if in.Display != nil {
-		queryModel.Display = int(in.GetDisplay())
+		queryModel.EffectiveDisplay = int(in.GetDisplay())
+	}
+
+	if ext.TaxonomyID != 0 {
+		taxonomyIDs, err := taxonomyWithDescendants(db, uint64(ext.TaxonomyID))
+		if err != nil {
+			return nil, err
+		}
+		queryModel.TaxonomyIDs = taxonomyIDs
 	}
 
-	models, paginationInfo, err := productDao.GetsWithPagination(db, queryModel, in.Pagination)
+	if ext.Tag != "" {
+		queryModel.Tag = normalizeTag(ext.Tag)
+	}
+
+	now := time.Now()
+	if ext.ListedWithinDays > 0 {
+		queryModel.ListedFrom = now.AddDate(0, 0, -int(ext.ListedWithinDays))
+		queryModel.ListedUntil = now
+	}
+	if ext.DelistingWithinDays > 0 {
+		queryModel.DelistedFrom = now
+		queryModel.DelistedUntil = now.AddDate(0, 0, int(ext.DelistingWithinDays))
+	}
+
+	var (
+		rows           []models.ProductModel
+		paginationInfo *general.PaginationInfo
+		pageResult     *CursorPageResult
+		err            error
+	)
+	if ext.Page != nil {
+		rows, pageResult, err = impl.productsPage(ctx, db, queryModel, sortColumns, productsPageScope(in, ext), ext.Page)
+	} else if err = checkPagination(in.Pagination); err == nil {
+		rows, paginationInfo, err = impl.productsWithPagination(ctx, db, queryModel, in.Pagination)
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	products := []*product.Product{}
+	productExts := []*ProductExt{}
+
+	if len(rows) == 0 {
+		return &GetProductsExtRes{
+			GetProductsRes: &product.GetProductsRes{
+				Product:        products,
+				PaginationInfo: paginationInfo,
+			},
+			ProductExt: productExts,
+			PageResult: pageResult,
+		}, nil
+	}
+
+	ids := make([]uint64, 0, len(rows))
+	for _, m := range rows {
+		ids = append(ids, m.ID)
+	}
+	names, err := impl.localizeNames(db, ids, ext.Locale)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range rows {
+		p := productModelToGrpc(&m)
+		pExt := productModelToExt(&m)
+		applyLocalizedName(p, pExt, names[m.ID])
+		products = append(products, p)
+		productExts = append(productExts, pExt)
+	}
+	if err := impl.applyExchange(ctx, db, products, productExts); err != nil {
+		return nil, err
+	}
 
-	if len(models) == 0 {
-		return &product.GetProductsRes{
+	return &GetProductsExtRes{
+		GetProductsRes: &product.GetProductsRes{
 			Product:        products,
 			PaginationInfo: paginationInfo,
-		}, nil
+		},
+		ProductExt: productExts,
+		PageResult: pageResult,
+	}, nil
+}
+
+func (impl *ProductImpl) ModifyProduct(ctx context.Context, in *product.ModifyProductReq) (*product.ModifyProductRes, error) {
+	return impl.ModifyProductWithExt(ctx, in, nil)
+}
+
+func (impl *ProductImpl) ModifyProductWithExt(ctx context.Context, in *product.ModifyProductReq, ext *ModifyProductExt) (*product.ModifyProductRes, error) {
+	db := database.GetDB()
+
+	if ext == nil {
+		ext = &ModifyProductExt{}
 	}
 
-	for _, m := range models {
+	queryModel := &productDao.QueryModel{}
+
+	switch query := in.GetProduct().(type) {
+	case *product.ModifyProductReq_Id:
+		queryModel.ID = uint64(query.Id)
+	case *product.ModifyProductReq_Code:
+		queryModel.ExchangeCode = query.Code.GetExchangeCode()
+		queryModel.Code = query.Code.GetProductCode()
+	default:
+		return nil, grpcError.InvalidArgument("product", "id or code is required")
+	}
+
+	logging.Info(ctx, "[ModifyProduct] %v", in.GetProduct())
 
-		var minimumOrder *float64
-		if m.MinimumOrder.Valid {
-			minimumOrderObject := m.MinimumOrder.Float64
-			minimumOrder = &minimumOrderObject
+	if err := ext.Identifiers.normalize(); err != nil {
+		logging.Info(ctx, "[ModifyProduct] err: %v", err)
+		return nil, err
+	}
+
+	if err := ext.Trading.normalize(); err != nil {
+		logging.Info(ctx, "[ModifyProduct] err: %v", err)
+		return nil, err
+	}
+
+	model, err := productDao.Get(db, queryModel)
+	if err != nil {
+		return nil, err
+	}
+	if model == nil {
+		return nil, grpcError.NotFound("product", productKey(queryModel))
+	}
+
+	if err := checkIdentifiersAvailable(db, ext.Identifiers, model.ID); err != nil {
+		logging.Info(ctx, "[ModifyProduct] err: %v", err)
+		return nil, err
+	}
+
+	updates := ext.Identifiers.updates()
+	for column, value := range ext.Trading.updates() {
+		updates[column] = value
+	}
+	if in.Status != nil {
+		updates["status"] = int(in.GetStatus())
+	}
+	if in.VerifyStatus != nil {
+		updates["display"] = int(in.GetVerifyStatus())
+	}
+	if ext.ListedAt != nil || ext.DelistedAt != nil {
+		listedAt, delistedAt := model.ListedAt, model.DelistedAt
+		if ext.ListedAt != nil {
+			listedAt = listingTime(ext.ListedAt)
+			updates["listed_at"] = listedAt
 		}
-		var iconID *string
-		if m.IconID.Valid {
-			iconIDObject := m.IconID.String
-			iconID = &iconIDObject
+		if ext.DelistedAt != nil {
+			delistedAt = listingTime(ext.DelistedAt)
+			updates["delisted_at"] = delistedAt
 		}
-		p := &product.Product{
-			Id:           int64(m.ID),
-			Type:         product.ProductType(m.Type),
-			ExchangeCode: m.ExchangeCode,
-			Code:         m.Code,
-			Name:         m.Name,
-			Status:       product.Status(m.Status),
-			Display:      product.Display(m.Display),
-			CurrencyCode: m.CurrencyCode,
-			TickUnit:     m.TickUnit,
-			MinimumOrder: minimumOrder,
-			IconID:       iconID,
-			CreatedAt:    m.CreatedAt.Unix(),
-			UpdatedAt:    m.UpdatedAt.Unix(),
+		if !validListing(listedAt, delistedAt) {
+			logging.Info(ctx, "[ModifyProduct] delisted at %v before listed at %v", delistedAt.Time, listedAt.Time)
+			return nil, grpcError.InvalidArgument("delistedAt", "must be after listedAt")
 		}
-		products = append(products, p)
+	}
+	if ext.Priority != nil {
+		updates["priority"] = int(*ext.Priority)
+	}
+	nameChanged := ext.Name != nil && *ext.Name != model.Name
+	if nameChanged {
+		updates["name"] = *ext.Name
 	}
 
-	return &product.GetProductsRes{
-		Product:        products,
-		PaginationInfo: paginationInfo,
-	}, nil
-}
+	if len(updates) == 0 {
+		return &product.ModifyProductRes{}, nil
+	}
 
-func (impl *ProductImpl) ModifyProduct(ctx context.Context, in *product.ModifyProductReq) (*product.ModifyProductRes, error) {
-	return nil, common.ErrNotImplemented
+	err = database.Transaction(db, func(tx *gorm.DB) error {
+		if err := productDao.Modify(tx, model, updates); err != nil {
+			return err
+		}
+		if nameChanged {
+			return rebuildPhonetic(tx, model.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	impl.productsChanged(ctx, model)
+	impl.refreshSearchIndex(ctx, model.ID)
+
+	return &product.ModifyProductRes{}, nil
 }
 
+// DeleteProduct disables the product and keeps it as a tombstone for
+// GetProductChanges, its code and identifiers stay taken.
 func (impl *ProductImpl) DeleteProduct(ctx context.Context, in *product.DeleteProductReq) (*product.DeleteProductRes, error) {
-	return nil, common.ErrNotImplemented
+	db := database.GetDB()
+
+	queryModel := &productDao.QueryModel{}
+
+	switch query := in.GetProduct().(type) {
+	case *product.DeleteProductReq_Id:
+		queryModel.ID = uint64(query.Id)
+	case *product.DeleteProductReq_Code:
+		queryModel.ExchangeCode = query.Code.GetExchangeCode()
+		queryModel.Code = query.Code.GetProductCode()
+	default:
+		return nil, grpcError.InvalidArgument("product", "id or code is required")
+	}
+
+	logging.Info(ctx, "[DeleteProduct] %s", productKey(queryModel))
+
+	model, err := productDao.Get(db, queryModel)
+	if err != nil {
+		return nil, err
+	}
+	if model == nil {
+		return nil, grpcError.NotFound("product", productKey(queryModel))
+	}
+
+	deleted, err := productDao.Delete(db, model, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !deleted {
+		return nil, grpcError.NotFound("product", productKey(queryModel))
+	}
+
+	impl.productsChanged(ctx, model)
+	impl.refreshSearchIndex(ctx, model.ID)
+
+	return &product.DeleteProductRes{}, nil
+}
+
+// productKey describes the product a query looks for
+func productKey(queryModel *productDao.QueryModel) string {
+	switch {
+	case queryModel.ID != 0:
+		return strconv.FormatUint(queryModel.ID, 10)
+	case queryModel.Code != "":
+		return queryModel.ExchangeCode + ":" + queryModel.Code
+	}
+	for _, id := range []string{queryModel.ISIN, queryModel.CUSIP, queryModel.SEDOL, queryModel.FIGI} {
+		if id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// missingProduct returns the first of the ids without a row in found, the key
+// of the NotFound of a write taking a list of products.
+func missingProduct(ids []uint64, found []models.ProductModel) uint64 {
+	rows := make(map[uint64]bool, len(found))
+	for i := range found {
+		rows[found[i].ID] = true
+	}
+	for _, id := range ids {
+		if !rows[id] {
+			return id
+		}
+	}
+	return 0
+}
+
+// checkProductReferences checks a new product against its exchange instead of
+// leaving it to the foreign keys, and returns the exchange.
+func checkProductReferences(db *gorm.DB, in *product.CreateProductReq) (*models.ExchangeModel, error) {
+	exchanges, err := exchangeDao.Gets(db, &exchangeDao.QueryModel{Code: in.ExchangeCode})
+	if err != nil {
+		return nil, err
+	}
+	if len(exchanges) == 0 {
+		return nil, grpcError.InvalidArgument("exchangeCode", "no such exchange %s", in.ExchangeCode)
+	}
+	exchange := &exchanges[0]
+	defaults := exchangeTradingDefaults(exchange)
+
+	violations := grpcError.Violations{}
+	if exchange.Status != 1 {
+		violations.Add("exchangeCode", "exchange %s is disabled", exchange.Code)
+	}
+	if models.ProductType(in.Type) != exchange.ProductType {
+		violations.Add("type", "exchange %s only lists product type %d", exchange.Code, exchange.ProductType)
+	}
+
+	currencyCode := strings.ToUpper(strings.TrimSpace(in.CurrencyCode))
+	switch {
+	case currencyCode != "":
+		if _, err := currency.ParseISO(currencyCode); err != nil {
+			violations.Add("currencyCode", "%s is not an ISO 4217 currency", currencyCode)
+		}
+	case defaults.CurrencyCode == "":
+		violations.Add("currencyCode", "exchange %s has no default currency", exchange.Code)
+	}
+
+	switch {
+	case in.TickUnit < 0:
+		violations.Add("tickUnit", "tick unit must be positive")
+	case in.TickUnit == 0 && defaults.tickUnit() <= 0:
+		violations.Add("tickUnit", "exchange %s has no default tick", exchange.Code)
+	}
+
+	if err := violations.InvalidArgument(); err != nil {
+		return nil, err
+	}
+
+	// a deleted product keeps its code
+	existing, err := productDao.Get(db, &productDao.QueryModel{
+		ExchangeCode: exchange.Code,
+		Code:         in.Code,
+		WithDeleted:  true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.DeletedAt.Valid {
+		return nil, grpcError.AlreadyExists("code", "%s is held on %s by deleted product %d", in.Code, exchange.Code, existing.ID)
+	}
+	if existing != nil {
+		return nil, grpcError.AlreadyExists("code", "%s already exists on %s as product %d", in.Code, exchange.Code, existing.ID)
+	}
+
+	return exchange, nil
+}
+
+func productModelToGrpc(model *models.ProductModel) *product.Product {
+
+	var iconID *string
+	if model.IconID.Valid {
+		iconIDObject := model.IconID.String
+		iconID = &iconIDObject
+	}
+
+	return &product.Product{
+		Id:           int64(model.ID),
+		Type:         product.ProductType(model.Type),
+		ExchangeCode: model.ExchangeCode,
+		Code:         model.Code,
+		Name:         model.Name,
+		Status:       product.Status(model.Status),
+		Display:      product.Display(model.Display),
+		CurrencyCode: model.CurrencyCode.String,
+		TickUnit:     model.TickUnit.Float64,
+		MinimumOrder: fromNullFloat64(model.MinimumOrder),
+		IconID:       iconID,
+		CreatedAt:    model.CreatedAt.Unix(),
+		UpdatedAt:    model.UpdatedAt.Unix(),
+	}
 }
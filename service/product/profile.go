@@ -0,0 +1,288 @@
+package product
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-common/database"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"github.com/paper-trade-chatbot/be-product/dao/productDao"
+	"github.com/paper-trade-chatbot/be-product/dao/productProfileDao"
+	"github.com/paper-trade-chatbot/be-product/dao/productProfileDescriptionDao"
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+	"github.com/paper-trade-chatbot/be-product/service/grpcError"
+	"golang.org/x/text/language"
+	"gorm.io/gorm"
+)
+
+type LocalizedDescription struct {
+	Locale      string
+	Description string
+}
+
+// ProductProfile is the company profile of a stock, kept out of the product
+// row since only the product card needs it.
+type ProductProfile struct {
+	ProductID              int64
+	Website                string
+	ListingDate            *int64
+	SharesOutstanding      *int64
+	CountryOfIncorporation string
+	MarketSegment          string
+	// Description is the one picked for the requested locale
+	Description *LocalizedDescription
+	UpdatedAt   int64
+}
+
+type GetProductProfileReq struct {
+	ProductID int64
+	Locale    string
+}
+
+type GetProductProfileRes struct {
+	Profile *ProductProfile
+	// Description has every locale
+	Description []*LocalizedDescription
+}
+
+// UpsertProductProfileReq leaves nil fields untouched, an empty value clears
+// the field.
+type UpsertProductProfileReq struct {
+	ProductID              int64
+	Website                *string
+	ListingDate            *int64 // unix time, only the date part is used, 0 clears it
+	SharesOutstanding      *int64 // 0 clears it
+	CountryOfIncorporation *string
+	MarketSegment          *string
+	// Description is upserted by locale, the other locales are kept
+	Description []*LocalizedDescription
+}
+
+type UpsertProductProfileRes struct{}
+
+func (impl *ProductImpl) GetProductProfile(ctx context.Context, in *GetProductProfileReq) (*GetProductProfileRes, error) {
+	db := database.GetDB()
+
+	if in.ProductID == 0 {
+		return nil, grpcError.InvalidArgument("productID", "is required")
+	}
+
+	model, err := productProfileDao.Get(db, &productProfileDao.QueryModel{ProductID: uint64(in.ProductID)})
+	if err != nil {
+		return nil, err
+	}
+	if model == nil {
+		return nil, grpcError.NotFound("product", in.ProductID)
+	}
+
+	descriptionModels, err := productProfileDescriptionDao.Gets(db, &productProfileDescriptionDao.QueryModel{ProductID: model.ProductID})
+	if err != nil {
+		return nil, err
+	}
+
+	descriptions := make([]*LocalizedDescription, 0, len(descriptionModels))
+	for _, d := range descriptionModels {
+		descriptions = append(descriptions, &LocalizedDescription{
+			Locale:      d.Locale,
+			Description: d.Description,
+		})
+	}
+
+	return &GetProductProfileRes{
+		Profile:     productProfileModelToService(model, localizeDescription(descriptionModels, in.Locale)),
+		Description: descriptions,
+	}, nil
+}
+
+func (impl *ProductImpl) UpsertProductProfile(ctx context.Context, in *UpsertProductProfileReq) (*UpsertProductProfileRes, error) {
+	db := database.GetDB()
+
+	logging.Info(ctx, "[UpsertProductProfile] product %d", in.ProductID)
+
+	v := grpcError.Violations{}
+	if in.ProductID == 0 {
+		v.Add("productID", "is required")
+	}
+
+	updates := map[string]interface{}{}
+	if in.Website != nil {
+		website := strings.TrimSpace(*in.Website)
+		if website != "" {
+			u, err := url.Parse(website)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				v.Add("website", "%q is not an http or https URL", website)
+			}
+		}
+		updates["website"] = website
+	}
+	if in.ListingDate != nil {
+		var listingDate sql.NullTime
+		if *in.ListingDate != 0 {
+			listingDate = sql.NullTime{Time: truncateDate(time.Unix(*in.ListingDate, 0).UTC()), Valid: true}
+		}
+		updates["listing_date"] = listingDate
+	}
+	if in.SharesOutstanding != nil {
+		if *in.SharesOutstanding < 0 {
+			v.Add("sharesOutstanding", "must not be negative")
+		}
+		var shares sql.NullInt64
+		if *in.SharesOutstanding != 0 {
+			shares = sql.NullInt64{Int64: *in.SharesOutstanding, Valid: true}
+		}
+		updates["shares_outstanding"] = shares
+	}
+	if in.CountryOfIncorporation != nil {
+		country := strings.ToUpper(strings.TrimSpace(*in.CountryOfIncorporation))
+		if country != "" {
+			region, err := language.ParseRegion(country)
+			if err != nil || !region.IsCountry() || len(country) != 2 {
+				v.Add("countryOfIncorporation", "%q is not an ISO 3166-1 alpha-2 country", country)
+			}
+		}
+		updates["country_of_incorporation"] = country
+	}
+	if in.MarketSegment != nil {
+		updates["market_segment"] = strings.TrimSpace(*in.MarketSegment)
+	}
+
+	descriptions := make([]*models.ProductProfileDescriptionModel, 0, len(in.Description))
+	for i, d := range in.Description {
+		if d == nil || strings.TrimSpace(d.Description) == "" {
+			v.Add(fmt.Sprintf("description[%d].description", i), "is required")
+			continue
+		}
+		locale, err := canonicalLocale(d.Locale)
+		if err != nil {
+			v.Add(fmt.Sprintf("description[%d].locale", i), "%q is not a BCP 47 tag", d.Locale)
+			continue
+		}
+		descriptions = append(descriptions, &models.ProductProfileDescriptionModel{
+			Locale:      locale,
+			Description: strings.TrimSpace(d.Description),
+		})
+	}
+
+	if err := v.InvalidArgument(); err != nil {
+		return nil, err
+	}
+
+	productModel, err := productDao.Get(db, &productDao.QueryModel{ID: uint64(in.ProductID)})
+	if err != nil {
+		return nil, err
+	}
+	if productModel == nil {
+		return nil, grpcError.NotFound("product", in.ProductID)
+	}
+	if productModel.Type != models.ProductType_Stock {
+		return nil, grpcError.InvalidArgument("productID", "product %d is no stock", productModel.ID)
+	}
+
+	err = database.Transaction(db, func(tx *gorm.DB) error {
+		model, err := productProfileDao.Get(tx, &productProfileDao.QueryModel{ProductID: productModel.ID})
+		if err != nil {
+			return err
+		}
+		if model == nil {
+			model = &models.ProductProfileModel{ProductID: productModel.ID}
+			if _, err := productProfileDao.New(tx, model); err != nil {
+				return err
+			}
+		}
+		if len(updates) > 0 {
+			if err := productProfileDao.Modify(tx, model, updates); err != nil {
+				return err
+			}
+		}
+		for _, d := range descriptions {
+			d.ProductID = productModel.ID
+			if err := productProfileDescriptionDao.Upsert(tx, d); err != nil {
+				return err
+			}
+		}
+
+		changes := map[string]interface{}{}
+		for k, v := range updates {
+			changes[k] = v
+		}
+		if len(descriptions) > 0 {
+			locales := make([]string, 0, len(descriptions))
+			for _, d := range descriptions {
+				locales = append(locales, d.Locale)
+			}
+			changes["descriptions"] = locales
+		}
+		return productDao.Touch(tx, productModel, map[string]interface{}{
+			"profile": changes,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	impl.productsChanged(ctx, productModel)
+
+	return &UpsertProductProfileRes{}, nil
+}
+
+// productProfile loads the profile with the description of the locale, nil
+// when the product has no profile.
+func productProfile(db *gorm.DB, productID uint64, locale string) (*ProductProfile, error) {
+	model, err := productProfileDao.Get(db, &productProfileDao.QueryModel{ProductID: productID})
+	if err != nil {
+		return nil, err
+	}
+	if model == nil {
+		return nil, nil
+	}
+
+	descriptionModels, err := productProfileDescriptionDao.Gets(db, &productProfileDescriptionDao.QueryModel{
+		ProductID: productID,
+		Locales:   localeFallbacks(locale),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return productProfileModelToService(model, localizeDescription(descriptionModels, locale)), nil
+}
+
+// localizeDescription picks the best description among the ones of a product
+func localizeDescription(descriptions []models.ProductProfileDescriptionModel, locale string) *models.ProductProfileDescriptionModel {
+	for _, f := range localeFallbacks(locale) {
+		for i := range descriptions {
+			if descriptions[i].Locale == f {
+				return &descriptions[i]
+			}
+		}
+	}
+	return nil
+}
+
+func productProfileModelToService(model *models.ProductProfileModel, description *models.ProductProfileDescriptionModel) *ProductProfile {
+	profile := &ProductProfile{
+		ProductID:              int64(model.ProductID),
+		Website:                model.Website,
+		CountryOfIncorporation: model.CountryOfIncorporation,
+		MarketSegment:          model.MarketSegment,
+		UpdatedAt:              model.UpdatedAt.Unix(),
+	}
+	if model.ListingDate.Valid {
+		listingDate := model.ListingDate.Time.Unix()
+		profile.ListingDate = &listingDate
+	}
+	if model.SharesOutstanding.Valid {
+		shares := model.SharesOutstanding.Int64
+		profile.SharesOutstanding = &shares
+	}
+	if description != nil {
+		profile.Description = &LocalizedDescription{
+			Locale:      description.Locale,
+			Description: description.Description,
+		}
+	}
+	return profile
+}
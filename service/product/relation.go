@@ -0,0 +1,552 @@
+package product
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-common/database"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"github.com/paper-trade-chatbot/be-product/dao/productDao"
+	"github.com/paper-trade-chatbot/be-product/dao/productRelationDao"
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+	"github.com/paper-trade-chatbot/be-product/service/grpcError"
+	"github.com/paper-trade-chatbot/be-proto/product"
+	"gorm.io/gorm"
+)
+
+// maxTotalWeight leaves room for the rounding of published weights
+const maxTotalWeight = 100.01
+
+// RelationType reads as "product is <type> related product", e.g. 2330 is
+// constituent of 0050. Options keep their underlying in option_contract.
+type RelationType int
+
+const (
+	RelationType_None RelationType = iota
+	RelationType_ConstituentOf
+	RelationType_UnderlyingOf
+	RelationType_ADROf
+	RelationType_DualListedWith
+)
+
+type RelationDirection int
+
+const (
+	// RelationDirection_Both is every relation the product is part of
+	RelationDirection_Both RelationDirection = iota
+	// RelationDirection_Outgoing is "product is <type> X", e.g. the ETFs holding 2330
+	RelationDirection_Outgoing
+	// RelationDirection_Incoming is "X is <type> product", e.g. what is in 0050
+	RelationDirection_Incoming
+)
+
+type Constituent struct {
+	ProductID int64
+	// Weight is in percent
+	Weight float64
+}
+
+type SetConstituentsReq struct {
+	// ProductID is the index or ETF
+	ProductID     int64
+	EffectiveDate int64 // unix time, only the date part is used
+	Constituent   []*Constituent
+}
+
+type SetConstituentsRes struct{}
+
+type SetProductRelationReq struct {
+	ProductID        int64
+	RelatedProductID int64
+	Type             RelationType
+	EffectiveDate    int64 // unix time, today when empty
+}
+
+type SetProductRelationRes struct{}
+
+type DeleteProductRelationReq struct {
+	ProductID        int64
+	RelatedProductID int64
+	Type             RelationType
+}
+
+type DeleteProductRelationRes struct{}
+
+type GetProductRelationsReq struct {
+	ProductID int64
+	Direction RelationDirection
+	// Type is every type when empty
+	Type []RelationType
+	// AsOf is unix time, today when empty
+	AsOf   int64
+	Locale string
+}
+
+type GetProductRelationsRes struct {
+	Relation []*ProductRelation
+}
+
+type ProductRelation struct {
+	Type      RelationType
+	Direction RelationDirection
+	// Product is the other side of the relation
+	Product       *product.Product
+	Weight        *float64
+	EffectiveDate int64
+}
+
+// SetConstituents replaces the constituents of an index or ETF from the
+// effective date on, earlier snapshots are kept for AsOf queries.
+func (impl *ProductImpl) SetConstituents(ctx context.Context, in *SetConstituentsReq) (*SetConstituentsRes, error) {
+	db := database.GetDB()
+
+	logging.Info(ctx, "[SetConstituents] product %d, %d constituents", in.ProductID, len(in.Constituent))
+
+	v := grpcError.Violations{}
+	if in.ProductID == 0 {
+		v.Add("productID", "is required")
+	}
+	if in.EffectiveDate == 0 {
+		v.Add("effectiveDate", "is required")
+	}
+	if len(in.Constituent) == 0 {
+		v.Add("constituent", "is required")
+	}
+	if err := v.InvalidArgument(); err != nil {
+		return nil, err
+	}
+	effectiveDate := truncateDate(time.Unix(in.EffectiveDate, 0).UTC())
+
+	ids := []uint64{}
+	totalWeight := 0.0
+	seen := map[int64]bool{}
+	for i, c := range in.Constituent {
+		if c == nil || c.ProductID == 0 {
+			v.Add(fmt.Sprintf("constituent[%d].productID", i), "is required")
+			continue
+		}
+		switch {
+		case c.ProductID == in.ProductID:
+			v.Add(fmt.Sprintf("constituent[%d].productID", i), "must not be the index itself")
+		case seen[c.ProductID]:
+			v.Add(fmt.Sprintf("constituent[%d].productID", i), "product %d is listed twice", c.ProductID)
+		case c.Weight <= 0 || c.Weight > 100 || math.IsNaN(c.Weight):
+			v.Add(fmt.Sprintf("constituent[%d].weight", i), "must be above 0 and at most 100")
+		}
+		seen[c.ProductID] = true
+		totalWeight += c.Weight
+		ids = append(ids, uint64(c.ProductID))
+	}
+	if totalWeight > maxTotalWeight {
+		v.Add("constituent", "weights add up to %g, more than %g", totalWeight, maxTotalWeight)
+	}
+	if err := v.InvalidArgument(); err != nil {
+		return nil, err
+	}
+
+	var changed []*models.ProductModel
+	err := database.Transaction(db, func(tx *gorm.DB) error {
+		productModels, err := productDao.Gets(tx, &productDao.QueryModel{IDs: append([]uint64{uint64(in.ProductID)}, ids...)})
+		if err != nil {
+			return err
+		}
+		if len(productModels) != len(ids)+1 {
+			return grpcError.NotFound("product", missingProduct(append([]uint64{uint64(in.ProductID)}, ids...), productModels))
+		}
+
+		if _, err := productRelationDao.Delete(tx, &productRelationDao.QueryModel{
+			RelatedProductID: uint64(in.ProductID),
+			RelationTypes:    []models.RelationType{models.RelationType_ConstituentOf},
+			EffectiveDate:    effectiveDate,
+		}); err != nil {
+			return err
+		}
+
+		for _, c := range in.Constituent {
+			if _, err := productRelationDao.New(tx, &models.ProductRelationModel{
+				ProductID:        uint64(c.ProductID),
+				RelatedProductID: uint64(in.ProductID),
+				RelationType:     models.RelationType_ConstituentOf,
+				Weight:           sql.NullFloat64{Float64: c.Weight, Valid: true},
+				EffectiveDate:    effectiveDate,
+			}); err != nil {
+				return err
+			}
+		}
+		changed, err = touchProducts(tx, productModels, map[string]interface{}{
+			"constituents": map[string]interface{}{
+				"indexID":       in.ProductID,
+				"effectiveDate": effectiveDate,
+			},
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	impl.productsChanged(ctx, changed...)
+
+	return &SetConstituentsRes{}, nil
+}
+
+// SetProductRelation sets an underlying-of, ADR-of or dual-listed-with
+// relation, replacing the previous one between the two products.
+func (impl *ProductImpl) SetProductRelation(ctx context.Context, in *SetProductRelationReq) (*SetProductRelationRes, error) {
+	db := database.GetDB()
+
+	logging.Info(ctx, "[SetProductRelation] %d %d %d", in.ProductID, in.Type, in.RelatedProductID)
+
+	v := grpcError.Violations{}
+	if in.ProductID == 0 {
+		v.Add("productID", "is required")
+	}
+	if in.RelatedProductID == 0 {
+		v.Add("relatedProductID", "is required")
+	} else if in.ProductID == in.RelatedProductID {
+		v.Add("relatedProductID", "must not be the product itself")
+	}
+	if !isPairRelation(in.Type) {
+		v.Add("type", "%d is not a pair relation", in.Type)
+	}
+	if err := v.InvalidArgument(); err != nil {
+		return nil, err
+	}
+
+	effectiveDate := truncateDate(time.Now().UTC())
+	if in.EffectiveDate != 0 {
+		effectiveDate = truncateDate(time.Unix(in.EffectiveDate, 0).UTC())
+	}
+	productID, relatedProductID := relationPair(in.Type, uint64(in.ProductID), uint64(in.RelatedProductID))
+
+	var changed []*models.ProductModel
+	err := database.Transaction(db, func(tx *gorm.DB) error {
+		productModels, err := productDao.Gets(tx, &productDao.QueryModel{IDs: []uint64{productID, relatedProductID}})
+		if err != nil {
+			return err
+		}
+		if len(productModels) != 2 {
+			return grpcError.NotFound("product", missingProduct([]uint64{productID, relatedProductID}, productModels))
+		}
+
+		if _, err := productRelationDao.Delete(tx, &productRelationDao.QueryModel{
+			ProductID:        productID,
+			RelatedProductID: relatedProductID,
+			RelationTypes:    []models.RelationType{models.RelationType(in.Type)},
+		}); err != nil {
+			return err
+		}
+
+		_, err = productRelationDao.New(tx, &models.ProductRelationModel{
+			ProductID:        productID,
+			RelatedProductID: relatedProductID,
+			RelationType:     models.RelationType(in.Type),
+			EffectiveDate:    effectiveDate,
+		})
+		if err != nil {
+			return err
+		}
+		changed, err = touchProducts(tx, productModels, relationChanges(in.Type, productID, relatedProductID, true))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	impl.productsChanged(ctx, changed...)
+
+	return &SetProductRelationRes{}, nil
+}
+
+func (impl *ProductImpl) DeleteProductRelation(ctx context.Context, in *DeleteProductRelationReq) (*DeleteProductRelationRes, error) {
+	db := database.GetDB()
+
+	logging.Info(ctx, "[DeleteProductRelation] %d %d %d", in.ProductID, in.Type, in.RelatedProductID)
+
+	v := grpcError.Violations{}
+	if in.ProductID == 0 {
+		v.Add("productID", "is required")
+	}
+	if in.RelatedProductID == 0 {
+		v.Add("relatedProductID", "is required")
+	}
+	// constituents leave an index through a new SetConstituents snapshot
+	if !isPairRelation(in.Type) {
+		v.Add("type", "%d is not a pair relation", in.Type)
+	}
+	if err := v.InvalidArgument(); err != nil {
+		return nil, err
+	}
+
+	productID, relatedProductID := relationPair(in.Type, uint64(in.ProductID), uint64(in.RelatedProductID))
+	var changed []*models.ProductModel
+	err := database.Transaction(db, func(tx *gorm.DB) error {
+		deleted, err := productRelationDao.Delete(tx, &productRelationDao.QueryModel{
+			ProductID:        productID,
+			RelatedProductID: relatedProductID,
+			RelationTypes:    []models.RelationType{models.RelationType(in.Type)},
+		})
+		if err != nil {
+			return err
+		}
+		if deleted == 0 {
+			return grpcError.NotFound("relation", fmt.Sprintf("%d %d %d", in.ProductID, in.Type, in.RelatedProductID))
+		}
+
+		productModels, err := productDao.Gets(tx, &productDao.QueryModel{IDs: []uint64{productID, relatedProductID}})
+		if err != nil {
+			return err
+		}
+		changed, err = touchProducts(tx, productModels, relationChanges(in.Type, productID, relatedProductID, false))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	impl.productsChanged(ctx, changed...)
+
+	return &DeleteProductRelationRes{}, nil
+}
+
+// relationChanges is the change a pair relation set or deleted makes to both
+// of its products.
+func relationChanges(t RelationType, productID, relatedProductID uint64, set bool) map[string]interface{} {
+	return map[string]interface{}{
+		"relation": map[string]interface{}{
+			"type":             t,
+			"productID":        productID,
+			"relatedProductID": relatedProductID,
+			"set":              set,
+		},
+	}
+}
+
+func (impl *ProductImpl) GetProductRelations(ctx context.Context, in *GetProductRelationsReq) (*GetProductRelationsRes, error) {
+	db := database.GetDB()
+
+	if in.ProductID == 0 {
+		return nil, grpcError.InvalidArgument("productID", "is required")
+	}
+
+	asOf := truncateDate(time.Now().UTC())
+	if in.AsOf != 0 {
+		asOf = truncateDate(time.Unix(in.AsOf, 0).UTC())
+	}
+
+	types := []models.RelationType{}
+	for _, t := range in.Type {
+		types = append(types, models.RelationType(t))
+	}
+	hasType := func(t models.RelationType) bool {
+		if len(types) == 0 {
+			return true
+		}
+		for _, tt := range types {
+			if tt == t {
+				return true
+			}
+		}
+		return false
+	}
+
+	productID := uint64(in.ProductID)
+	relations := []*relationRow{}
+
+	if in.Direction != RelationDirection_Incoming {
+		rows, err := outgoingRelations(db, productID, types, asOf)
+		if err != nil {
+			return nil, err
+		}
+		relations = append(relations, rows...)
+	} else if hasType(models.RelationType_DualListedWith) {
+		// dual listing has no direction, it is stored once for both products
+		rows, err := outgoingRelations(db, productID, []models.RelationType{models.RelationType_DualListedWith}, asOf)
+		if err != nil {
+			return nil, err
+		}
+		relations = append(relations, rows...)
+	}
+
+	if in.Direction != RelationDirection_Outgoing {
+		rows, err := incomingRelations(db, productID, types, asOf)
+		if err != nil {
+			return nil, err
+		}
+		relations = append(relations, rows...)
+	} else if hasType(models.RelationType_DualListedWith) {
+		rows, err := incomingRelations(db, productID, []models.RelationType{models.RelationType_DualListedWith}, asOf)
+		if err != nil {
+			return nil, err
+		}
+		relations = append(relations, rows...)
+	}
+
+	res := &GetProductRelationsRes{
+		Relation: []*ProductRelation{},
+	}
+	if len(relations) == 0 {
+		return res, nil
+	}
+
+	otherIDs := make([]uint64, 0, len(relations))
+	for _, r := range relations {
+		otherIDs = append(otherIDs, r.otherID)
+	}
+	productModels, err := productDao.Gets(db, &productDao.QueryModel{IDs: otherIDs})
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uint64]*models.ProductModel, len(productModels))
+	for i := range productModels {
+		byID[productModels[i].ID] = &productModels[i]
+	}
+	names, err := impl.localizeNames(db, otherIDs, in.Locale)
+	if err != nil {
+		return nil, err
+	}
+
+	products := make([]*product.Product, 0, len(relations))
+	for _, r := range relations {
+		m, ok := byID[r.otherID]
+		if !ok {
+			continue
+		}
+		p := productModelToGrpc(m)
+		applyLocalizedName(p, &ProductExt{}, names[r.otherID])
+
+		relation := &ProductRelation{
+			Type:          RelationType(r.model.RelationType),
+			Direction:     r.direction,
+			Product:       p,
+			EffectiveDate: r.model.EffectiveDate.Unix(),
+		}
+		if r.model.Weight.Valid {
+			weight := r.model.Weight.Float64
+			relation.Weight = &weight
+		}
+		res.Relation = append(res.Relation, relation)
+		products = append(products, p)
+	}
+	if err := impl.applyExchangeDefaults(ctx, db, products); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// relationRow is a relation seen from the requested product
+type relationRow struct {
+	model     models.ProductRelationModel
+	direction RelationDirection
+	otherID   uint64
+}
+
+// outgoingRelations finds "product is <type> X". A constituent row only
+// counts when it belongs to the latest snapshot of X.
+func outgoingRelations(db *gorm.DB, productID uint64, types []models.RelationType, asOf time.Time) ([]*relationRow, error) {
+	rows, err := productRelationDao.Gets(db, &productRelationDao.QueryModel{
+		ProductID:      productID,
+		RelationTypes:  types,
+		EffectiveUntil: asOf,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	baskets := []uint64{}
+	for _, r := range rows {
+		if r.RelationType == models.RelationType_ConstituentOf {
+			baskets = append(baskets, r.RelatedProductID)
+		}
+	}
+	latest := map[uint64]time.Time{}
+	if len(baskets) > 0 {
+		latest, err = productRelationDao.LatestEffectiveDates(db, &productRelationDao.QueryModel{
+			RelatedProductIDs: baskets,
+			RelationTypes:     []models.RelationType{models.RelationType_ConstituentOf},
+			EffectiveUntil:    asOf,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result := []*relationRow{}
+	seen := map[relationKey]bool{}
+	for _, r := range rows {
+		if r.RelationType == models.RelationType_ConstituentOf && !r.EffectiveDate.Equal(latest[r.RelatedProductID]) {
+			continue
+		}
+		key := relationKey{otherID: r.RelatedProductID, relationType: r.RelationType}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, &relationRow{
+			model:     r,
+			direction: RelationDirection_Outgoing,
+			otherID:   r.RelatedProductID,
+		})
+	}
+	return result, nil
+}
+
+// incomingRelations finds "X is <type> product", constituents are taken from
+// the latest snapshot of the product.
+func incomingRelations(db *gorm.DB, productID uint64, types []models.RelationType, asOf time.Time) ([]*relationRow, error) {
+	rows, err := productRelationDao.Gets(db, &productRelationDao.QueryModel{
+		RelatedProductID: productID,
+		RelationTypes:    types,
+		EffectiveUntil:   asOf,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// rows are sorted by effective date, newest first
+	var snapshot time.Time
+	for _, r := range rows {
+		if r.RelationType == models.RelationType_ConstituentOf {
+			snapshot = r.EffectiveDate
+			break
+		}
+	}
+
+	result := []*relationRow{}
+	seen := map[relationKey]bool{}
+	for _, r := range rows {
+		if r.RelationType == models.RelationType_ConstituentOf && !r.EffectiveDate.Equal(snapshot) {
+			continue
+		}
+		key := relationKey{otherID: r.ProductID, relationType: r.RelationType}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, &relationRow{
+			model:     r,
+			direction: RelationDirection_Incoming,
+			otherID:   r.ProductID,
+		})
+	}
+	return result, nil
+}
+
+type relationKey struct {
+	otherID      uint64
+	relationType models.RelationType
+}
+
+// isPairRelation tells the relation types set one pair at a time
+func isPairRelation(t RelationType) bool {
+	return t == RelationType_UnderlyingOf || t == RelationType_ADROf || t == RelationType_DualListedWith
+}
+
+// relationPair orders a dual listing by id, so that it is stored once
+func relationPair(t RelationType, productID, relatedProductID uint64) (uint64, uint64) {
+	if t == RelationType_DualListedWith && relatedProductID < productID {
+		return relatedProductID, productID
+	}
+	return productID, relatedProductID
+}
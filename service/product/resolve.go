@@ -0,0 +1,274 @@
+package product
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/paper-trade-chatbot/be-common/database"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+	"github.com/paper-trade-chatbot/be-product/service/grpcError"
+	"github.com/paper-trade-chatbot/be-product/service/searchIndex"
+	"github.com/paper-trade-chatbot/be-proto/product"
+	"golang.org/x/text/width"
+)
+
+const (
+	resolveDefaultLimit    = 5
+	resolveMaxLimit        = 20
+	resolveDefaultMinScore = 0.3
+	resolveBoostFactor     = 1.2
+)
+
+type MatchField string
+
+const (
+	MatchField_Code         MatchField = "code"
+	MatchField_Name         MatchField = "name"
+	MatchField_Alias        MatchField = "alias"
+	MatchField_VendorSymbol MatchField = "vendorSymbol"
+	MatchField_Phonetic     MatchField = "phonetic"
+)
+
+type MatchType string
+
+const (
+	MatchType_Exact    MatchType = "exact"
+	MatchType_Prefix   MatchType = "prefix"
+	MatchType_Contains MatchType = "contains"
+	MatchType_Fuzzy    MatchType = "fuzzy"
+)
+
+type ResolveProductReq struct {
+	Query            string
+	Limit            int32
+	MinScore         float64
+	ProductType      []product.ProductType
+	ExchangeCode     []string
+	BoostProductType []product.ProductType
+	BoostExchange    []string
+	Status           *product.Status
+	Display          *product.Display
+}
+
+type ResolveProductRes struct {
+	Candidate []*ResolveCandidate
+}
+
+type ResolveCandidate struct {
+	Product     *product.Product
+	Score       float64
+	MatchField  MatchField
+	MatchType   MatchType
+	MatchedText string
+}
+
+// ResolveProduct ranks the products of the search index against a free text
+// query, only the exchanges may be read from the database. The status and
+// display filters compare the effective values, taking the exchange into
+// account.
+func (impl *ProductImpl) ResolveProduct(ctx context.Context, in *ResolveProductReq) (*ResolveProductRes, error) {
+	db := database.GetDB()
+
+	query := normalizeSearchText(in.Query)
+	if query == "" {
+		return nil, grpcError.InvalidArgument("query", "is required")
+	}
+
+	phoneticQuery := normalizePhoneticQuery(query)
+
+	logging.Debug(ctx, "[ResolveProduct] %s", query)
+
+	limit := int(in.Limit)
+	if limit <= 0 {
+		limit = resolveDefaultLimit
+	}
+	if limit > resolveMaxLimit {
+		limit = resolveMaxLimit
+	}
+	minScore := in.MinScore
+	if minScore <= 0 {
+		minScore = resolveDefaultMinScore
+	}
+
+	exchanges, err := impl.exchangesByCode(db)
+	if err != nil {
+		return nil, err
+	}
+
+	// every spelling of the products is in the search index already
+	filter := &searchIndex.Filter{
+		ExchangeCodes: in.ExchangeCode,
+		Effective:     effectiveFilter(exchanges),
+	}
+	for _, t := range in.ProductType {
+		filter.ProductTypes = append(filter.ProductTypes, models.ProductType(t))
+	}
+	if in.Status != nil {
+		filter.Status = int(*in.Status)
+	}
+	if in.Display != nil {
+		filter.Display = int(*in.Display)
+	}
+	docs := impl.searchIndex.Documents(filter)
+
+	boostExchange := map[string]bool{}
+	for _, e := range in.BoostExchange {
+		boostExchange[e] = true
+	}
+	boostType := map[product.ProductType]bool{}
+	for _, t := range in.BoostProductType {
+		boostType[t] = true
+	}
+
+	candidates := []*ResolveCandidate{}
+	for _, d := range docs {
+		m := &d.Product
+
+		best := &ResolveCandidate{}
+		for _, term := range d.Terms {
+			field := searchIndexMatchField[term.Field]
+			text := normalizeSearchText(term.Text)
+			q := query
+			if field == MatchField_Phonetic {
+				q = phoneticQuery
+			}
+			score, matchType := matchScore(q, text)
+			score *= searchIndex.FieldWeight[term.Field]
+			if score > best.Score {
+				best.Score = score
+				best.MatchField = field
+				best.MatchType = matchType
+				best.MatchedText = text
+			}
+		}
+		if best.Score == 0 {
+			continue
+		}
+
+		if boostExchange[m.ExchangeCode] {
+			best.Score *= resolveBoostFactor
+		}
+		if boostType[product.ProductType(m.Type)] {
+			best.Score *= resolveBoostFactor
+		}
+		if best.Score < minScore {
+			continue
+		}
+
+		best.Product = productModelToGrpc(m)
+		candidates = append(candidates, best)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Score != candidates[j].Score {
+			return candidates[i].Score > candidates[j].Score
+		}
+		return candidates[i].Product.Id < candidates[j].Product.Id
+	})
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+
+	products := make([]*product.Product, 0, len(candidates))
+	for _, c := range candidates {
+		products = append(products, c.Product)
+	}
+	applyExchangeModels(products, exchanges)
+
+	return &ResolveProductRes{
+		Candidate: candidates,
+	}, nil
+}
+
+// normalizeSearchText folds full-width characters and case so that "ＴＳＭＣ" matches "tsmc"
+func normalizeSearchText(text string) string {
+	return strings.ToLower(strings.TrimSpace(width.Fold.String(text)))
+}
+
+// matchScore scores how well query matches text, between 0 and 1.
+func matchScore(query, text string) (float64, MatchType) {
+	if query == "" || text == "" {
+		return 0, ""
+	}
+
+	queryLen := utf8.RuneCountInString(query)
+	textLen := utf8.RuneCountInString(text)
+
+	switch {
+	case query == text:
+		return 1, MatchType_Exact
+	case strings.HasPrefix(text, query):
+		return 0.7 + 0.2*float64(queryLen)/float64(textLen), MatchType_Prefix
+	case strings.Contains(text, query):
+		return 0.5 + 0.2*float64(queryLen)/float64(textLen), MatchType_Contains
+	}
+
+	// typos are only forgiven against a similar length, otherwise every short
+	// code would be a fuzzy hit of every other short code
+	maxDistance := queryLen / 4
+	if maxDistance == 0 || absInt(queryLen-textLen) > maxDistance {
+		return 0, ""
+	}
+	distance := editDistance(query, text, maxDistance)
+	if distance > maxDistance {
+		return 0, ""
+	}
+	return 0.6 * (1 - float64(distance)/float64(maxInt(queryLen, textLen))), MatchType_Fuzzy
+}
+
+// editDistance is the Levenshtein distance over runes, it stops early and
+// returns max+1 once the distance is known to exceed max.
+func editDistance(a, b string, max int) int {
+	ra := []rune(a)
+	rb := []rune(b)
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(minInt(prev[j]+1, curr[j-1]+1), prev[j-1]+cost)
+			if curr[j] < rowMin {
+				rowMin = curr[j]
+			}
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func absInt(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
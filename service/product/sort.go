@@ -0,0 +1,172 @@
+package product
+
+import (
+	"reflect"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/paper-trade-chatbot/be-product/dao/productDao"
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+	"github.com/paper-trade-chatbot/be-product/service/grpcError"
+)
+
+const (
+	productSortMaxFields   = 5
+	productSearchMaxLength = 64
+)
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+type ProductSortField string
+
+const (
+	ProductSortField_Code      ProductSortField = "code"
+	ProductSortField_Name      ProductSortField = "name"
+	ProductSortField_CreatedAt ProductSortField = "createdAt"
+	ProductSortField_UpdatedAt ProductSortField = "updatedAt"
+	// ProductSortField_Priority is the order set on the products, see
+	// CreateProductExt.Priority
+	ProductSortField_Priority ProductSortField = "priority"
+)
+
+type ProductSort struct {
+	Field ProductSortField
+	Desc  bool
+}
+
+// productSortColumn is a column GetProducts sorts by, key reads it from a row
+// for the page token and target returns a pointer to read it back into.
+type productSortColumn struct {
+	column string
+	key    func(m *models.ProductModel) interface{}
+	target func() interface{}
+}
+
+var productSortColumns = map[ProductSortField]productSortColumn{
+	ProductSortField_Code: {
+		column: "code",
+		key:    func(m *models.ProductModel) interface{} { return m.Code },
+		target: func() interface{} { return new(string) },
+	},
+	ProductSortField_Name: {
+		column: "name",
+		key:    func(m *models.ProductModel) interface{} { return m.Name },
+		target: func() interface{} { return new(string) },
+	},
+	ProductSortField_CreatedAt: {
+		column: "created_at",
+		key:    func(m *models.ProductModel) interface{} { return m.CreatedAt },
+		target: func() interface{} { return new(time.Time) },
+	},
+	ProductSortField_UpdatedAt: {
+		column: "updated_at",
+		key:    func(m *models.ProductModel) interface{} { return m.UpdatedAt },
+		target: func() interface{} { return new(time.Time) },
+	},
+	ProductSortField_Priority: {
+		column: "priority",
+		key:    func(m *models.ProductModel) interface{} { return m.Priority },
+		target: func() interface{} { return new(int) },
+	},
+}
+
+// productSort checks the sort of GetProducts, an unknown or repeated field is
+// a violation.
+func productSort(v *grpcError.Violations, sort []ProductSort) []productSortColumn {
+	if len(sort) > productSortMaxFields {
+		v.Add("sort", "at most %d fields", productSortMaxFields)
+		return nil
+	}
+
+	columns := []productSortColumn{}
+	seen := map[ProductSortField]bool{}
+	for _, s := range sort {
+		column, ok := productSortColumns[s.Field]
+		switch {
+		case !ok:
+			v.Add("sort", "unknown field %q", s.Field)
+			continue
+		case seen[s.Field]:
+			v.Add("sort", "field %q repeated", s.Field)
+			continue
+		}
+		seen[s.Field] = true
+		columns = append(columns, column)
+	}
+	return columns
+}
+
+// productSortFields are the fields of the dao for the sort
+func productSortFields(sort []ProductSort) []productDao.SortField {
+	fields := []productDao.SortField{}
+	for _, s := range sort {
+		fields = append(fields, productDao.SortField{
+			Column: productSortColumns[s.Field].column,
+			Desc:   s.Desc,
+		})
+	}
+	return fields
+}
+
+// productSortKey is the key of a row in a page token, the sort columns then
+// the id
+func productSortKey(columns []productSortColumn, m *models.ProductModel) []interface{} {
+	key := []interface{}{}
+	for _, c := range columns {
+		key = append(key, c.key(m))
+	}
+	return append(key, m.ID)
+}
+
+// productKeyset reads back the key of productSortKey
+func productKeyset(columns []productSortColumn, targets []interface{}) *productDao.Keyset {
+	keyset := &productDao.Keyset{}
+	for i := range columns {
+		keyset.Values = append(keyset.Values, reflect.ValueOf(targets[i]).Elem().Interface())
+	}
+	keyset.ID = *targets[len(columns)].(*uint64)
+	return keyset
+}
+
+// productKeyTargets are the pointers productKeyset reads the key from
+func productKeyTargets(columns []productSortColumn) []interface{} {
+	targets := []interface{}{}
+	for _, c := range columns {
+		targets = append(targets, c.target())
+	}
+	return append(targets, new(uint64))
+}
+
+// productSearchPattern is the LIKE pattern of GetProductsExt.Search, its
+// wildcards are matched literally.
+func productSearchPattern(v *grpcError.Violations, search string, contains bool) string {
+	search = strings.TrimSpace(search)
+	if search == "" {
+		return ""
+	}
+	if utf8.RuneCountInString(search) > productSearchMaxLength {
+		v.Add("search", "longer than %d", productSearchMaxLength)
+		return ""
+	}
+
+	pattern := likeEscaper.Replace(search) + "%"
+	if contains {
+		pattern = "%" + pattern
+	}
+	return pattern
+}
+
+// normalizeCurrencyCodes upper-cases the currency codes of a filter
+func normalizeCurrencyCodes(v *grpcError.Violations, currencyCodes []string) []string {
+	result := []string{}
+	for _, c := range currencyCodes {
+		c = strings.ToUpper(strings.TrimSpace(c))
+		if c == "" {
+			v.Add("currencyCodes", "must not be empty")
+			continue
+		}
+		result = append(result, c)
+	}
+	return result
+}
@@ -0,0 +1,317 @@
+package product
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/paper-trade-chatbot/be-common/database"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"github.com/paper-trade-chatbot/be-product/dao/exchangeDao"
+	"github.com/paper-trade-chatbot/be-product/dao/productDao"
+	"github.com/paper-trade-chatbot/be-product/dao/productStatusAuditDao"
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+	"github.com/paper-trade-chatbot/be-product/service/grpcError"
+	"github.com/paper-trade-chatbot/be-proto/product"
+	"gorm.io/gorm"
+)
+
+const productStatusAuditMaxLimit = 100
+
+// SetProductsStatusReq selects the products by exchange and/or product type,
+// at least one of them is required.
+type SetProductsStatusReq struct {
+	ExchangeCode string
+	ProductType  product.ProductType
+	Status       *product.Status
+	Display      *product.Display
+	Operator     string
+	Reason       string
+}
+
+type SetProductsStatusRes struct {
+	Affected int64
+	AuditID  int64
+}
+
+// SetExchangeStatusReq enables or disables an exchange. A disabled exchange
+// disables its products and is in an emergency closure.
+type SetExchangeStatusReq struct {
+	ExchangeCode string
+	Status       *product.Status
+	Display      *product.Display
+}
+
+type SetExchangeStatusRes struct{}
+
+type GetProductStatusAuditsReq struct {
+	ExchangeCode string
+	Limit        int32
+}
+
+type GetProductStatusAuditsRes struct {
+	Audit []*ProductStatusAudit
+}
+
+type ProductStatusAudit struct {
+	ID           int64
+	ExchangeCode string
+	ProductType  product.ProductType
+	Status       *product.Status
+	Display      *product.Display
+	Affected     int64
+	Operator     string
+	Reason       string
+	CreatedAt    int64
+}
+
+// SetProductsStatus enables or disables every product of an exchange or of a
+// product type, and records who did it in the same transaction.
+func (impl *ProductImpl) SetProductsStatus(ctx context.Context, in *SetProductsStatusReq) (*SetProductsStatusRes, error) {
+	db := database.GetDB()
+
+	logging.Info(ctx, "[SetProductsStatus] %s type %d by %s", in.ExchangeCode, in.ProductType, in.Operator)
+
+	exchangeCode := strings.TrimSpace(in.ExchangeCode)
+	operator := strings.TrimSpace(in.Operator)
+	v := grpcError.Violations{}
+	if exchangeCode == "" && in.ProductType == 0 {
+		v.Add("exchangeCode", "or productType is required")
+	}
+	if operator == "" {
+		v.Add("operator", "is required")
+	}
+	if in.Status == nil && in.Display == nil {
+		v.Add("status", "or display is required")
+	}
+	if in.Status != nil && !validToggle(int(*in.Status)) {
+		v.Add("status", "must be 1 or 2")
+	}
+	if in.Display != nil && !validToggle(int(*in.Display)) {
+		v.Add("display", "must be 1 or 2")
+	}
+	if err := v.InvalidArgument(); err != nil {
+		return nil, err
+	}
+
+	queryModel := &productDao.QueryModel{
+		ExchangeCode: exchangeCode,
+	}
+	if in.ProductType != 0 {
+		queryModel.ProductType = []models.ProductType{models.ProductType(in.ProductType)}
+	}
+
+	audit := &models.ProductStatusAuditModel{
+		ExchangeCode: exchangeCode,
+		ProductType:  models.ProductType(in.ProductType),
+		Operator:     operator,
+		Reason:       strings.TrimSpace(in.Reason),
+	}
+	updates := map[string]interface{}{}
+	if in.Status != nil {
+		updates["status"] = int(*in.Status)
+		audit.Status = sql.NullInt32{Int32: int32(*in.Status), Valid: true}
+	}
+	if in.Display != nil {
+		updates["display"] = int(*in.Display)
+		audit.Display = sql.NullInt32{Int32: int32(*in.Display), Valid: true}
+	}
+
+	var auditID uint64
+	err := database.Transaction(db, func(tx *gorm.DB) error {
+		affected, err := productDao.ModifyByQuery(tx, queryModel, updates)
+		if err != nil {
+			return err
+		}
+		audit.Affected = affected
+
+		auditID, err = productStatusAuditDao.New(tx, audit)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the catalog swap reindexes the products whose revision moved
+	impl.allProductsChanged(ctx)
+
+	return &SetProductsStatusRes{
+		Affected: audit.Affected,
+		AuditID:  int64(auditID),
+	}, nil
+}
+
+func (impl *ProductImpl) SetExchangeStatus(ctx context.Context, in *SetExchangeStatusReq) (*SetExchangeStatusRes, error) {
+	db := database.GetDB()
+
+	logging.Info(ctx, "[SetExchangeStatus] %s status %v display %v", in.ExchangeCode, in.Status, in.Display)
+
+	v := grpcError.Violations{}
+	if in.ExchangeCode == "" {
+		v.Add("exchangeCode", "is required")
+	}
+	updates := map[string]interface{}{}
+	if in.Status != nil {
+		if !validToggle(int(*in.Status)) {
+			v.Add("status", "must be enabled or disabled")
+		}
+		updates["status"] = int(*in.Status)
+	}
+	if in.Display != nil {
+		if !validToggle(int(*in.Display)) {
+			v.Add("display", "must be enabled or disabled")
+		}
+		updates["display"] = int(*in.Display)
+	}
+	if len(updates) == 0 {
+		v.Add("status", "status or display is required")
+	}
+	if err := v.InvalidArgument(); err != nil {
+		return nil, err
+	}
+
+	exchange, err := exchangeDao.Get(db, &exchangeDao.QueryModel{Code: in.ExchangeCode})
+	if err != nil {
+		return nil, err
+	}
+	if exchange == nil {
+		return nil, grpcError.NotFound("exchange", in.ExchangeCode)
+	}
+
+	if err := exchangeDao.Modify(db, exchange, updates); err != nil {
+		return nil, err
+	}
+	impl.exchangesChanged(ctx, exchange.Code)
+
+	return &SetExchangeStatusRes{}, nil
+}
+
+func (impl *ProductImpl) GetProductStatusAudits(ctx context.Context, in *GetProductStatusAuditsReq) (*GetProductStatusAuditsRes, error) {
+	db := database.GetDB()
+
+	limit := int(in.Limit)
+	if limit <= 0 || limit > productStatusAuditMaxLimit {
+		limit = productStatusAuditMaxLimit
+	}
+
+	auditModels, err := productStatusAuditDao.Gets(db, &productStatusAuditDao.QueryModel{
+		ExchangeCode: strings.TrimSpace(in.ExchangeCode),
+		Limit:        limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	audits := make([]*ProductStatusAudit, 0, len(auditModels))
+	for _, a := range auditModels {
+		audit := &ProductStatusAudit{
+			ID:           int64(a.ID),
+			ExchangeCode: a.ExchangeCode,
+			ProductType:  product.ProductType(a.ProductType),
+			Affected:     a.Affected,
+			Operator:     a.Operator,
+			Reason:       a.Reason,
+			CreatedAt:    a.CreatedAt.Unix(),
+		}
+		if a.Status.Valid {
+			status := product.Status(a.Status.Int32)
+			audit.Status = &status
+		}
+		if a.Display.Valid {
+			display := product.Display(a.Display.Int32)
+			audit.Display = &display
+		}
+		audits = append(audits, audit)
+	}
+
+	return &GetProductStatusAuditsRes{
+		Audit: audits,
+	}, nil
+}
+
+// applyExchange replaces the status and display of the products with the
+// more restrictive of their own and their exchange's, and fills in the
+// trading attributes they inherit. products and exts are parallel.
+func (impl *ProductImpl) applyExchange(ctx context.Context, db *gorm.DB, products []*product.Product, exts []*ProductExt) error {
+	byCode, err := impl.exchangesOf(ctx, db, products)
+	if err != nil {
+		return err
+	}
+
+	for i, p := range products {
+		applyExchangeModel(p, exts[i], byCode[p.ExchangeCode])
+	}
+	return nil
+}
+
+// applyExchangeModel is applyExchange for one product, e is nil when the
+// exchange is unknown.
+func applyExchangeModel(p *product.Product, ext *ProductExt, e *models.ExchangeModel) {
+	ext.ProductStatus = p.Status
+	ext.ProductDisplay = p.Display
+
+	if e == nil {
+		return
+	}
+	p.Status = product.Status(moreRestrictive(int(p.Status), e.Status))
+	p.Display = product.Display(moreRestrictive(int(p.Display), e.Display))
+	applyTradingDefaults(p, ext.Trading, e)
+}
+
+// applyExchangeModels is applyExchange for the responses without a
+// ProductExt, with the exchanges at hand.
+func applyExchangeModels(products []*product.Product, byCode map[string]*models.ExchangeModel) {
+	for _, p := range products {
+		applyExchangeModel(p, &ProductExt{Trading: grpcTradingAttributes(p)}, byCode[p.ExchangeCode])
+	}
+}
+
+// effectiveStatus is the status and display applyExchangeModel reports, e is
+// nil when the exchange is unknown.
+func effectiveStatus(m *models.ProductModel, e *models.ExchangeModel) (status int, display int) {
+	if e == nil {
+		return m.Status, m.Display
+	}
+	return moreRestrictive(m.Status, e.Status), moreRestrictive(m.Display, e.Display)
+}
+
+// effectiveFilter lets a searchIndex.Filter compare the effective status
+func effectiveFilter(byCode map[string]*models.ExchangeModel) func(m *models.ProductModel) (int, int) {
+	return func(m *models.ProductModel) (int, int) {
+		return effectiveStatus(m, byCode[m.ExchangeCode])
+	}
+}
+
+// exchangesOf looks the exchanges of the products up by code, in the catalog
+// snapshot or else the read cache
+func (impl *ProductImpl) exchangesOf(ctx context.Context, db *gorm.DB, products []*product.Product) (map[string]*models.ExchangeModel, error) {
+	byCode := map[string]*models.ExchangeModel{}
+	seen := map[string]bool{}
+	for _, p := range products {
+		if seen[p.ExchangeCode] {
+			continue
+		}
+		seen[p.ExchangeCode] = true
+
+		e, err := impl.lookupExchange(ctx, db, &exchangeDao.QueryModel{Code: p.ExchangeCode})
+		if err != nil {
+			return nil, err
+		}
+		if e != nil {
+			byCode[p.ExchangeCode] = e
+		}
+	}
+	return byCode, nil
+}
+
+// moreRestrictive picks disabled (2) over enabled (1)
+func moreRestrictive(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func validToggle(value int) bool {
+	return value == 1 || value == 2
+}
@@ -0,0 +1,256 @@
+package product
+
+import (
+	"context"
+
+	"github.com/paper-trade-chatbot/be-common/database"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"github.com/paper-trade-chatbot/be-product/dao/productAliasDao"
+	"github.com/paper-trade-chatbot/be-product/dao/productDao"
+	"github.com/paper-trade-chatbot/be-product/dao/productNameDao"
+	"github.com/paper-trade-chatbot/be-product/dao/productPhoneticDao"
+	"github.com/paper-trade-chatbot/be-product/dao/productVendorSymbolDao"
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+	"github.com/paper-trade-chatbot/be-product/service/catalog"
+	"github.com/paper-trade-chatbot/be-product/service/grpcError"
+	"github.com/paper-trade-chatbot/be-product/service/searchIndex"
+	"github.com/paper-trade-chatbot/be-proto/product"
+	"gorm.io/gorm"
+)
+
+const (
+	suggestDefaultLimit = 10
+	suggestMaxLimit     = 50
+)
+
+// searchIndexMatchField maps the index fields onto the ones ResolveProduct reports
+var searchIndexMatchField = map[searchIndex.Field]MatchField{
+	searchIndex.Field_Code:         MatchField_Code,
+	searchIndex.Field_VendorSymbol: MatchField_VendorSymbol,
+	searchIndex.Field_Alias:        MatchField_Alias,
+	searchIndex.Field_Name:         MatchField_Name,
+	searchIndex.Field_Phonetic:     MatchField_Phonetic,
+}
+
+type SuggestProductsReq struct {
+	Prefix       string
+	Limit        int32
+	ProductType  []product.ProductType
+	ExchangeCode []string
+	Status       *product.Status
+	Display      *product.Display
+}
+
+type SuggestProductsRes struct {
+	Suggestion []*ProductSuggestion
+}
+
+type ProductSuggestion struct {
+	Product     *product.Product
+	Score       float64
+	MatchField  MatchField
+	MatchedText string
+}
+
+// SuggestProducts completes a partially typed code or name from the in-memory
+// search index, only the exchanges are read from the database before the
+// catalog snapshot is loaded. The status and display filters compare the
+// effective values, taking the exchange into account.
+func (impl *ProductImpl) SuggestProducts(ctx context.Context, in *SuggestProductsReq) (*SuggestProductsRes, error) {
+	if searchIndex.Normalize(in.Prefix) == "" {
+		return nil, grpcError.InvalidArgument("prefix", "is required")
+	}
+
+	limit := int(in.Limit)
+	if limit <= 0 {
+		limit = suggestDefaultLimit
+	}
+	if limit > suggestMaxLimit {
+		limit = suggestMaxLimit
+	}
+
+	exchanges, err := impl.exchangesByCode(database.GetDB())
+	if err != nil {
+		return nil, err
+	}
+
+	filter := &searchIndex.Filter{
+		ExchangeCodes: in.ExchangeCode,
+		Effective:     effectiveFilter(exchanges),
+	}
+	for _, t := range in.ProductType {
+		filter.ProductTypes = append(filter.ProductTypes, models.ProductType(t))
+	}
+	if in.Status != nil {
+		filter.Status = int(*in.Status)
+	}
+	if in.Display != nil {
+		filter.Display = int(*in.Display)
+	}
+
+	suggestions := impl.searchIndex.Suggest(stripZhuyinToneMarks(in.Prefix), filter, limit)
+
+	res := &SuggestProductsRes{
+		Suggestion: make([]*ProductSuggestion, 0, len(suggestions)),
+	}
+	products := make([]*product.Product, 0, len(suggestions))
+	for _, s := range suggestions {
+		p := productModelToGrpc(&s.Product)
+		res.Suggestion = append(res.Suggestion, &ProductSuggestion{
+			Product:     p,
+			Score:       s.Score,
+			MatchField:  searchIndexMatchField[s.Field],
+			MatchedText: s.MatchedText,
+		})
+		products = append(products, p)
+	}
+	applyExchangeModels(products, exchanges)
+
+	return res, nil
+}
+
+// loadSearchIndex builds the search index from every product.
+func (impl *ProductImpl) loadSearchIndex(ctx context.Context) error {
+	docs, err := searchDocuments(database.GetDB(), nil)
+	if err != nil {
+		return err
+	}
+	impl.searchIndex.Build(docs)
+
+	logging.Info(ctx, "[loadSearchIndex] %d products indexed", len(docs))
+	return nil
+}
+
+// syncSearchIndex follows the catalog swaps, so that the writes of every
+// replica reach the index: the products whose revision moved are reindexed.
+// The whole index is built on the first swap, and again on the next swap
+// after a failure.
+func (impl *ProductImpl) syncSearchIndex(previous, current *catalog.Snapshot) {
+	ctx := context.Background()
+
+	if previous == nil || impl.searchIndexStale {
+		if err := impl.loadSearchIndex(ctx); err != nil {
+			logging.Error(ctx, "[syncSearchIndex] load err: %v", err)
+			impl.searchIndexStale = true
+			return
+		}
+		impl.searchIndexStale = false
+		return
+	}
+
+	changed, removed := current.ChangedProducts(previous)
+	for _, id := range removed {
+		impl.searchIndex.Remove(id)
+	}
+	if err := impl.patchSearchIndex(changed); err != nil {
+		logging.Error(ctx, "[syncSearchIndex] err: %v", err)
+		impl.searchIndexStale = true
+	}
+}
+
+// refreshSearchIndex reindexes the given products after a committed write,
+// ahead of the catalog swap. A failure only leaves the index stale until the
+// swap, so it is logged and not returned.
+func (impl *ProductImpl) refreshSearchIndex(ctx context.Context, productIDs ...uint64) {
+	if err := impl.patchSearchIndex(productIDs); err != nil {
+		logging.Error(ctx, "[refreshSearchIndex] err: %v", err)
+	}
+}
+
+// patchSearchIndex reindexes the products, dropping those gone
+func (impl *ProductImpl) patchSearchIndex(productIDs []uint64) error {
+	if len(productIDs) == 0 {
+		return nil
+	}
+
+	docs, err := searchDocuments(database.GetDB(), productIDs)
+	if err != nil {
+		return err
+	}
+
+	found := map[uint64]bool{}
+	for _, d := range docs {
+		impl.searchIndex.Upsert(d)
+		found[d.Product.ID] = true
+	}
+	for _, id := range productIDs {
+		if !found[id] {
+			impl.searchIndex.Remove(id)
+		}
+	}
+	return nil
+}
+
+// searchDocuments collects every searchable spelling of the products, all of
+// them when productIDs is empty.
+func searchDocuments(db *gorm.DB, productIDs []uint64) ([]*searchIndex.Document, error) {
+
+	productModels, err := productDao.Gets(db, &productDao.QueryModel{IDs: productIDs})
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make(map[uint64]*searchIndex.Document, len(productModels))
+	result := make([]*searchIndex.Document, 0, len(productModels))
+	for _, m := range productModels {
+		d := &searchIndex.Document{
+			Product: m,
+			Terms: []searchIndex.Term{
+				{Field: searchIndex.Field_Code, Text: m.Code},
+				{Field: searchIndex.Field_Name, Text: m.Name},
+			},
+		}
+		docs[m.ID] = d
+		result = append(result, d)
+	}
+
+	names, err := productNameDao.Gets(db, &productNameDao.QueryModel{ProductIDs: productIDs})
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range names {
+		if d, ok := docs[n.ProductID]; ok {
+			d.Terms = append(d.Terms,
+				searchIndex.Term{Field: searchIndex.Field_Name, Text: n.ShortName},
+				searchIndex.Term{Field: searchIndex.Field_Name, Text: n.LongName},
+			)
+		}
+	}
+
+	aliases, err := productAliasDao.Gets(db, &productAliasDao.QueryModel{ProductIDs: productIDs})
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range aliases {
+		if d, ok := docs[a.ProductID]; ok {
+			d.Terms = append(d.Terms, searchIndex.Term{Field: searchIndex.Field_Alias, Text: a.Alias})
+		}
+	}
+
+	phonetics, err := productPhoneticDao.Gets(db, &productPhoneticDao.QueryModel{ProductIDs: productIDs})
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range phonetics {
+		if d, ok := docs[p.ProductID]; ok {
+			d.Terms = append(d.Terms,
+				searchIndex.Term{Field: searchIndex.Field_Phonetic, Text: p.Pinyin},
+				searchIndex.Term{Field: searchIndex.Field_Phonetic, Text: p.PinyinInitials},
+				searchIndex.Term{Field: searchIndex.Field_Phonetic, Text: p.Zhuyin},
+				searchIndex.Term{Field: searchIndex.Field_Phonetic, Text: p.ZhuyinInitials},
+			)
+		}
+	}
+
+	symbols, err := productVendorSymbolDao.Gets(db, &productVendorSymbolDao.QueryModel{ProductIDs: productIDs})
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range symbols {
+		if d, ok := docs[s.ProductID]; ok {
+			d.Terms = append(d.Terms, searchIndex.Term{Field: searchIndex.Field_VendorSymbol, Text: s.Symbol})
+		}
+	}
+
+	return result, nil
+}
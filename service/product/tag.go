@@ -0,0 +1,115 @@
+package product
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/paper-trade-chatbot/be-common/database"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"github.com/paper-trade-chatbot/be-product/dao/productDao"
+	"github.com/paper-trade-chatbot/be-product/dao/productTagDao"
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+	"github.com/paper-trade-chatbot/be-product/service/grpcError"
+	"gorm.io/gorm"
+)
+
+// maxTagLength is the size of product_tag.tag
+const maxTagLength = 32
+
+type SetProductTagsReq struct {
+	ProductID int64
+	Tag       []string
+}
+
+type SetProductTagsRes struct{}
+
+type GetProductTagsReq struct {
+	ProductID int64
+}
+
+type GetProductTagsRes struct {
+	Tag []string
+}
+
+// SetProductTags replaces every tag of the product.
+func (impl *ProductImpl) SetProductTags(ctx context.Context, in *SetProductTagsReq) (*SetProductTagsRes, error) {
+	db := database.GetDB()
+
+	logging.Info(ctx, "[SetProductTags] product %d, %d tags", in.ProductID, len(in.Tag))
+
+	if in.ProductID == 0 {
+		return nil, grpcError.InvalidArgument("productID", "is required")
+	}
+
+	tags := []string{}
+	seen := map[string]bool{}
+	for i, t := range in.Tag {
+		t = normalizeTag(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		if len([]rune(t)) > maxTagLength {
+			return nil, grpcError.InvalidArgument(fmt.Sprintf("tag[%d]", i), "longer than %d characters", maxTagLength)
+		}
+		seen[t] = true
+		tags = append(tags, t)
+	}
+
+	model, err := productDao.Get(db, &productDao.QueryModel{ID: uint64(in.ProductID)})
+	if err != nil {
+		return nil, err
+	}
+	if model == nil {
+		return nil, grpcError.NotFound("product", in.ProductID)
+	}
+
+	err = database.Transaction(db, func(tx *gorm.DB) error {
+		if err := productTagDao.Delete(tx, &productTagDao.QueryModel{ProductID: model.ID}); err != nil {
+			return err
+		}
+		for _, t := range tags {
+			if _, err := productTagDao.New(tx, &models.ProductTagModel{
+				ProductID: model.ID,
+				Tag:       t,
+			}); err != nil {
+				return err
+			}
+		}
+		return productDao.Touch(tx, model, map[string]interface{}{
+			"tags": tags,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	impl.productsChanged(ctx, model)
+
+	return &SetProductTagsRes{}, nil
+}
+
+func (impl *ProductImpl) GetProductTags(ctx context.Context, in *GetProductTagsReq) (*GetProductTagsRes, error) {
+	db := database.GetDB()
+
+	if in.ProductID == 0 {
+		return nil, grpcError.InvalidArgument("productID", "is required")
+	}
+
+	tagModels, err := productTagDao.Gets(db, &productTagDao.QueryModel{ProductID: uint64(in.ProductID)})
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make([]string, 0, len(tagModels))
+	for _, t := range tagModels {
+		tags = append(tags, t.Tag)
+	}
+
+	return &GetProductTagsRes{
+		Tag: tags,
+	}, nil
+}
+
+// normalizeTag folds case and width so that "AI" and "ａｉ" are the same tag
+func normalizeTag(tag string) string {
+	return normalizeSearchText(tag)
+}
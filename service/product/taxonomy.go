@@ -0,0 +1,420 @@
+package product
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/paper-trade-chatbot/be-common/database"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"github.com/paper-trade-chatbot/be-product/dao/productDao"
+	"github.com/paper-trade-chatbot/be-product/dao/taxonomyDao"
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+	"github.com/paper-trade-chatbot/be-product/service/grpcError"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+type TaxonomyLevel int
+
+const (
+	TaxonomyLevel_None TaxonomyLevel = iota
+	TaxonomyLevel_Sector
+	TaxonomyLevel_IndustryGroup
+	TaxonomyLevel_Industry
+	TaxonomyLevel_SubIndustry
+)
+
+type Taxonomy struct {
+	ID        int64
+	ParentID  *int64
+	Level     TaxonomyLevel
+	Code      string
+	Name      string
+	CreatedAt int64
+	UpdatedAt int64
+}
+
+type CreateTaxonomyReq struct {
+	// ParentID is empty for a sector
+	ParentID int64
+	Code     string
+	Name     string
+}
+
+type CreateTaxonomyRes struct {
+	ID int64
+}
+
+type GetTaxonomyReq struct {
+	ID   int64
+	Code string
+}
+
+type GetTaxonomyRes struct {
+	Taxonomy *Taxonomy
+	// Ancestor goes from the sector down to the parent of Taxonomy
+	Ancestor []*Taxonomy
+}
+
+type GetTaxonomiesReq struct {
+	ParentID int64
+	Level    TaxonomyLevel
+}
+
+type GetTaxonomiesRes struct {
+	Taxonomy []*Taxonomy
+}
+
+type ModifyTaxonomyReq struct {
+	ID   int64
+	Code *string
+	Name *string
+}
+
+type ModifyTaxonomyRes struct{}
+
+type DeleteTaxonomyReq struct {
+	ID int64
+}
+
+type DeleteTaxonomyRes struct{}
+
+type SetProductTaxonomyReq struct {
+	ProductID []int64
+	// TaxonomyID unassigns the products when empty
+	TaxonomyID int64
+}
+
+type SetProductTaxonomyRes struct{}
+
+func (impl *ProductImpl) CreateTaxonomy(ctx context.Context, in *CreateTaxonomyReq) (*CreateTaxonomyRes, error) {
+	db := database.GetDB()
+
+	logging.Info(ctx, "[CreateTaxonomy] %s %s under %d", in.Code, in.Name, in.ParentID)
+
+	code := strings.TrimSpace(in.Code)
+	name := strings.TrimSpace(in.Name)
+	v := grpcError.Violations{}
+	if code == "" {
+		v.Add("code", "is required")
+	}
+	if name == "" {
+		v.Add("name", "is required")
+	}
+	if err := v.InvalidArgument(); err != nil {
+		return nil, err
+	}
+
+	model := &models.TaxonomyModel{
+		Level: models.TaxonomyLevel_Sector,
+		Code:  code,
+		Name:  name,
+	}
+
+	if in.ParentID != 0 {
+		parent, err := taxonomyDao.Get(db, &taxonomyDao.QueryModel{ID: uint64(in.ParentID)})
+		if err != nil {
+			return nil, err
+		}
+		if parent == nil {
+			return nil, grpcError.NotFound("taxonomy", in.ParentID)
+		}
+		if parent.Level >= models.TaxonomyLevel_SubIndustry {
+			return nil, grpcError.InvalidArgument("parentID", "%s is a sub-industry", parent.Code)
+		}
+		model.ParentID = sql.NullInt64{Int64: int64(parent.ID), Valid: true}
+		model.Level = parent.Level + 1
+	}
+
+	taken, err := taxonomyDao.Get(db, &taxonomyDao.QueryModel{Code: code})
+	if err != nil {
+		return nil, err
+	}
+	if taken != nil {
+		return nil, grpcError.AlreadyExists("code", "%s is used by taxonomy %d", code, taken.ID)
+	}
+
+	id, err := taxonomyDao.New(db, model)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CreateTaxonomyRes{
+		ID: int64(id),
+	}, nil
+}
+
+func (impl *ProductImpl) GetTaxonomy(ctx context.Context, in *GetTaxonomyReq) (*GetTaxonomyRes, error) {
+	db := database.GetDB()
+
+	if in.ID == 0 && in.Code == "" {
+		return nil, grpcError.InvalidArgument("taxonomy", "id or code is required")
+	}
+
+	model, err := taxonomyDao.Get(db, &taxonomyDao.QueryModel{
+		ID:   uint64(in.ID),
+		Code: strings.TrimSpace(in.Code),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if model == nil {
+		if in.ID != 0 {
+			return nil, grpcError.NotFound("taxonomy", in.ID)
+		}
+		return nil, grpcError.NotFound("taxonomy", strings.TrimSpace(in.Code))
+	}
+
+	ancestors := []*Taxonomy{}
+	parentID := model.ParentID
+	for parentID.Valid {
+		parent, err := taxonomyDao.Get(db, &taxonomyDao.QueryModel{ID: uint64(parentID.Int64)})
+		if err != nil {
+			return nil, err
+		}
+		if parent == nil {
+			break
+		}
+		ancestors = append([]*Taxonomy{taxonomyModelToService(parent)}, ancestors...)
+		parentID = parent.ParentID
+	}
+
+	return &GetTaxonomyRes{
+		Taxonomy: taxonomyModelToService(model),
+		Ancestor: ancestors,
+	}, nil
+}
+
+func (impl *ProductImpl) GetTaxonomies(ctx context.Context, in *GetTaxonomiesReq) (*GetTaxonomiesRes, error) {
+	db := database.GetDB()
+
+	taxonomyModels, err := taxonomyDao.Gets(db, &taxonomyDao.QueryModel{
+		ParentID: uint64(in.ParentID),
+		Level:    models.TaxonomyLevel(in.Level),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	taxonomies := make([]*Taxonomy, 0, len(taxonomyModels))
+	for i := range taxonomyModels {
+		taxonomies = append(taxonomies, taxonomyModelToService(&taxonomyModels[i]))
+	}
+
+	return &GetTaxonomiesRes{
+		Taxonomy: taxonomies,
+	}, nil
+}
+
+func (impl *ProductImpl) ModifyTaxonomy(ctx context.Context, in *ModifyTaxonomyReq) (*ModifyTaxonomyRes, error) {
+	db := database.GetDB()
+
+	logging.Info(ctx, "[ModifyTaxonomy] %d", in.ID)
+
+	if in.ID == 0 {
+		return nil, grpcError.InvalidArgument("id", "is required")
+	}
+
+	model, err := taxonomyDao.Get(db, &taxonomyDao.QueryModel{ID: uint64(in.ID)})
+	if err != nil {
+		return nil, err
+	}
+	if model == nil {
+		return nil, grpcError.NotFound("taxonomy", in.ID)
+	}
+
+	updates := map[string]interface{}{}
+	if in.Code != nil {
+		code := strings.TrimSpace(*in.Code)
+		if code == "" {
+			return nil, grpcError.InvalidArgument("code", "must not be empty")
+		}
+		taken, err := taxonomyDao.Get(db, &taxonomyDao.QueryModel{Code: code})
+		if err != nil {
+			return nil, err
+		}
+		if taken != nil && taken.ID != model.ID {
+			return nil, grpcError.AlreadyExists("code", "%s is used by taxonomy %d", code, taken.ID)
+		}
+		updates["code"] = code
+	}
+	if in.Name != nil {
+		name := strings.TrimSpace(*in.Name)
+		if name == "" {
+			return nil, grpcError.InvalidArgument("name", "must not be empty")
+		}
+		updates["name"] = name
+	}
+
+	if len(updates) == 0 {
+		return &ModifyTaxonomyRes{}, nil
+	}
+
+	if err := taxonomyDao.Modify(db, model, updates); err != nil {
+		return nil, err
+	}
+
+	return &ModifyTaxonomyRes{}, nil
+}
+
+// DeleteTaxonomy only deletes a node without children and without products,
+// so that no product silently loses its classification.
+func (impl *ProductImpl) DeleteTaxonomy(ctx context.Context, in *DeleteTaxonomyReq) (*DeleteTaxonomyRes, error) {
+	db := database.GetDB()
+
+	logging.Info(ctx, "[DeleteTaxonomy] %d", in.ID)
+
+	if in.ID == 0 {
+		return nil, grpcError.InvalidArgument("id", "is required")
+	}
+
+	err := database.Transaction(db, func(tx *gorm.DB) error {
+		model, err := taxonomyDao.Get(tx, &taxonomyDao.QueryModel{ID: uint64(in.ID)})
+		if err != nil {
+			return err
+		}
+		if model == nil {
+			return grpcError.NotFound("taxonomy", in.ID)
+		}
+
+		child, err := taxonomyDao.Get(tx, &taxonomyDao.QueryModel{ParentID: model.ID})
+		if err != nil {
+			return err
+		}
+		if child != nil {
+			return status.Errorf(codes.FailedPrecondition, "taxonomy %s still has child %s", model.Code, child.Code)
+		}
+
+		// a deleted product still references the taxonomy
+		assigned, err := productDao.Get(tx, &productDao.QueryModel{TaxonomyIDs: []uint64{model.ID}, WithDeleted: true})
+		if err != nil {
+			return err
+		}
+		if assigned != nil {
+			return status.Errorf(codes.FailedPrecondition, "taxonomy %s is still assigned to product %d", model.Code, assigned.ID)
+		}
+
+		return taxonomyDao.Delete(tx, model)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &DeleteTaxonomyRes{}, nil
+}
+
+func (impl *ProductImpl) SetProductTaxonomy(ctx context.Context, in *SetProductTaxonomyReq) (*SetProductTaxonomyRes, error) {
+	db := database.GetDB()
+
+	logging.Info(ctx, "[SetProductTaxonomy] %d products to %d", len(in.ProductID), in.TaxonomyID)
+
+	if len(in.ProductID) == 0 {
+		return nil, grpcError.InvalidArgument("productID", "is required")
+	}
+
+	var taxonomyID sql.NullInt64
+	if in.TaxonomyID != 0 {
+		model, err := taxonomyDao.Get(db, &taxonomyDao.QueryModel{ID: uint64(in.TaxonomyID)})
+		if err != nil {
+			return nil, err
+		}
+		if model == nil {
+			return nil, grpcError.NotFound("taxonomy", in.TaxonomyID)
+		}
+		taxonomyID = sql.NullInt64{Int64: int64(model.ID), Valid: true}
+	}
+
+	ids := make([]uint64, 0, len(in.ProductID))
+	seen := map[uint64]bool{}
+	for _, id := range in.ProductID {
+		if id <= 0 {
+			return nil, grpcError.InvalidArgument("productID", "must be positive, got %d", id)
+		}
+		if seen[uint64(id)] {
+			continue
+		}
+		seen[uint64(id)] = true
+		ids = append(ids, uint64(id))
+	}
+
+	var productModels []models.ProductModel
+	err := database.Transaction(db, func(tx *gorm.DB) error {
+		var err error
+		productModels, err = productDao.Gets(tx, &productDao.QueryModel{IDs: ids})
+		if err != nil {
+			return err
+		}
+		if len(productModels) != len(ids) {
+			return grpcError.NotFound("product", missingProduct(ids, productModels))
+		}
+		for i := range productModels {
+			if err := productDao.Modify(tx, &productModels[i], map[string]interface{}{
+				"taxonomy_id": taxonomyID,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	changed := make([]*models.ProductModel, 0, len(productModels))
+	for i := range productModels {
+		changed = append(changed, &productModels[i])
+	}
+	impl.productsChanged(ctx, changed...)
+
+	return &SetProductTaxonomyRes{}, nil
+}
+
+// taxonomyWithDescendants returns the node and every node below it. The whole
+// taxonomy is a few hundred rows, so it is walked in memory.
+func taxonomyWithDescendants(db *gorm.DB, taxonomyID uint64) ([]uint64, error) {
+	taxonomyModels, err := taxonomyDao.Gets(db, &taxonomyDao.QueryModel{})
+	if err != nil {
+		return nil, err
+	}
+
+	found := false
+	children := map[uint64][]uint64{}
+	for _, t := range taxonomyModels {
+		if t.ID == taxonomyID {
+			found = true
+		}
+		if t.ParentID.Valid {
+			parentID := uint64(t.ParentID.Int64)
+			children[parentID] = append(children[parentID], t.ID)
+		}
+	}
+	if !found {
+		return nil, grpcError.NotFound("taxonomy", taxonomyID)
+	}
+
+	result := []uint64{taxonomyID}
+	for i := 0; i < len(result); i++ {
+		result = append(result, children[result[i]]...)
+	}
+	return result, nil
+}
+
+func taxonomyModelToService(model *models.TaxonomyModel) *Taxonomy {
+	var parentID *int64
+	if model.ParentID.Valid {
+		id := model.ParentID.Int64
+		parentID = &id
+	}
+
+	return &Taxonomy{
+		ID:        int64(model.ID),
+		ParentID:  parentID,
+		Level:     TaxonomyLevel(model.Level),
+		Code:      model.Code,
+		Name:      model.Name,
+		CreatedAt: model.CreatedAt.Unix(),
+		UpdatedAt: model.UpdatedAt.Unix(),
+	}
+}
@@ -0,0 +1,455 @@
+package product
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/paper-trade-chatbot/be-common/database"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"github.com/paper-trade-chatbot/be-product/dao/exchangeDao"
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+	"github.com/paper-trade-chatbot/be-product/service/grpcError"
+	"github.com/paper-trade-chatbot/be-proto/product"
+	"golang.org/x/text/currency"
+	"gorm.io/gorm"
+)
+
+type PriceLimitType string
+
+const (
+	PriceLimitType_None     PriceLimitType = PriceLimitType(models.PriceLimitType_None)
+	PriceLimitType_Percent  PriceLimitType = PriceLimitType(models.PriceLimitType_Percent)
+	PriceLimitType_Absolute PriceLimitType = PriceLimitType(models.PriceLimitType_Absolute)
+)
+
+// TickStep applies Tick to the prices from From up to the From of the next
+// step, the first step starts at 0.
+type TickStep struct {
+	From float64
+	Tick float64
+}
+
+type PriceLimitRule struct {
+	Type  PriceLimitType
+	Value float64 // percent of the reference price, or a price difference
+}
+
+// TradingAttributes are the effective trading attributes of a product, or the
+// defaults of an exchange.
+type TradingAttributes struct {
+	CurrencyCode string
+	// TickLadder has a single step when the product overrides the tick unit
+	TickLadder     []*TickStep
+	LotSize        *float64
+	MinimumOrder   *float64
+	PriceLimitRule *PriceLimitRule
+	Overridden     TradingOverridden
+}
+
+// TradingOverridden tells which attributes are set on the product itself
+// instead of being inherited from the exchange.
+type TradingOverridden struct {
+	CurrencyCode   bool
+	TickUnit       bool
+	LotSize        bool
+	MinimumOrder   bool
+	PriceLimitRule bool
+}
+
+// TradingOverride sets the trading attributes of a product. A nil field is
+// left untouched, a zero value goes back to the exchange default.
+type TradingOverride struct {
+	CurrencyCode   *string
+	TickUnit       *float64
+	LotSize        *float64
+	MinimumOrder   *float64
+	PriceLimitRule *PriceLimitRule // a zero Type goes back to the exchange default
+}
+
+type GetExchangeTradingDefaultsReq struct {
+	ExchangeCode string
+}
+
+type GetExchangeTradingDefaultsRes struct {
+	Defaults *TradingAttributes
+}
+
+// SetExchangeTradingDefaultsReq leaves nil fields untouched, an empty value
+// clears the default.
+type SetExchangeTradingDefaultsReq struct {
+	ExchangeCode   string
+	CurrencyCode   *string
+	TickLadder     []*TickStep // nil is left untouched, empty clears it
+	LotSize        *float64
+	MinimumOrder   *float64
+	PriceLimitRule *PriceLimitRule // a zero Type clears it
+}
+
+type SetExchangeTradingDefaultsRes struct{}
+
+func (impl *ProductImpl) GetExchangeTradingDefaults(ctx context.Context, in *GetExchangeTradingDefaultsReq) (*GetExchangeTradingDefaultsRes, error) {
+	db := database.GetDB()
+
+	if in.ExchangeCode == "" {
+		return nil, grpcError.InvalidArgument("exchangeCode", "is required")
+	}
+
+	exchanges, err := exchangeDao.Gets(db, &exchangeDao.QueryModel{Code: in.ExchangeCode})
+	if err != nil {
+		return nil, err
+	}
+	if len(exchanges) == 0 {
+		return nil, grpcError.NotFound("exchange", in.ExchangeCode)
+	}
+
+	return &GetExchangeTradingDefaultsRes{
+		Defaults: exchangeTradingDefaults(&exchanges[0]),
+	}, nil
+}
+
+func (impl *ProductImpl) SetExchangeTradingDefaults(ctx context.Context, in *SetExchangeTradingDefaultsReq) (*SetExchangeTradingDefaultsRes, error) {
+	db := database.GetDB()
+
+	logging.Info(ctx, "[SetExchangeTradingDefaults] %s", in.ExchangeCode)
+
+	if in.ExchangeCode == "" {
+		return nil, grpcError.InvalidArgument("exchangeCode", "is required")
+	}
+
+	override := &TradingOverride{
+		CurrencyCode:   in.CurrencyCode,
+		LotSize:        in.LotSize,
+		MinimumOrder:   in.MinimumOrder,
+		PriceLimitRule: in.PriceLimitRule,
+	}
+	if err := override.normalize(); err != nil {
+		logging.Info(ctx, "[SetExchangeTradingDefaults] err: %v", err)
+		return nil, err
+	}
+	updates := override.updates()
+
+	if in.TickLadder != nil {
+		if err := validTickLadder(in.TickLadder); err != nil {
+			logging.Info(ctx, "[SetExchangeTradingDefaults] err: %v", err)
+			return nil, grpcError.InvalidArgument("tickLadder", "%v", err)
+		}
+		updates["tick_ladder"] = encodeTickLadder(in.TickLadder)
+	}
+
+	exchanges, err := exchangeDao.Gets(db, &exchangeDao.QueryModel{Code: in.ExchangeCode})
+	if err != nil {
+		return nil, err
+	}
+	if len(exchanges) == 0 {
+		return nil, grpcError.NotFound("exchange", in.ExchangeCode)
+	}
+
+	if len(updates) == 0 {
+		return &SetExchangeTradingDefaultsRes{}, nil
+	}
+
+	if err := exchangeDao.Modify(db, &exchanges[0], updates); err != nil {
+		return nil, err
+	}
+	impl.exchangesChanged(ctx, exchanges[0].Code)
+
+	return &SetExchangeTradingDefaultsRes{}, nil
+}
+
+// normalize upper-cases the currency and validates every value that is set,
+// the currency has to be an ISO 4217 code.
+func (o *TradingOverride) normalize() error {
+	if o == nil {
+		return nil
+	}
+
+	violations := grpcError.Violations{}
+	if o.CurrencyCode != nil {
+		v := strings.ToUpper(strings.TrimSpace(*o.CurrencyCode))
+		o.CurrencyCode = &v
+		if v != "" {
+			if _, err := currency.ParseISO(v); err != nil {
+				violations.Add("currencyCode", "%s is not an ISO 4217 currency", v)
+			}
+		}
+	}
+	for _, f := range []struct {
+		field string
+		value *float64
+	}{
+		{"tickUnit", o.TickUnit},
+		{"lotSize", o.LotSize},
+		{"minimumOrder", o.MinimumOrder},
+	} {
+		if f.value != nil && *f.value < 0 {
+			violations.Add(f.field, "must not be negative")
+		}
+	}
+	if o.PriceLimitRule != nil && o.PriceLimitRule.Type != "" {
+		if err := validPriceLimitRule(o.PriceLimitRule); err != nil {
+			violations.Add("priceLimitRule", "%v", err)
+		}
+	}
+	return violations.InvalidArgument()
+}
+
+// updates returns the columns to write for the attributes that are set, the
+// product and the exchange share the column names.
+func (o *TradingOverride) updates() map[string]interface{} {
+	updates := map[string]interface{}{}
+	if o == nil {
+		return updates
+	}
+
+	if o.CurrencyCode != nil {
+		updates["currency_code"] = toNullString(*o.CurrencyCode)
+	}
+	for column, value := range map[string]*float64{
+		"tick_unit":     o.TickUnit,
+		"lot_size":      o.LotSize,
+		"minimum_order": o.MinimumOrder,
+	} {
+		if value != nil {
+			updates[column] = toNullFloat64(*value)
+		}
+	}
+	if o.PriceLimitRule != nil {
+		updates["price_limit_rule"] = encodePriceLimitRule(o.PriceLimitRule)
+	}
+	return updates
+}
+
+// apply sets the attributes on a product that is yet to be created.
+func (o *TradingOverride) apply(model *models.ProductModel) {
+	if o == nil {
+		return
+	}
+
+	if o.CurrencyCode != nil {
+		model.CurrencyCode = toNullString(*o.CurrencyCode)
+	}
+	if o.TickUnit != nil {
+		model.TickUnit = toNullFloat64(*o.TickUnit)
+	}
+	if o.LotSize != nil {
+		model.LotSize = toNullFloat64(*o.LotSize)
+	}
+	if o.MinimumOrder != nil {
+		model.MinimumOrder = toNullFloat64(*o.MinimumOrder)
+	}
+	if o.PriceLimitRule != nil {
+		model.PriceLimitRule = encodePriceLimitRule(o.PriceLimitRule)
+	}
+}
+
+// productTradingAttributes returns the attributes set on the product itself,
+// inherit fills in the rest.
+func productTradingAttributes(model *models.ProductModel) *TradingAttributes {
+	t := &TradingAttributes{
+		CurrencyCode:   model.CurrencyCode.String,
+		LotSize:        fromNullFloat64(model.LotSize),
+		MinimumOrder:   fromNullFloat64(model.MinimumOrder),
+		PriceLimitRule: decodePriceLimitRule(model.PriceLimitRule),
+	}
+	if model.TickUnit.Valid {
+		t.TickLadder = []*TickStep{{From: 0, Tick: model.TickUnit.Float64}}
+	}
+	t.Overridden = TradingOverridden{
+		CurrencyCode:   model.CurrencyCode.Valid,
+		TickUnit:       model.TickUnit.Valid,
+		LotSize:        model.LotSize.Valid,
+		MinimumOrder:   model.MinimumOrder.Valid,
+		PriceLimitRule: t.PriceLimitRule != nil,
+	}
+	return t
+}
+
+// grpcTradingAttributes is productTradingAttributes for a product whose model
+// is gone, only the attributes in Product are known.
+func grpcTradingAttributes(p *product.Product) *TradingAttributes {
+	t := &TradingAttributes{
+		CurrencyCode: p.CurrencyCode,
+		MinimumOrder: p.MinimumOrder,
+	}
+	if p.TickUnit != 0 {
+		t.TickLadder = []*TickStep{{From: 0, Tick: p.TickUnit}}
+	}
+	t.Overridden = TradingOverridden{
+		CurrencyCode: p.CurrencyCode != "",
+		TickUnit:     p.TickUnit != 0,
+		MinimumOrder: p.MinimumOrder != nil,
+	}
+	return t
+}
+
+func exchangeTradingDefaults(e *models.ExchangeModel) *TradingAttributes {
+	return &TradingAttributes{
+		CurrencyCode:   e.CurrencyCode.String,
+		TickLadder:     decodeTickLadder(e.TickLadder),
+		LotSize:        fromNullFloat64(e.LotSize),
+		MinimumOrder:   fromNullFloat64(e.MinimumOrder),
+		PriceLimitRule: decodePriceLimitRule(e.PriceLimitRule),
+	}
+}
+
+// inherit fills the attributes that are not overridden from the defaults.
+func (t *TradingAttributes) inherit(defaults *TradingAttributes) {
+	if !t.Overridden.CurrencyCode {
+		t.CurrencyCode = defaults.CurrencyCode
+	}
+	if !t.Overridden.TickUnit {
+		t.TickLadder = defaults.TickLadder
+	}
+	if !t.Overridden.LotSize {
+		t.LotSize = defaults.LotSize
+	}
+	if !t.Overridden.MinimumOrder {
+		t.MinimumOrder = defaults.MinimumOrder
+	}
+	if !t.Overridden.PriceLimitRule {
+		t.PriceLimitRule = defaults.PriceLimitRule
+	}
+}
+
+// tickUnit is the tick of the lowest prices, Product only has room for one.
+func (t *TradingAttributes) tickUnit() float64 {
+	if len(t.TickLadder) == 0 {
+		return 0
+	}
+	return t.TickLadder[0].Tick
+}
+
+// applyTradingDefaults inherits the defaults of the exchange and writes the
+// effective values back to the product.
+func applyTradingDefaults(p *product.Product, t *TradingAttributes, e *models.ExchangeModel) {
+	t.inherit(exchangeTradingDefaults(e))
+
+	p.CurrencyCode = t.CurrencyCode
+	p.TickUnit = t.tickUnit()
+	p.MinimumOrder = t.MinimumOrder
+}
+
+// applyExchangeDefaults is applyTradingDefaults for the responses without a
+// ProductExt.
+func (impl *ProductImpl) applyExchangeDefaults(ctx context.Context, db *gorm.DB, products []*product.Product) error {
+	byCode, err := impl.exchangesOf(ctx, db, products)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range products {
+		if e, ok := byCode[p.ExchangeCode]; ok {
+			applyTradingDefaults(p, grpcTradingAttributes(p), e)
+		}
+	}
+	return nil
+}
+
+func validTickLadder(steps []*TickStep) error {
+	for i, s := range steps {
+		if s == nil || s.Tick <= 0 {
+			return fmt.Errorf("tick step %d without tick", i)
+		}
+		if i == 0 && s.From != 0 {
+			return errors.New("tick ladder not starting at 0")
+		}
+		if i > 0 && s.From <= steps[i-1].From {
+			return fmt.Errorf("tick step %d not ascending", i)
+		}
+	}
+	return nil
+}
+
+func validPriceLimitRule(rule *PriceLimitRule) error {
+	switch rule.Type {
+	case PriceLimitType_None:
+		if rule.Value != 0 {
+			return errors.New("price limit value without a limit")
+		}
+	case PriceLimitType_Percent, PriceLimitType_Absolute:
+		if rule.Value <= 0 {
+			return fmt.Errorf("price limit value %v", rule.Value)
+		}
+	default:
+		return fmt.Errorf("unknown price limit type %s", rule.Type)
+	}
+	return nil
+}
+
+func encodeTickLadder(steps []*TickStep) sql.NullString {
+	if len(steps) == 0 {
+		return sql.NullString{}
+	}
+
+	ladder := make([]models.TickStep, 0, len(steps))
+	for _, s := range steps {
+		ladder = append(ladder, models.TickStep{From: s.From, Tick: s.Tick})
+	}
+	b, _ := json.Marshal(ladder)
+	return sql.NullString{String: string(b), Valid: true}
+}
+
+// decodeTickLadder ignores a ladder that does not parse, the product then
+// has no tick unit rather than failing every read.
+func decodeTickLadder(value sql.NullString) []*TickStep {
+	if !value.Valid {
+		return nil
+	}
+
+	ladder := []models.TickStep{}
+	if err := json.Unmarshal([]byte(value.String), &ladder); err != nil {
+		return nil
+	}
+	steps := make([]*TickStep, 0, len(ladder))
+	for _, s := range ladder {
+		steps = append(steps, &TickStep{From: s.From, Tick: s.Tick})
+	}
+	return steps
+}
+
+func encodePriceLimitRule(rule *PriceLimitRule) sql.NullString {
+	if rule == nil || rule.Type == "" {
+		return sql.NullString{}
+	}
+
+	b, _ := json.Marshal(models.PriceLimitRule{
+		Type:  models.PriceLimitType(rule.Type),
+		Value: rule.Value,
+	})
+	return sql.NullString{String: string(b), Valid: true}
+}
+
+func decodePriceLimitRule(value sql.NullString) *PriceLimitRule {
+	if !value.Valid {
+		return nil
+	}
+
+	rule := models.PriceLimitRule{}
+	if err := json.Unmarshal([]byte(value.String), &rule); err != nil || rule.Type == "" {
+		return nil
+	}
+	return &PriceLimitRule{
+		Type:  PriceLimitType(rule.Type),
+		Value: rule.Value,
+	}
+}
+
+// toNullFloat64 treats 0 as not set
+func toNullFloat64(value float64) sql.NullFloat64 {
+	if value == 0 {
+		return sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Float64: value, Valid: true}
+}
+
+func fromNullFloat64(value sql.NullFloat64) *float64 {
+	if !value.Valid {
+		return nil
+	}
+	v := value.Float64
+	return &v
+}
@@ -0,0 +1,289 @@
+package product
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/paper-trade-chatbot/be-common/database"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"github.com/paper-trade-chatbot/be-product/dao/productDao"
+	"github.com/paper-trade-chatbot/be-product/dao/productVendorSymbolDao"
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+	"github.com/paper-trade-chatbot/be-product/service/grpcError"
+	"github.com/paper-trade-chatbot/be-proto/product"
+	"gorm.io/gorm"
+)
+
+type VendorSymbol struct {
+	Vendor string
+	Symbol string
+}
+
+type SetVendorSymbolsReq struct {
+	ProductID int64
+	Symbol    []*VendorSymbol
+}
+
+type SetVendorSymbolsRes struct{}
+
+type DeleteVendorSymbolReq struct {
+	ProductID int64
+	Vendor    string
+}
+
+type DeleteVendorSymbolRes struct{}
+
+type GetProductByVendorSymbolReq struct {
+	Vendor string
+	Symbol string
+}
+
+type GetProductByVendorSymbolRes struct {
+	Product *product.Product
+}
+
+type ExportVendorSymbolsReq struct {
+	Vendor string
+}
+
+type ExportVendorSymbolsRes struct {
+	Mapping []*VendorSymbolMapping
+}
+
+type VendorSymbolMapping struct {
+	ProductID    int64
+	ExchangeCode string
+	Code         string
+	Symbol       string
+}
+
+func (impl *ProductImpl) SetVendorSymbols(ctx context.Context, in *SetVendorSymbolsReq) (*SetVendorSymbolsRes, error) {
+	db := database.GetDB()
+
+	logging.Info(ctx, "[SetVendorSymbols] product %d, %d symbols", in.ProductID, len(in.Symbol))
+
+	v := grpcError.Violations{}
+	if in.ProductID == 0 {
+		v.Add("productID", "is required")
+	}
+	if len(in.Symbol) == 0 {
+		v.Add("symbol", "is required")
+	}
+	for i, s := range in.Symbol {
+		if s == nil || normalizeVendor(s.Vendor) == "" {
+			v.Add(fmt.Sprintf("symbol[%d].vendor", i), "is required")
+		}
+		if s == nil || strings.TrimSpace(s.Symbol) == "" {
+			v.Add(fmt.Sprintf("symbol[%d].symbol", i), "is required")
+		}
+	}
+	if err := v.InvalidArgument(); err != nil {
+		return nil, err
+	}
+
+	model, err := productDao.Get(db, &productDao.QueryModel{ID: uint64(in.ProductID)})
+	if err != nil {
+		return nil, err
+	}
+	if model == nil {
+		return nil, grpcError.NotFound("product", in.ProductID)
+	}
+
+	err = database.Transaction(db, func(tx *gorm.DB) error {
+		for _, s := range in.Symbol {
+			// a vendor symbol can only point to one product
+			taken, err := productVendorSymbolDao.Get(tx, &productVendorSymbolDao.QueryModel{
+				Vendor: normalizeVendor(s.Vendor),
+				Symbol: strings.TrimSpace(s.Symbol),
+			})
+			if err != nil {
+				return err
+			}
+			if taken != nil && taken.ProductID != model.ID {
+				logging.Info(ctx, "[SetVendorSymbols] %s %s is mapped to product %d", s.Vendor, s.Symbol, taken.ProductID)
+				return grpcError.AlreadyExists("symbol", "%s %s is mapped to product %d", taken.Vendor, taken.Symbol, taken.ProductID)
+			}
+
+			if err := productVendorSymbolDao.Upsert(tx, &models.ProductVendorSymbolModel{
+				ProductID: model.ID,
+				Vendor:    normalizeVendor(s.Vendor),
+				Symbol:    strings.TrimSpace(s.Symbol),
+			}); err != nil {
+				return err
+			}
+		}
+		// the symbols are searchable, the other replicas reindex on the revision
+		return productDao.Touch(tx, model, map[string]interface{}{
+			"vendorSymbols": vendors(in.Symbol),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	impl.productsChanged(ctx, model)
+	impl.refreshSearchIndex(ctx, model.ID)
+
+	return &SetVendorSymbolsRes{}, nil
+}
+
+func (impl *ProductImpl) DeleteVendorSymbol(ctx context.Context, in *DeleteVendorSymbolReq) (*DeleteVendorSymbolRes, error) {
+	db := database.GetDB()
+
+	logging.Info(ctx, "[DeleteVendorSymbol] product %d, vendor %s", in.ProductID, in.Vendor)
+
+	// an empty vendor would match every mapping of the product
+	v := grpcError.Violations{}
+	if in.ProductID == 0 {
+		v.Add("productID", "is required")
+	}
+	if normalizeVendor(in.Vendor) == "" {
+		v.Add("vendor", "is required")
+	}
+	if err := v.InvalidArgument(); err != nil {
+		return nil, err
+	}
+
+	model, err := productDao.Get(db, &productDao.QueryModel{ID: uint64(in.ProductID)})
+	if err != nil {
+		return nil, err
+	}
+	if model == nil {
+		return nil, grpcError.NotFound("product", in.ProductID)
+	}
+
+	err = database.Transaction(db, func(tx *gorm.DB) error {
+		err := productVendorSymbolDao.Delete(tx, &productVendorSymbolDao.QueryModel{
+			ProductID: model.ID,
+			Vendor:    normalizeVendor(in.Vendor),
+		})
+		if err != nil {
+			return err
+		}
+		return productDao.Touch(tx, model, map[string]interface{}{
+			"vendorSymbols": []models.Vendor{normalizeVendor(in.Vendor)},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	impl.productsChanged(ctx, model)
+	impl.refreshSearchIndex(ctx, model.ID)
+
+	return &DeleteVendorSymbolRes{}, nil
+}
+
+func (impl *ProductImpl) GetProductByVendorSymbol(ctx context.Context, in *GetProductByVendorSymbolReq) (*GetProductByVendorSymbolRes, error) {
+	db := database.GetDB()
+
+	vendor := normalizeVendor(in.Vendor)
+	symbol := strings.TrimSpace(in.Symbol)
+	v := grpcError.Violations{}
+	if vendor == "" {
+		v.Add("vendor", "is required")
+	}
+	if symbol == "" {
+		v.Add("symbol", "is required")
+	}
+	if err := v.InvalidArgument(); err != nil {
+		return nil, err
+	}
+
+	mapping, err := productVendorSymbolDao.Get(db, &productVendorSymbolDao.QueryModel{
+		Vendor: vendor,
+		Symbol: symbol,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if mapping == nil {
+		return nil, grpcError.NotFound("vendor symbol", string(vendor)+":"+symbol)
+	}
+
+	model, err := impl.lookupProduct(ctx, db, &productDao.QueryModel{ID: mapping.ProductID})
+	if err != nil {
+		return nil, err
+	}
+	if model == nil {
+		return nil, grpcError.NotFound("product", mapping.ProductID)
+	}
+
+	p := productModelToGrpc(model)
+	if err := impl.applyExchangeDefaults(ctx, db, []*product.Product{p}); err != nil {
+		return nil, err
+	}
+
+	return &GetProductByVendorSymbolRes{
+		Product: p,
+	}, nil
+}
+
+func (impl *ProductImpl) ExportVendorSymbols(ctx context.Context, in *ExportVendorSymbolsReq) (*ExportVendorSymbolsRes, error) {
+	db := database.GetDB()
+
+	vendor := normalizeVendor(in.Vendor)
+	if vendor == "" {
+		return nil, grpcError.InvalidArgument("vendor", "is required")
+	}
+
+	mappings, err := productVendorSymbolDao.Gets(db, &productVendorSymbolDao.QueryModel{
+		Vendor: vendor,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ExportVendorSymbolsRes{
+		Mapping: []*VendorSymbolMapping{},
+	}
+	if len(mappings) == 0 {
+		return res, nil
+	}
+
+	productQuery := &productDao.QueryModel{}
+	for _, m := range mappings {
+		productQuery.IDs = append(productQuery.IDs, m.ProductID)
+	}
+	productModels, err := productDao.Gets(db, productQuery)
+	if err != nil {
+		return nil, err
+	}
+	productMap := make(map[uint64]*models.ProductModel, len(productModels))
+	for i := range productModels {
+		productMap[productModels[i].ID] = &productModels[i]
+	}
+
+	for _, m := range mappings {
+		p, ok := productMap[m.ProductID]
+		if !ok {
+			continue
+		}
+		res.Mapping = append(res.Mapping, &VendorSymbolMapping{
+			ProductID:    int64(p.ID),
+			ExchangeCode: p.ExchangeCode,
+			Code:         p.Code,
+			Symbol:       m.Symbol,
+		})
+	}
+
+	return res, nil
+}
+
+// vendors lists the vendors of the symbols once each
+func vendors(symbols []*VendorSymbol) []models.Vendor {
+	result := []models.Vendor{}
+	seen := map[models.Vendor]bool{}
+	for _, s := range symbols {
+		if v := normalizeVendor(s.Vendor); !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func normalizeVendor(vendor string) models.Vendor {
+	return models.Vendor(strings.ToLower(strings.TrimSpace(vendor)))
+}
@@ -0,0 +1,398 @@
+package product
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+	"github.com/paper-trade-chatbot/be-product/service/catalog"
+	"github.com/paper-trade-chatbot/be-product/service/grpcError"
+	"github.com/paper-trade-chatbot/be-proto/product"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// productWatchHistory is how many changes a watcher can resume over
+	productWatchHistory = 1024
+	// productWatchBuffer is how many changes a watcher may lag behind before
+	// its stream is aborted.
+	productWatchBuffer = 256
+)
+
+// WatchProductsReq filters the products to watch, the filters are combined
+// with AND and an empty one matches everything.
+type WatchProductsReq struct {
+	ExchangeCode []string
+	ProductType  []product.ProductType
+	ProductID    []int64
+	// SinceVersion resumes from the Version of the last change received. The
+	// changes of that version are sent again, the stream may have broken in
+	// the middle of them. Nil, or a version too old to resume from, starts
+	// with a snapshot.
+	SinceVersion *int64
+}
+
+type ProductChangeType int
+
+const (
+	ProductChangeType_Snapshot      ProductChangeType = 1
+	ProductChangeType_SnapshotDone  ProductChangeType = 2
+	ProductChangeType_Created       ProductChangeType = 3
+	ProductChangeType_Modified      ProductChangeType = 4
+	ProductChangeType_StatusChanged ProductChangeType = 5
+	ProductChangeType_Deleted       ProductChangeType = 6
+)
+
+// ProductChange carries the effective product after the change, or the last
+// one known for Deleted. SnapshotDone has no product.
+type ProductChange struct {
+	Type       ProductChangeType
+	Version    int64
+	Product    *product.Product
+	ProductExt *ProductExt
+	// Reset is set on SnapshotDone when SinceVersion could not be resumed
+	// from, the products missing from the snapshot are gone.
+	Reset bool
+
+	// previous is the product before a Modified or StatusChanged, the filter
+	// of a watcher turns it into Created or Deleted when the product enters
+	// or leaves the filter.
+	previous *watchedProduct
+}
+
+// ProductWatchStream is the server side of the WatchProducts stream.
+type ProductWatchStream interface {
+	Send(*ProductChange) error
+	Context() context.Context
+}
+
+// WatchProducts sends the products matching the filter, or the changes since
+// SinceVersion, then every change of the catalog until the caller is gone. A
+// caller too slow to keep up is aborted and can resume.
+func (impl *ProductImpl) WatchProducts(in *WatchProductsReq, stream ProductWatchStream) error {
+	ctx := stream.Context()
+
+	for _, id := range in.ProductID {
+		if id <= 0 {
+			return grpcError.InvalidArgument("productID", "must be positive, got %d", id)
+		}
+	}
+	filter := newProductWatchFilter(in)
+
+	watcher, initial := impl.watchHub.subscribe(in.SinceVersion)
+	if watcher == nil {
+		return status.Error(codes.Unavailable, "catalog not loaded yet")
+	}
+	defer impl.watchHub.unsubscribe(watcher)
+
+	logging.Info(ctx, "[WatchProducts] since %v, %d initial changes", in.SinceVersion, len(initial))
+
+	var version int64
+	send := func(change *ProductChange) error {
+		version = change.Version
+		if change = filter.apply(change); change == nil {
+			return nil
+		}
+		return stream.Send(change)
+	}
+
+	for _, change := range initial {
+		if err := send(change); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case change, ok := <-watcher.changes:
+			if !ok {
+				return status.Errorf(codes.Aborted, "watcher fell behind, resume from version %d", version)
+			}
+			if err := send(change); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+type productWatchFilter struct {
+	exchangeCodes map[string]bool
+	productTypes  map[product.ProductType]bool
+	productIDs    map[int64]bool
+}
+
+func newProductWatchFilter(in *WatchProductsReq) *productWatchFilter {
+	f := &productWatchFilter{}
+	if len(in.ExchangeCode) > 0 {
+		f.exchangeCodes = map[string]bool{}
+		for _, c := range in.ExchangeCode {
+			f.exchangeCodes[c] = true
+		}
+	}
+	if len(in.ProductType) > 0 {
+		f.productTypes = map[product.ProductType]bool{}
+		for _, t := range in.ProductType {
+			f.productTypes[t] = true
+		}
+	}
+	if len(in.ProductID) > 0 {
+		f.productIDs = map[int64]bool{}
+		for _, id := range in.ProductID {
+			f.productIDs[id] = true
+		}
+	}
+	return f
+}
+
+func (f *productWatchFilter) match(p *product.Product) bool {
+	return (f.exchangeCodes == nil || f.exchangeCodes[p.ExchangeCode]) &&
+		(f.productTypes == nil || f.productTypes[p.Type]) &&
+		(f.productIDs == nil || f.productIDs[p.Id])
+}
+
+// apply returns the change as the watcher of the filter sees it, nil when it
+// is not about a product of the filter. A product entering the filter is
+// Created for the watcher, one leaving it Deleted with the product the
+// watcher knew.
+func (f *productWatchFilter) apply(change *ProductChange) *ProductChange {
+	if change.Product == nil {
+		return change
+	}
+	matched := f.match(change.Product)
+	if change.previous == nil || matched == f.match(change.previous.product) {
+		if !matched {
+			return nil
+		}
+		return change
+	}
+
+	if matched {
+		return &ProductChange{
+			Type:       ProductChangeType_Created,
+			Version:    change.Version,
+			Product:    change.Product,
+			ProductExt: change.ProductExt,
+		}
+	}
+	return &ProductChange{
+		Type:       ProductChangeType_Deleted,
+		Version:    change.Version,
+		Product:    change.previous.product,
+		ProductExt: change.previous.ext,
+	}
+}
+
+// watchedProduct is a product as the callers see it, with the exchange of its
+// snapshot applied. It is shared by every watcher and never modified.
+type watchedProduct struct {
+	product *product.Product
+	ext     *ProductExt
+	// revision also moves with the writes not visible on the product, e.g.
+	// its localized names
+	revision uint64
+}
+
+type productWatcher struct {
+	changes chan *ProductChange
+}
+
+// productWatchHub turns the catalog swaps into product changes and fans them
+// out to the watchers. It keeps the recent changes so that a watcher can
+// resume without a new snapshot.
+type productWatchHub struct {
+	mutex    sync.Mutex
+	version  int64
+	products map[uint64]*watchedProduct // nil until the first load
+	// history has every change with a version above historyFrom, ordered
+	history     []*ProductChange
+	historyFrom int64
+	watchers    map[*productWatcher]struct{}
+}
+
+func newProductWatchHub() *productWatchHub {
+	return &productWatchHub{
+		watchers: map[*productWatcher]struct{}{},
+	}
+}
+
+// onSwap is the catalog listener, the catalog calls it one swap at a time.
+func (h *productWatchHub) onSwap(previous, current *catalog.Snapshot) {
+	products := watchedProducts(current)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.products == nil {
+		h.version, h.products, h.historyFrom = current.Version, products, current.Version
+		return
+	}
+
+	changes := diffWatchedProducts(h.products, products, current.Version)
+	h.products = products
+
+	switch {
+	case len(changes) == 0:
+	case current.Version <= h.version:
+		// the version did not move, e.g. Redis is down, so a watcher at this
+		// version may or may not have the changes. Resuming from it needs a
+		// snapshot.
+		h.history, h.historyFrom = nil, current.Version
+	default:
+		h.history = append(h.history, changes...)
+		h.trimHistory()
+	}
+	if current.Version > h.version {
+		h.version = current.Version
+	}
+
+	for w := range h.watchers {
+		if len(w.changes)+len(changes) > cap(w.changes) {
+			delete(h.watchers, w)
+			close(w.changes)
+			continue
+		}
+		for _, c := range changes {
+			w.changes <- c
+		}
+	}
+}
+
+// trimHistory drops the oldest versions as a whole
+func (h *productWatchHub) trimHistory() {
+	drop := 0
+	for len(h.history)-drop > productWatchHistory {
+		h.historyFrom = h.history[drop].Version
+		for drop < len(h.history) && h.history[drop].Version == h.historyFrom {
+			drop++
+		}
+	}
+	if drop > 0 {
+		h.history = append([]*ProductChange(nil), h.history[drop:]...)
+	}
+}
+
+// subscribe registers a watcher and returns what to send it first, the
+// changes since the version or a snapshot. The watcher is nil before the
+// first load.
+func (h *productWatchHub) subscribe(since *int64) (*productWatcher, []*ProductChange) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.products == nil {
+		return nil, nil
+	}
+
+	w := &productWatcher{changes: make(chan *ProductChange, productWatchBuffer)}
+	h.watchers[w] = struct{}{}
+
+	if since != nil && *since > h.historyFrom && *since <= h.version {
+		i := sort.Search(len(h.history), func(i int) bool {
+			return h.history[i].Version >= *since
+		})
+		return w, append([]*ProductChange(nil), h.history[i:]...)
+	}
+
+	ids := make([]uint64, 0, len(h.products))
+	for id := range h.products {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	initial := make([]*ProductChange, 0, len(ids)+1)
+	for _, id := range ids {
+		wp := h.products[id]
+		initial = append(initial, &ProductChange{
+			Type:       ProductChangeType_Snapshot,
+			Version:    h.version,
+			Product:    wp.product,
+			ProductExt: wp.ext,
+		})
+	}
+	initial = append(initial, &ProductChange{
+		Type:    ProductChangeType_SnapshotDone,
+		Version: h.version,
+		Reset:   since != nil,
+	})
+	return w, initial
+}
+
+func (h *productWatchHub) unsubscribe(w *productWatcher) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if _, ok := h.watchers[w]; ok {
+		delete(h.watchers, w)
+		close(w.changes)
+	}
+}
+
+func watchedProducts(s *catalog.Snapshot) map[uint64]*watchedProduct {
+	exchanges := map[string]*models.ExchangeModel{}
+	for _, e := range s.Exchanges() {
+		e := e
+		exchanges[e.Code] = &e
+	}
+
+	productModels := s.Products()
+	result := make(map[uint64]*watchedProduct, len(productModels))
+	for i := range productModels {
+		p := productModelToGrpc(&productModels[i])
+		ext := productModelToExt(&productModels[i])
+		applyExchangeModel(p, ext, exchanges[p.ExchangeCode])
+		result[productModels[i].ID] = &watchedProduct{product: p, ext: ext, revision: productModels[i].Revision}
+	}
+	return result
+}
+
+// diffWatchedProducts returns the changes from previous to current ordered by
+// product id.
+func diffWatchedProducts(previous, current map[uint64]*watchedProduct, version int64) []*ProductChange {
+	changes := []*ProductChange{}
+	for id, c := range current {
+		p, ok := previous[id]
+		changeType := ProductChangeType(0)
+		switch {
+		case !ok:
+			changeType = ProductChangeType_Created
+		case p.product.Status != c.product.Status || p.product.Display != c.product.Display ||
+			p.ext.ProductStatus != c.ext.ProductStatus || p.ext.ProductDisplay != c.ext.ProductDisplay:
+			changeType = ProductChangeType_StatusChanged
+		case p.revision != c.revision || !proto.Equal(p.product, c.product) || !reflect.DeepEqual(p.ext, c.ext):
+			changeType = ProductChangeType_Modified
+		default:
+			continue
+		}
+		change := &ProductChange{
+			Type:       changeType,
+			Version:    version,
+			Product:    c.product,
+			ProductExt: c.ext,
+		}
+		if ok {
+			change.previous = p
+		}
+		changes = append(changes, change)
+	}
+	for id, p := range previous {
+		if _, ok := current[id]; !ok {
+			changes = append(changes, &ProductChange{
+				Type:       ProductChangeType_Deleted,
+				Version:    version,
+				Product:    p.product,
+				ProductExt: p.ext,
+			})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Product.Id < changes[j].Product.Id
+	})
+	return changes
+}
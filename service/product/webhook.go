@@ -0,0 +1,370 @@
+package product
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/url"
+	"strings"
+
+	"github.com/paper-trade-chatbot/be-common/database"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"github.com/paper-trade-chatbot/be-product/dao/webhookDeliveryDao"
+	"github.com/paper-trade-chatbot/be-product/dao/webhookSubscriptionDao"
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+	"github.com/paper-trade-chatbot/be-product/service/grpcError"
+	"github.com/paper-trade-chatbot/be-product/service/webhook"
+	"github.com/paper-trade-chatbot/be-proto/product"
+)
+
+const (
+	webhookURLMaxLength         = 512
+	webhookDescriptionMaxLength = 255
+	webhookMaxEventTypes        = 32
+	webhookSecretBytes          = 32
+	webhookDeliveryMaxLimit     = 100
+)
+
+type Webhook struct {
+	ID  int64
+	URL string
+	// EventTypes are event types or "<group>.*", empty for every event
+	EventTypes  []string
+	Status      product.Status
+	Description string
+	CreatedAt   int64
+	UpdatedAt   int64
+}
+
+type WebhookDeliveryStatus int
+
+const (
+	WebhookDeliveryStatus_Pending   WebhookDeliveryStatus = WebhookDeliveryStatus(models.WebhookDeliveryStatus_Pending)
+	WebhookDeliveryStatus_Succeeded WebhookDeliveryStatus = WebhookDeliveryStatus(models.WebhookDeliveryStatus_Succeeded)
+	WebhookDeliveryStatus_Failed    WebhookDeliveryStatus = WebhookDeliveryStatus(models.WebhookDeliveryStatus_Failed)
+)
+
+type WebhookDelivery struct {
+	ID           int64
+	WebhookID    int64
+	EventID      int64
+	EventType    string
+	Status       WebhookDeliveryStatus
+	Attempts     int32
+	ResponseCode *int32
+	LastError    *string
+	// NextAttemptAt is set while the delivery is pending
+	NextAttemptAt *int64
+	CreatedAt     int64
+	DeliveredAt   *int64
+}
+
+type CreateWebhookReq struct {
+	URL         string
+	EventTypes  []string
+	Description string
+}
+
+// CreateWebhookRes has the secret the deliveries are signed with, it is not
+// returned again.
+type CreateWebhookRes struct {
+	ID     int64
+	Secret string
+}
+
+type GetWebhooksReq struct{}
+
+type GetWebhooksRes struct {
+	Webhook []*Webhook
+}
+
+type ModifyWebhookReq struct {
+	ID         int64
+	URL        *string
+	EventTypes []string
+	// SetEventTypes replaces the event types by EventTypes, even when empty
+	SetEventTypes bool
+	Status        *product.Status
+	Description   *string
+	RotateSecret  bool
+}
+
+type ModifyWebhookRes struct {
+	// Secret is set when it was rotated
+	Secret string
+}
+
+type DeleteWebhookReq struct {
+	ID int64
+}
+
+type DeleteWebhookRes struct{}
+
+type GetWebhookDeliveriesReq struct {
+	WebhookID int64
+	Status    WebhookDeliveryStatus
+	Limit     int32
+}
+
+type GetWebhookDeliveriesRes struct {
+	// Delivery is newest first
+	Delivery []*WebhookDelivery
+}
+
+// CreateWebhook registers an HTTPS endpoint for the events matching the event
+// types.
+func (impl *ProductImpl) CreateWebhook(ctx context.Context, in *CreateWebhookReq) (*CreateWebhookRes, error) {
+	db := database.GetDB()
+
+	logging.Info(ctx, "[CreateWebhook] %s %v", in.URL, in.EventTypes)
+
+	v := grpcError.Violations{}
+	webhookURL := normalizeWebhookURL(&v, in.URL)
+	eventTypes := normalizeEventTypes(&v, in.EventTypes)
+	description := strings.TrimSpace(in.Description)
+	if len(description) > webhookDescriptionMaxLength {
+		v.Add("description", "longer than %d", webhookDescriptionMaxLength)
+	}
+	if err := v.InvalidArgument(); err != nil {
+		return nil, err
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := webhookSubscriptionDao.New(db, &models.WebhookSubscriptionModel{
+		URL:         webhookURL,
+		Secret:      secret,
+		EventTypes:  webhook.EncodeEventTypes(eventTypes),
+		Status:      1,
+		Description: description,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &CreateWebhookRes{
+		ID:     int64(id),
+		Secret: secret,
+	}, nil
+}
+
+func (impl *ProductImpl) GetWebhooks(ctx context.Context, in *GetWebhooksReq) (*GetWebhooksRes, error) {
+	db := database.GetDB()
+
+	subscriptions, err := webhookSubscriptionDao.Gets(db, &webhookSubscriptionDao.QueryModel{})
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks := make([]*Webhook, 0, len(subscriptions))
+	for i := range subscriptions {
+		w, err := webhookModelToWebhook(&subscriptions[i])
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+
+	return &GetWebhooksRes{
+		Webhook: webhooks,
+	}, nil
+}
+
+func (impl *ProductImpl) ModifyWebhook(ctx context.Context, in *ModifyWebhookReq) (*ModifyWebhookRes, error) {
+	db := database.GetDB()
+
+	logging.Info(ctx, "[ModifyWebhook] %d", in.ID)
+
+	if in.ID <= 0 {
+		return nil, grpcError.InvalidArgument("id", "is required")
+	}
+	model, err := webhookSubscriptionDao.Get(db, &webhookSubscriptionDao.QueryModel{ID: uint64(in.ID)})
+	if err != nil {
+		return nil, err
+	}
+	if model == nil {
+		return nil, grpcError.NotFound("webhook", in.ID)
+	}
+
+	v := grpcError.Violations{}
+	updates := map[string]interface{}{}
+	if in.URL != nil {
+		updates["url"] = normalizeWebhookURL(&v, *in.URL)
+	}
+	if in.SetEventTypes {
+		updates["event_types"] = webhook.EncodeEventTypes(normalizeEventTypes(&v, in.EventTypes))
+	}
+	if in.Status != nil {
+		if !validToggle(int(*in.Status)) {
+			v.Add("status", "must be enabled or disabled")
+		}
+		updates["status"] = int(*in.Status)
+	}
+	if in.Description != nil {
+		description := strings.TrimSpace(*in.Description)
+		if len(description) > webhookDescriptionMaxLength {
+			v.Add("description", "longer than %d", webhookDescriptionMaxLength)
+		}
+		updates["description"] = description
+	}
+	if err := v.InvalidArgument(); err != nil {
+		return nil, err
+	}
+
+	res := &ModifyWebhookRes{}
+	if in.RotateSecret {
+		secret, err := newWebhookSecret()
+		if err != nil {
+			return nil, err
+		}
+		updates["secret"] = secret
+		res.Secret = secret
+	}
+
+	if len(updates) == 0 {
+		return res, nil
+	}
+	if err := webhookSubscriptionDao.Modify(db, model, updates); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// DeleteWebhook removes the webhook and its delivery log
+func (impl *ProductImpl) DeleteWebhook(ctx context.Context, in *DeleteWebhookReq) (*DeleteWebhookRes, error) {
+	db := database.GetDB()
+
+	logging.Info(ctx, "[DeleteWebhook] %d", in.ID)
+
+	if in.ID <= 0 {
+		return nil, grpcError.InvalidArgument("id", "is required")
+	}
+	model, err := webhookSubscriptionDao.Get(db, &webhookSubscriptionDao.QueryModel{ID: uint64(in.ID)})
+	if err != nil {
+		return nil, err
+	}
+	if model == nil {
+		return nil, grpcError.NotFound("webhook", in.ID)
+	}
+
+	if err := webhookSubscriptionDao.Delete(db, model); err != nil {
+		return nil, err
+	}
+	return &DeleteWebhookRes{}, nil
+}
+
+// GetWebhookDeliveries returns the delivery log of a webhook, newest first
+func (impl *ProductImpl) GetWebhookDeliveries(ctx context.Context, in *GetWebhookDeliveriesReq) (*GetWebhookDeliveriesRes, error) {
+	db := database.GetDB()
+
+	if in.WebhookID <= 0 {
+		return nil, grpcError.InvalidArgument("webhookID", "is required")
+	}
+	limit := int(in.Limit)
+	if limit <= 0 || limit > webhookDeliveryMaxLimit {
+		limit = webhookDeliveryMaxLimit
+	}
+
+	deliveries, err := webhookDeliveryDao.Gets(db, &webhookDeliveryDao.QueryModel{
+		SubscriptionID: uint64(in.WebhookID),
+		Status:         models.WebhookDeliveryStatus(in.Status),
+		Limit:          limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*WebhookDelivery, 0, len(deliveries))
+	for _, d := range deliveries {
+		delivery := &WebhookDelivery{
+			ID:          int64(d.ID),
+			WebhookID:   int64(d.SubscriptionID),
+			EventID:     int64(d.EventID),
+			EventType:   string(d.EventType),
+			Status:      WebhookDeliveryStatus(d.Status),
+			Attempts:    int32(d.Attempts),
+			LastError:   fromNullString(d.LastError),
+			CreatedAt:   d.CreatedAt.Unix(),
+			DeliveredAt: nullTimeToUnix(d.DeliveredAt),
+		}
+		if d.ResponseCode.Valid {
+			code := d.ResponseCode.Int32
+			delivery.ResponseCode = &code
+		}
+		if d.Status == models.WebhookDeliveryStatus_Pending {
+			at := d.NextAttemptAt.Unix()
+			delivery.NextAttemptAt = &at
+		}
+		result = append(result, delivery)
+	}
+
+	return &GetWebhookDeliveriesRes{
+		Delivery: result,
+	}, nil
+}
+
+// normalizeWebhookURL only takes an absolute https URL without credentials
+func normalizeWebhookURL(v *grpcError.Violations, value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) > webhookURLMaxLength {
+		v.Add("url", "longer than %d", webhookURLMaxLength)
+		return value
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme != "https" || u.Hostname() == "" || u.User != nil {
+		v.Add("url", "%q is not an https URL", value)
+		return value
+	}
+	return u.String()
+}
+
+// normalizeEventTypes drops the duplicates, each filter has to match a known
+// event type
+func normalizeEventTypes(v *grpcError.Violations, eventTypes []string) []string {
+	if len(eventTypes) > webhookMaxEventTypes {
+		v.Add("eventTypes", "at most %d", webhookMaxEventTypes)
+		return nil
+	}
+
+	result := []string{}
+	seen := map[string]bool{}
+	for _, t := range eventTypes {
+		t = strings.TrimSpace(t)
+		if !webhook.ValidFilter(t) {
+			v.Add("eventTypes", "unknown event type %q", t)
+			continue
+		}
+		if !seen[t] {
+			seen[t] = true
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, webhookSecretBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func webhookModelToWebhook(model *models.WebhookSubscriptionModel) (*Webhook, error) {
+	eventTypes, err := webhook.DecodeEventTypes(model.EventTypes)
+	if err != nil {
+		return nil, err
+	}
+	return &Webhook{
+		ID:          int64(model.ID),
+		URL:         model.URL,
+		EventTypes:  eventTypes,
+		Status:      product.Status(model.Status),
+		Description: model.Description,
+		CreatedAt:   model.CreatedAt.Unix(),
+		UpdatedAt:   model.UpdatedAt.Unix(),
+	}, nil
+}
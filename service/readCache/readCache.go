@@ -0,0 +1,382 @@
+// Package readCache is a Redis read-through cache in front of productDao.Get
+// and exchangeDao.Get for the lookups by id or by code. Only the plain
+// lookups are cached, any other query goes to the database.
+//
+// An entry lives until its TTL runs out or a write invalidates it, a lookup
+// of something that does not exist is cached for missTTL so that polling an
+// unknown code does not reach MySQL every time. Concurrent misses of the same
+// key share one load. Redis being down only costs the database round trip.
+//
+// Every key has a generation that an invalidation increments, a load reads
+// it before the database and only stores its result while it is unchanged.
+// A load that read a row before a write, on any replica, thus cannot store
+// the old row after the write invalidated it.
+package readCache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/paper-trade-chatbot/be-common/cache"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"github.com/paper-trade-chatbot/be-product/dao/exchangeDao"
+	"github.com/paper-trade-chatbot/be-product/dao/productDao"
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+	"golang.org/x/sync/singleflight"
+	"gorm.io/gorm"
+)
+
+const (
+	keyPrefix = "be-product:"
+
+	productTTL  = 10 * time.Minute
+	exchangeTTL = time.Hour
+	missTTL     = 30 * time.Second
+
+	// missValue marks a cached lookup that found nothing
+	missValue = "-"
+
+	invalidateBatch = 500
+
+	// generationTTL has to outlive any load, a generation that expires while
+	// a load is in flight only makes the load skip the cache
+	generationTTL = 2 * time.Hour
+)
+
+// productsGeneration is incremented by InvalidateAllProducts, it guards the
+// loads of the keys that were not cached when it ran.
+const productsGeneration = keyPrefix + "generation:product:all"
+
+// setScript stores ARGV[1] under KEYS[1] for ARGV[2] milliseconds, unless one
+// of the generations KEYS[2..] moved from the value in ARGV[3..].
+var setScript = redis.NewScript(`
+for i = 2, #KEYS do
+	if (redis.call("GET", KEYS[i]) or "") ~= ARGV[i + 1] then
+		return 0
+	end
+end
+redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+return 1
+`)
+
+var group singleflight.Group
+
+func productIDKey(id uint64) string {
+	return keyPrefix + "product:id:" + strconv.FormatUint(id, 10)
+}
+
+// productCodeKey holds the id of the product, the product itself is only
+// cached under its id so that one delete invalidates it.
+func productCodeKey(exchangeCode, code string) string {
+	return keyPrefix + "product:code:" + exchangeCode + ":" + code
+}
+
+func exchangeKey(code string) string {
+	return keyPrefix + "exchange:code:" + code
+}
+
+// generationKey is kept out of the product:* keys InvalidateAllProducts scans
+func generationKey(key string) string {
+	return keyPrefix + "generation:" + strings.TrimPrefix(key, keyPrefix)
+}
+
+// generations are the generation keys guarding key
+func generations(key string) []string {
+	if strings.HasPrefix(key, keyPrefix+"product:") {
+		return []string{generationKey(key), productsGeneration}
+	}
+	return []string{generationKey(key)}
+}
+
+// GetProduct is productDao.Get, cached when the query is by id or by exchange
+// code and code only.
+func GetProduct(ctx context.Context, db *gorm.DB, query *productDao.QueryModel) (*models.ProductModel, error) {
+	switch {
+	case query.IsByID():
+		return productByID(ctx, db, query.ID)
+	case query.IsByCode():
+		return productByCode(ctx, db, query.ExchangeCode, query.Code)
+	}
+	return productDao.Get(db, query)
+}
+
+// GetExchange is exchangeDao.Get, cached when the query is by code only.
+func GetExchange(ctx context.Context, db *gorm.DB, query *exchangeDao.QueryModel) (*models.ExchangeModel, error) {
+	if !query.IsByCode() {
+		return exchangeDao.Get(db, query)
+	}
+
+	key := exchangeKey(query.Code)
+	model := &models.ExchangeModel{}
+	if hit, found := get(ctx, key, model); hit {
+		if !found {
+			return nil, nil
+		}
+		return model, nil
+	}
+
+	v, err, _ := group.Do(key, func() (interface{}, error) {
+		generation := readGeneration(ctx, key)
+		m, err := exchangeDao.Get(db, query)
+		if err != nil {
+			return nil, err
+		}
+		if m == nil {
+			setMiss(ctx, key, generation)
+		} else {
+			set(ctx, key, generation, m, exchangeTTL)
+		}
+		return m, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	m := v.(*models.ExchangeModel)
+	if m == nil {
+		return nil, nil
+	}
+	result := *m
+	return &result, nil
+}
+
+func productByID(ctx context.Context, db *gorm.DB, id uint64) (*models.ProductModel, error) {
+	key := productIDKey(id)
+	model := &models.ProductModel{}
+	if hit, found := get(ctx, key, model); hit {
+		if !found {
+			return nil, nil
+		}
+		return model, nil
+	}
+
+	return loadProduct(ctx, key, func() (*models.ProductModel, error) {
+		generation := readGeneration(ctx, key)
+		m, err := productDao.Get(db, &productDao.QueryModel{ID: id})
+		if err != nil {
+			return nil, err
+		}
+		if m == nil {
+			setMiss(ctx, key, generation)
+		} else {
+			set(ctx, key, generation, m, productTTL)
+		}
+		return m, nil
+	})
+}
+
+func productByCode(ctx context.Context, db *gorm.DB, exchangeCode, code string) (*models.ProductModel, error) {
+	key := productCodeKey(exchangeCode, code)
+	var id uint64
+	if hit, found := get(ctx, key, &id); hit {
+		if !found {
+			return nil, nil
+		}
+		return productByID(ctx, db, id)
+	}
+
+	// the product itself is left to the next lookup by id, the generation of
+	// its id key is only known once it is loaded
+	return loadProduct(ctx, key, func() (*models.ProductModel, error) {
+		generation := readGeneration(ctx, key)
+		m, err := productDao.Get(db, &productDao.QueryModel{ExchangeCode: exchangeCode, Code: code})
+		if err != nil {
+			return nil, err
+		}
+		if m == nil {
+			setMiss(ctx, key, generation)
+		} else {
+			set(ctx, key, generation, m.ID, productTTL)
+		}
+		return m, nil
+	})
+}
+
+// loadProduct runs load once for all the concurrent misses of key, each
+// caller gets its own copy.
+func loadProduct(ctx context.Context, key string, load func() (*models.ProductModel, error)) (*models.ProductModel, error) {
+	v, err, _ := group.Do(key, func() (interface{}, error) {
+		return load()
+	})
+	if err != nil {
+		return nil, err
+	}
+	m := v.(*models.ProductModel)
+	if m == nil {
+		return nil, nil
+	}
+	result := *m
+	return &result, nil
+}
+
+// InvalidateProducts drops the products after a committed write, including
+// a cached miss of their code.
+func InvalidateProducts(ctx context.Context, products ...*models.ProductModel) {
+	keys := make([]string, 0, 2*len(products))
+	for _, p := range products {
+		keys = append(keys, productIDKey(p.ID))
+		if p.ExchangeCode != "" && p.Code != "" {
+			keys = append(keys, productCodeKey(p.ExchangeCode, p.Code))
+		}
+	}
+	del(ctx, keys)
+}
+
+// InvalidateAllProducts drops every cached product, for the writes that
+// touch too many products to list them.
+func InvalidateAllProducts(ctx context.Context) {
+	r, err := cache.GetRedis()
+	if err != nil {
+		logging.Error(ctx, "[InvalidateAllProducts] err: %v", err)
+		return
+	}
+	if err := r.Incr(ctx, productsGeneration).Err(); err != nil {
+		logging.Error(ctx, "[InvalidateAllProducts] err: %v", err)
+	}
+
+	iter := r.Scan(ctx, 0, keyPrefix+"product:*", invalidateBatch).Iterator()
+	keys := make([]string, 0, invalidateBatch)
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+		if len(keys) == invalidateBatch {
+			del(ctx, keys)
+			keys = keys[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		logging.Error(ctx, "[InvalidateAllProducts] err: %v", err)
+	}
+	del(ctx, keys)
+}
+
+// InvalidateExchanges drops the exchanges after a committed write.
+func InvalidateExchanges(ctx context.Context, codes ...string) {
+	keys := make([]string, 0, len(codes))
+	for _, c := range codes {
+		keys = append(keys, exchangeKey(c))
+	}
+	del(ctx, keys)
+}
+
+// get reports whether key is cached and whether it holds a value, which is
+// then decoded into value. A broken entry counts as not cached.
+func get(ctx context.Context, key string, value interface{}) (hit bool, found bool) {
+	r, err := cache.GetRedis()
+	if err != nil {
+		logging.Error(ctx, "[readCache] get %s err: %v", key, err)
+		return false, false
+	}
+
+	s, err := r.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return false, false
+	}
+	if err != nil {
+		logging.Error(ctx, "[readCache] get %s err: %v", key, err)
+		return false, false
+	}
+	if s == missValue {
+		return true, false
+	}
+	if err := json.Unmarshal([]byte(s), value); err != nil {
+		logging.Error(ctx, "[readCache] decode %s err: %v", key, err)
+		return false, false
+	}
+	return true, true
+}
+
+// readGeneration returns the generations guarding key, nil when they cannot
+// be read, in which case the load is not cached.
+func readGeneration(ctx context.Context, key string) []string {
+	r, err := cache.GetRedis()
+	if err != nil {
+		logging.Error(ctx, "[readCache] generation %s err: %v", key, err)
+		return nil
+	}
+
+	values, err := r.MGet(ctx, generations(key)...).Result()
+	if err != nil {
+		logging.Error(ctx, "[readCache] generation %s err: %v", key, err)
+		return nil
+	}
+	generation := make([]string, 0, len(values))
+	for _, v := range values {
+		s, _ := v.(string)
+		generation = append(generation, s)
+	}
+	return generation
+}
+
+func set(ctx context.Context, key string, generation []string, value interface{}, ttl time.Duration) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		logging.Error(ctx, "[readCache] encode %s err: %v", key, err)
+		return
+	}
+	setRaw(ctx, key, generation, string(b), jitter(ttl))
+}
+
+func setMiss(ctx context.Context, key string, generation []string) {
+	setRaw(ctx, key, generation, missValue, missTTL)
+}
+
+// setRaw stores value unless the generations moved since they were read
+func setRaw(ctx context.Context, key string, generation []string, value string, ttl time.Duration) {
+	if generation == nil {
+		return
+	}
+	r, err := cache.GetRedis()
+	if err != nil {
+		logging.Error(ctx, "[readCache] set %s err: %v", key, err)
+		return
+	}
+
+	args := make([]interface{}, 0, 2+len(generation))
+	args = append(args, value, ttl.Milliseconds())
+	for _, g := range generation {
+		args = append(args, g)
+	}
+	if err := setScript.Run(ctx, r, append([]string{key}, generations(key)...), args...).Err(); err != nil {
+		logging.Error(ctx, "[readCache] set %s err: %v", key, err)
+	}
+}
+
+// del moves the generation of the keys before dropping them, so that a load
+// in flight does not store the old row afterwards. It also forgets the loads
+// in flight, which could otherwise hand the old row to the callers arriving
+// after the write.
+func del(ctx context.Context, keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+	for _, k := range keys {
+		group.Forget(k)
+	}
+
+	r, err := cache.GetRedis()
+	if err != nil {
+		logging.Error(ctx, "[readCache] del err: %v", err)
+		return
+	}
+	_, err = r.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, k := range keys {
+			pipe.Incr(ctx, generationKey(k))
+			pipe.Expire(ctx, generationKey(k), generationTTL)
+		}
+		pipe.Del(ctx, keys...)
+		return nil
+	})
+	if err != nil {
+		logging.Error(ctx, "[readCache] del %v err: %v", keys, err)
+	}
+}
+
+// jitter spreads the expiry of the entries cached together by up to 10%
+func jitter(ttl time.Duration) time.Duration {
+	return ttl - time.Duration(rand.Int63n(int64(ttl)/10+1))
+}
@@ -0,0 +1,296 @@
+package readCache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-redis/redismock/v8"
+	"github.com/paper-trade-chatbot/be-common/cache"
+	"github.com/paper-trade-chatbot/be-product/dao/productDao"
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var productColumns = []string{"id", "exchange_code", "code", "name", "status", "display"}
+
+// newMocks points the read cache at a mocked Redis and returns a database on
+// a mocked connection, both are checked for unmet expectations at the end.
+func newMocks(t *testing.T) (*gorm.DB, sqlmock.Sqlmock, redismock.ClientMock) {
+	redisMock, closeRedis := cache.SetRedisMock()
+
+	conn, sqlMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: conn, SkipInitializeWithVersion: true}), &gorm.Config{
+		Logger: logger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		if err := redisMock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		if err := sqlMock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		closeRedis()
+		conn.Close()
+	})
+	return db, sqlMock, redisMock
+}
+
+// ignoreTTL matches the arguments of setScript but only checks that the
+// jittered TTL is within 10% under the one expected.
+func ignoreTTL(keys int) redismock.CustomMatch {
+	return func(expected, actual []interface{}) error {
+		ttlIndex := 3 + keys + 1
+		if len(expected) != len(actual) {
+			return fmt.Errorf("expected %v, got %v", expected, actual)
+		}
+		for i := range expected {
+			if i == ttlIndex {
+				want, _ := expected[i].(int64)
+				got, _ := actual[i].(int64)
+				if got > want || got < want-want/10 {
+					return fmt.Errorf("ttl %v out of %v", actual[i], expected[i])
+				}
+				continue
+			}
+			if fmt.Sprint(expected[i]) != fmt.Sprint(actual[i]) {
+				return fmt.Errorf("expected %v, got %v", expected, actual)
+			}
+		}
+		return nil
+	}
+}
+
+func productJSON(t *testing.T, m *models.ProductModel) string {
+	b, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestGetProductHit(t *testing.T) {
+	db, _, redisMock := newMocks(t)
+
+	cached := &models.ProductModel{ID: 1, ExchangeCode: "TWSE", Code: "2330", Name: "TSMC", Status: 1, Display: 1}
+	redisMock.ExpectGet(productIDKey(1)).SetVal(productJSON(t, cached))
+
+	m, err := GetProduct(context.Background(), db, &productDao.QueryModel{ID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m == nil || m.Code != "2330" || m.Name != "TSMC" {
+		t.Fatalf("got %+v", m)
+	}
+}
+
+func TestGetProductByCodeHit(t *testing.T) {
+	db, _, redisMock := newMocks(t)
+
+	cached := &models.ProductModel{ID: 1, ExchangeCode: "TWSE", Code: "2330", Name: "TSMC"}
+	redisMock.ExpectGet(productCodeKey("TWSE", "2330")).SetVal("1")
+	redisMock.ExpectGet(productIDKey(1)).SetVal(productJSON(t, cached))
+
+	m, err := GetProduct(context.Background(), db, &productDao.QueryModel{ExchangeCode: "TWSE", Code: "2330"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m == nil || m.ID != 1 {
+		t.Fatalf("got %+v", m)
+	}
+}
+
+func TestGetProductMiss(t *testing.T) {
+	db, sqlMock, redisMock := newMocks(t)
+
+	key := productIDKey(2)
+	redisMock.ExpectGet(key).RedisNil()
+	redisMock.ExpectMGet(generations(key)...).SetVal([]interface{}{"3", nil})
+	sqlMock.ExpectQuery("FROM `product`").
+		WillReturnRows(sqlmock.NewRows(productColumns).AddRow(2, "TWSE", "2317", "Foxconn", 1, 1))
+
+	loaded := &models.ProductModel{ID: 2, ExchangeCode: "TWSE", Code: "2317", Name: "Foxconn", Status: 1, Display: 1}
+	keys := append([]string{key}, generations(key)...)
+	redisMock.CustomMatch(ignoreTTL(len(keys))).
+		ExpectEvalSha(setScript.Hash(), keys, productJSON(t, loaded), productTTL.Milliseconds(), "3", "").
+		SetVal(int64(1))
+
+	m, err := GetProduct(context.Background(), db, &productDao.QueryModel{ID: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m == nil || m.Code != "2317" {
+		t.Fatalf("got %+v", m)
+	}
+}
+
+func TestGetProductNotFoundIsCached(t *testing.T) {
+	db, sqlMock, redisMock := newMocks(t)
+
+	key := productCodeKey("TWSE", "9999")
+	redisMock.ExpectGet(key).RedisNil()
+	redisMock.ExpectMGet(generations(key)...).SetVal([]interface{}{nil, "7"})
+	sqlMock.ExpectQuery("FROM `product`").WillReturnRows(sqlmock.NewRows(productColumns))
+	keys := append([]string{key}, generations(key)...)
+	redisMock.ExpectEvalSha(setScript.Hash(), keys, missValue, missTTL.Milliseconds(), "", "7").SetVal(int64(1))
+
+	m, err := GetProduct(context.Background(), db, &productDao.QueryModel{ExchangeCode: "TWSE", Code: "9999"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m != nil {
+		t.Fatalf("got %+v", m)
+	}
+}
+
+func TestGetProductCachedNotFound(t *testing.T) {
+	db, _, redisMock := newMocks(t)
+
+	redisMock.ExpectGet(productCodeKey("TWSE", "9999")).SetVal(missValue)
+
+	m, err := GetProduct(context.Background(), db, &productDao.QueryModel{ExchangeCode: "TWSE", Code: "9999"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m != nil {
+		t.Fatalf("got %+v", m)
+	}
+}
+
+func TestGetProductRedisDown(t *testing.T) {
+	db, sqlMock, redisMock := newMocks(t)
+
+	down := errors.New("dial tcp: connection refused")
+	key := productIDKey(3)
+	redisMock.ExpectGet(key).SetErr(down)
+	redisMock.ExpectMGet(generations(key)...).SetErr(down)
+	sqlMock.ExpectQuery("FROM `product`").
+		WillReturnRows(sqlmock.NewRows(productColumns).AddRow(3, "TWSE", "2454", "MediaTek", 1, 1))
+
+	// nothing is stored without the generation
+	m, err := GetProduct(context.Background(), db, &productDao.QueryModel{ID: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m == nil || m.Code != "2454" {
+		t.Fatalf("got %+v", m)
+	}
+}
+
+func TestGetProductNotCachedQuery(t *testing.T) {
+	db, sqlMock, _ := newMocks(t)
+
+	sqlMock.ExpectQuery("FROM `product`").
+		WillReturnRows(sqlmock.NewRows(productColumns).AddRow(4, "TWSE", "2412", "CHT", 1, 1))
+
+	m, err := GetProduct(context.Background(), db, &productDao.QueryModel{ID: 4, Status: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m == nil || m.ID != 4 {
+		t.Fatalf("got %+v", m)
+	}
+}
+
+func TestGetProductCollapsesConcurrentMisses(t *testing.T) {
+	db, sqlMock, redisMock := newMocks(t)
+	redisMock.MatchExpectationsInOrder(false)
+
+	const callers = 8
+	key := productIDKey(5)
+	for i := 0; i < callers; i++ {
+		redisMock.ExpectGet(key).RedisNil()
+	}
+	redisMock.ExpectMGet(generations(key)...).SetVal([]interface{}{nil, nil})
+	sqlMock.ExpectQuery("FROM `product`").
+		WillDelayFor(200 * time.Millisecond).
+		WillReturnRows(sqlmock.NewRows(productColumns).AddRow(5, "TWSE", "2603", "Evergreen", 1, 1))
+
+	loaded := &models.ProductModel{ID: 5, ExchangeCode: "TWSE", Code: "2603", Name: "Evergreen", Status: 1, Display: 1}
+	keys := append([]string{key}, generations(key)...)
+	redisMock.CustomMatch(ignoreTTL(len(keys))).
+		ExpectEvalSha(setScript.Hash(), keys, productJSON(t, loaded), productTTL.Milliseconds(), "", "").
+		SetVal(int64(1))
+
+	start := make(chan struct{})
+	results := make([]*models.ProductModel, callers)
+	errs := make([]error, callers)
+	wg := sync.WaitGroup{}
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			results[i], errs[i] = GetProduct(context.Background(), db, &productDao.QueryModel{ID: 5})
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	for i := 0; i < callers; i++ {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if results[i] == nil || results[i].Code != "2603" {
+			t.Fatalf("caller %d got %+v", i, results[i])
+		}
+	}
+	// every caller has its own copy
+	results[0].Name = "changed"
+	if results[1].Name != "Evergreen" {
+		t.Fatal("callers share the loaded product")
+	}
+}
+
+func TestInvalidateProducts(t *testing.T) {
+	_, _, redisMock := newMocks(t)
+
+	idKey := productIDKey(1)
+	codeKey := productCodeKey("TWSE", "2330")
+	redisMock.ExpectIncr(generationKey(idKey)).SetVal(1)
+	redisMock.ExpectExpire(generationKey(idKey), generationTTL).SetVal(true)
+	redisMock.ExpectIncr(generationKey(codeKey)).SetVal(1)
+	redisMock.ExpectExpire(generationKey(codeKey), generationTTL).SetVal(true)
+	redisMock.ExpectDel(idKey, codeKey).SetVal(2)
+
+	InvalidateProducts(context.Background(), &models.ProductModel{ID: 1, ExchangeCode: "TWSE", Code: "2330"})
+}
+
+func TestInvalidateAllProducts(t *testing.T) {
+	_, _, redisMock := newMocks(t)
+
+	idKey := productIDKey(1)
+	redisMock.ExpectIncr(productsGeneration).SetVal(4)
+	redisMock.ExpectScan(0, keyPrefix+"product:*", invalidateBatch).SetVal([]string{idKey}, 0)
+	redisMock.ExpectIncr(generationKey(idKey)).SetVal(1)
+	redisMock.ExpectExpire(generationKey(idKey), generationTTL).SetVal(true)
+	redisMock.ExpectDel(idKey).SetVal(1)
+
+	InvalidateAllProducts(context.Background())
+}
+
+func TestGenerationKeys(t *testing.T) {
+	if got := generationKey(productIDKey(1)); got != "be-product:generation:product:id:1" {
+		t.Fatalf("got %s", got)
+	}
+	if got := generations(productIDKey(1)); len(got) != 2 || got[1] != productsGeneration {
+		t.Fatalf("got %v", got)
+	}
+	if got := generations(exchangeKey("TWSE")); len(got) != 1 {
+		t.Fatalf("got %v", got)
+	}
+}
@@ -0,0 +1,416 @@
+package searchIndex
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+	"golang.org/x/text/width"
+)
+
+// Field tells which spelling of a product a term came from
+type Field int
+
+const (
+	Field_None Field = iota
+	Field_Code
+	Field_VendorSymbol
+	Field_Alias
+	Field_Name
+	Field_Phonetic
+)
+
+// FieldWeight ranks the same match on different fields, a hit on the code
+// over the same hit on a name
+var FieldWeight = map[Field]float64{
+	Field_Code:         1.0,
+	Field_VendorSymbol: 0.95,
+	Field_Alias:        0.95,
+	Field_Name:         0.9,
+	Field_Phonetic:     0.85,
+}
+
+type Term struct {
+	Field Field
+	Text  string
+}
+
+// Document is one product as seen by the index
+type Document struct {
+	Product models.ProductModel
+	Terms   []Term
+}
+
+// Filter drops documents from the suggestions, zero values match everything
+type Filter struct {
+	Status        int
+	Display       int
+	ProductTypes  []models.ProductType
+	ExchangeCodes []string
+	// Effective returns the status and display Status and Display are
+	// compared with, those of the product itself when nil
+	Effective func(p *models.ProductModel) (status int, display int)
+}
+
+type Suggestion struct {
+	Product     models.ProductModel
+	Field       Field
+	MatchedText string
+	Score       float64
+}
+
+// posting is one occurrence of a term or token in a document
+type posting struct {
+	productID uint64
+	field     Field
+	text      string // the whole normalized term
+	whole     bool   // the key is the whole term, not one of its tokens
+}
+
+type trieNode struct {
+	children map[rune]*trieNode
+	postings []posting
+}
+
+// Index is a prefix trie over whole terms and their tokens, plus an inverted
+// index from tokens to products used to narrow multi-word queries.
+type Index struct {
+	mu       sync.RWMutex
+	docs     map[uint64]*Document
+	root     *trieNode
+	inverted map[string]map[uint64]struct{}
+}
+
+func New() *Index {
+	return &Index{
+		docs:     map[uint64]*Document{},
+		root:     &trieNode{},
+		inverted: map[string]map[uint64]struct{}{},
+	}
+}
+
+// Build replaces the whole content of the index.
+func (idx *Index) Build(docs []*Document) {
+	fresh := New()
+	for _, d := range docs {
+		fresh.insert(d)
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.docs = fresh.docs
+	idx.root = fresh.root
+	idx.inverted = fresh.inverted
+}
+
+// Upsert adds a document, replacing the previous version of the product.
+func (idx *Index) Upsert(doc *Document) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(doc.Product.ID)
+	idx.insert(doc)
+}
+
+// Remove drops a product from the index.
+func (idx *Index) Remove(productID uint64) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(productID)
+}
+
+// Len returns the number of indexed products.
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.docs)
+}
+
+// Documents returns the documents matching filter, ordered by product id.
+// They are shared with the index and must not be modified.
+func (idx *Index) Documents(filter *Filter) []*Document {
+	idx.mu.RLock()
+	docs := make([]*Document, 0, len(idx.docs))
+	for _, d := range idx.docs {
+		if filter.match(&d.Product) {
+			docs = append(docs, d)
+		}
+	}
+	idx.mu.RUnlock()
+
+	sort.Slice(docs, func(i, j int) bool {
+		return docs[i].Product.ID < docs[j].Product.ID
+	})
+	return docs
+}
+
+// Suggest returns up to limit products completing query. Every word but the
+// last must match a whole token, the last one is completed through the trie.
+func (idx *Index) Suggest(query string, filter *Filter, limit int) []*Suggestion {
+	query = Normalize(query)
+	if query == "" || limit <= 0 {
+		return []*Suggestion{}
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	// narrow down with the complete words first
+	var allowed map[uint64]struct{}
+	words := tokenize(query)
+	if len(words) > 1 {
+		for _, w := range words[:len(words)-1] {
+			ids := idx.inverted[w]
+			if allowed == nil {
+				allowed = make(map[uint64]struct{}, len(ids))
+				for id := range ids {
+					allowed[id] = struct{}{}
+				}
+				continue
+			}
+			for id := range allowed {
+				if _, ok := ids[id]; !ok {
+					delete(allowed, id)
+				}
+			}
+		}
+	}
+
+	best := map[uint64]*Suggestion{}
+	consider := func(prefix string, isPhrase bool, restricted bool) {
+		node := idx.find(prefix)
+		if node == nil {
+			return
+		}
+		node.walk(func(p posting) {
+			if restricted && allowed != nil {
+				if _, ok := allowed[p.productID]; !ok {
+					return
+				}
+			}
+			doc := idx.docs[p.productID]
+			if doc == nil || !filter.match(&doc.Product) {
+				return
+			}
+
+			score := FieldWeight[p.field] * matchQuality(prefix, p, isPhrase)
+			if current, ok := best[p.productID]; ok && current.Score >= score {
+				return
+			}
+			best[p.productID] = &Suggestion{
+				Product:     doc.Product,
+				Field:       p.field,
+				MatchedText: p.text,
+				Score:       score,
+			}
+		})
+	}
+
+	consider(query, true, true)
+	if len(words) > 1 && len(allowed) > 0 {
+		consider(words[len(words)-1], false, true)
+	}
+	// spaced out phonetic input, e.g. "tai ji" for taijidian
+	if compact := strings.ReplaceAll(query, " ", ""); compact != query {
+		consider(compact, true, false)
+	}
+
+	suggestions := make([]*Suggestion, 0, len(best))
+	for _, s := range best {
+		suggestions = append(suggestions, s)
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Score != suggestions[j].Score {
+			return suggestions[i].Score > suggestions[j].Score
+		}
+		if len(suggestions[i].Product.Code) != len(suggestions[j].Product.Code) {
+			return len(suggestions[i].Product.Code) < len(suggestions[j].Product.Code)
+		}
+		return suggestions[i].Product.Code < suggestions[j].Product.Code
+	})
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions
+}
+
+// Normalize folds width and case, and collapses spaces.
+func Normalize(text string) string {
+	return strings.Join(strings.Fields(strings.ToLower(width.Fold.String(text))), " ")
+}
+
+// matchQuality prefers whole-term hits over token hits, and exact hits over
+// prefixes of long terms.
+func matchQuality(prefix string, p posting, isPhrase bool) float64 {
+	quality := 0.6
+	if p.whole {
+		quality = 0.8
+	}
+	key := p.text
+	if !p.whole {
+		quality -= 0.1
+	}
+	if !isPhrase {
+		quality -= 0.1
+	}
+	if prefix == key {
+		return quality + 0.2
+	}
+	return quality + 0.2*float64(len(prefix))/float64(len(key)+1)
+}
+
+func (f *Filter) match(p *models.ProductModel) bool {
+	if f == nil {
+		return true
+	}
+	status, display := p.Status, p.Display
+	if f.Effective != nil {
+		status, display = f.Effective(p)
+	}
+	if f.Status != 0 && status != f.Status {
+		return false
+	}
+	if f.Display != 0 && display != f.Display {
+		return false
+	}
+	if len(f.ProductTypes) > 0 {
+		found := false
+		for _, t := range f.ProductTypes {
+			if t == p.Type {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(f.ExchangeCodes) > 0 {
+		found := false
+		for _, e := range f.ExchangeCodes {
+			if e == p.ExchangeCode {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (idx *Index) insert(doc *Document) {
+	id := doc.Product.ID
+	idx.docs[id] = doc
+
+	for _, term := range doc.Terms {
+		text := Normalize(term.Text)
+		if text == "" {
+			continue
+		}
+		idx.add(text, posting{productID: id, field: term.Field, text: text, whole: true})
+
+		tokens := tokenize(text)
+		if len(tokens) < 2 {
+			continue
+		}
+		for _, token := range tokens {
+			idx.add(token, posting{productID: id, field: term.Field, text: text})
+			if idx.inverted[token] == nil {
+				idx.inverted[token] = map[uint64]struct{}{}
+			}
+			idx.inverted[token][id] = struct{}{}
+		}
+	}
+}
+
+func (idx *Index) remove(productID uint64) {
+	doc, ok := idx.docs[productID]
+	if !ok {
+		return
+	}
+	delete(idx.docs, productID)
+
+	for _, term := range doc.Terms {
+		text := Normalize(term.Text)
+		if text == "" {
+			continue
+		}
+		idx.drop(text, productID)
+		tokens := tokenize(text)
+		if len(tokens) < 2 {
+			continue
+		}
+		for _, token := range tokens {
+			idx.drop(token, productID)
+			if ids, ok := idx.inverted[token]; ok {
+				delete(ids, productID)
+				if len(ids) == 0 {
+					delete(idx.inverted, token)
+				}
+			}
+		}
+	}
+}
+
+func (idx *Index) add(key string, p posting) {
+	node := idx.root
+	for _, r := range key {
+		if node.children == nil {
+			node.children = map[rune]*trieNode{}
+		}
+		child, ok := node.children[r]
+		if !ok {
+			child = &trieNode{}
+			node.children[r] = child
+		}
+		node = child
+	}
+	node.postings = append(node.postings, p)
+}
+
+// drop removes the postings of a product under key, empty branches are kept
+// since they are cheap and likely to be filled again by the next upsert.
+func (idx *Index) drop(key string, productID uint64) {
+	node := idx.find(key)
+	if node == nil {
+		return
+	}
+	kept := node.postings[:0]
+	for _, p := range node.postings {
+		if p.productID != productID {
+			kept = append(kept, p)
+		}
+	}
+	node.postings = kept
+}
+
+func (idx *Index) find(prefix string) *trieNode {
+	node := idx.root
+	for _, r := range prefix {
+		child, ok := node.children[r]
+		if !ok {
+			return nil
+		}
+		node = child
+	}
+	return node
+}
+
+func (node *trieNode) walk(visit func(posting)) {
+	for _, p := range node.postings {
+		visit(p)
+	}
+	for _, child := range node.children {
+		child.walk(visit)
+	}
+}
+
+// tokenize splits on anything that is not a letter or a digit
+func tokenize(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
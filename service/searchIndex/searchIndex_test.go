@@ -0,0 +1,138 @@
+package searchIndex
+
+import (
+	"math"
+	"testing"
+
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+)
+
+func doc(id uint64, exchangeCode, code string, terms ...Term) *Document {
+	return &Document{
+		Product: models.ProductModel{ID: id, ExchangeCode: exchangeCode, Code: code, Status: 1, Display: 1},
+		Terms:   append([]Term{{Field: Field_Code, Text: code}}, terms...),
+	}
+}
+
+func testIndex() *Index {
+	idx := New()
+	idx.Build([]*Document{
+		doc(1, "NYSE", "TSM", Term{Field_Name, "Taiwan Semiconductor ADR"}),
+		doc(2, "TWSE", "2330", Term{Field_Name, "Taiwan Semiconductor"}, Term{Field_Alias, "TSMC"}),
+		doc(3, "TWSE", "3045", Term{Field_Name, "Taiwan Mobile"}),
+		doc(4, "NASDAQ", "SMCI", Term{Field_Name, "Super Micro Computer"}),
+		doc(5, "TWSE", "2412", Term{Field_Name, "Chunghwa Telecom"}, Term{Field_Phonetic, "zhonghuadianxin"}),
+	})
+	return idx
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestSuggestScores(t *testing.T) {
+	idx := testIndex()
+
+	cases := map[string]struct {
+		query string
+		// want lists the products by rank with their field and score
+		want []Suggestion
+	}{
+		// an exact hit on the whole term
+		"exact code": {"tsm", []Suggestion{
+			{Product: models.ProductModel{ID: 1}, Field: Field_Code, Score: FieldWeight[Field_Code] * 1.0},
+			// a prefix of the alias
+			{Product: models.ProductModel{ID: 2}, Field: Field_Alias, Score: FieldWeight[Field_Alias] * (0.8 + 0.2*3/5)},
+		}},
+		// the alias hit outranks the name of the same product
+		"exact alias": {"tsmc", []Suggestion{
+			{Product: models.ProductModel{ID: 2}, Field: Field_Alias, Score: FieldWeight[Field_Alias] * 1.0},
+		}},
+		// a token of a longer name scores below a prefix of the whole term
+		"name token": {"mobile", []Suggestion{
+			{Product: models.ProductModel{ID: 3}, Field: Field_Name, Score: FieldWeight[Field_Name] * (0.5 + 0.2*6/14)},
+		}},
+		// the complete words narrow down through the inverted index, the
+		// phrase itself is a prefix of both names
+		"phrase": {"taiwan semi", []Suggestion{
+			{Product: models.ProductModel{ID: 2}, Field: Field_Name, Score: FieldWeight[Field_Name] * (0.8 + 0.2*11/21)},
+			{Product: models.ProductModel{ID: 1}, Field: Field_Name, Score: FieldWeight[Field_Name] * (0.8 + 0.2*11/25)},
+		}},
+		// the last word alone is completed within the narrowed products
+		"last word": {"taiwan mob", []Suggestion{
+			{Product: models.ProductModel{ID: 3}, Field: Field_Name, Score: FieldWeight[Field_Name] * (0.8 + 0.2*10/14)},
+		}},
+		// spaced out phonetic input
+		"phonetic": {"zhong hua", []Suggestion{
+			{Product: models.ProductModel{ID: 5}, Field: Field_Phonetic, Score: FieldWeight[Field_Phonetic] * (0.8 + 0.2*8/16)},
+		}},
+		"full width": {"ＴＳＭＣ", []Suggestion{
+			{Product: models.ProductModel{ID: 2}, Field: Field_Alias, Score: FieldWeight[Field_Alias] * 1.0},
+		}},
+		"no match": {"xyz", []Suggestion{}},
+	}
+	for name, c := range cases {
+		got := idx.Suggest(c.query, nil, 10)
+		if len(got) != len(c.want) {
+			t.Errorf("%s: got %d suggestions, want %d", name, len(got), len(c.want))
+			continue
+		}
+		for i, want := range c.want {
+			if got[i].Product.ID != want.Product.ID || got[i].Field != want.Field || !near(got[i].Score, want.Score) {
+				t.Errorf("%s: suggestion %d is product %d on %d scoring %v, want product %d on %d scoring %v",
+					name, i, got[i].Product.ID, got[i].Field, got[i].Score, want.Product.ID, want.Field, want.Score)
+			}
+		}
+	}
+}
+
+func TestSuggestFilterAndLimit(t *testing.T) {
+	idx := testIndex()
+
+	// the shorter name is the closer hit
+	got := idx.Suggest("taiwan", &Filter{ExchangeCodes: []string{"TWSE"}}, 10)
+	if len(got) != 2 || got[0].Product.ID != 3 || got[1].Product.ID != 2 {
+		t.Fatalf("got %+v", got)
+	}
+
+	// equal scores are ordered by the length of the code, then the code
+	got = idx.Suggest("2", nil, 10)
+	if len(got) != 2 || got[0].Product.Code != "2330" || got[1].Product.Code != "2412" || got[0].Score != got[1].Score {
+		t.Fatalf("got %+v", got)
+	}
+	if got = idx.Suggest("2", nil, 1); len(got) != 1 || got[0].Product.Code != "2330" {
+		t.Fatalf("got %+v", got)
+	}
+
+	disabled := &Filter{Status: 1, Effective: func(p *models.ProductModel) (int, int) {
+		if p.ExchangeCode == "TWSE" {
+			return 2, 1
+		}
+		return p.Status, p.Display
+	}}
+	if got := idx.Suggest("2330", disabled, 10); len(got) != 0 {
+		t.Fatalf("got %+v", got)
+	}
+}
+
+func TestUpsertAndRemove(t *testing.T) {
+	idx := testIndex()
+
+	idx.Upsert(doc(3, "TWSE", "3045", Term{Field_Name, "Taiwan Mobile Telecom"}))
+	if got := idx.Suggest("taiwan tel", nil, 10); len(got) != 1 || got[0].Product.ID != 3 {
+		t.Fatalf("got %+v", got)
+	}
+	// the previous spelling is gone from the trie and the inverted index
+	idx.Upsert(doc(3, "TWSE", "3045", Term{Field_Name, "TWM"}))
+	if got := idx.Suggest("taiwan mob", nil, 10); len(got) != 0 {
+		t.Fatalf("got %+v", got)
+	}
+
+	idx.Remove(2)
+	if got := idx.Suggest("tsmc", nil, 10); len(got) != 0 {
+		t.Fatalf("got %+v", got)
+	}
+	if idx.Len() != 4 {
+		t.Fatalf("%d documents", idx.Len())
+	}
+}
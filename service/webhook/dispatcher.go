@@ -0,0 +1,233 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-common/database"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"github.com/paper-trade-chatbot/be-product/dao/webhookDeliveryDao"
+	"github.com/paper-trade-chatbot/be-product/dao/webhookSubscriptionDao"
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+)
+
+const (
+	dispatchInterval = time.Second
+	dispatchBatch    = 20
+	requestTimeout   = 10 * time.Second
+	// dispatchLease keeps the claimed deliveries from the other dispatchers,
+	// it is well above requestTimeout since a batch is sent in parallel.
+	dispatchLease = time.Minute
+
+	// a delivery still failing after maxAttempts is given up
+	maxAttempts = 8
+	retryBase   = 10 * time.Second
+	retryMax    = time.Hour
+
+	// the finished deliveries are kept for retention, for investigations
+	retention       = 7 * 24 * time.Hour
+	cleanupInterval = time.Hour
+	cleanupBatch    = 500
+
+	lastErrorMaxLength = 512
+	// responseSnippet is how much of a failed response is kept
+	responseSnippet = 256
+)
+
+type Dispatcher struct {
+	client *http.Client
+}
+
+// NewDispatcher sends with the client, nil for one that does not follow
+// redirects and gives up after requestTimeout.
+func NewDispatcher(client *http.Client) *Dispatcher {
+	if client == nil {
+		client = &http.Client{
+			Timeout: requestTimeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+	}
+	return &Dispatcher{client: client}
+}
+
+// Start sends the due deliveries until ctx is done. Any number of replicas
+// can run it, a delivery is only claimed by one of them at a time. The
+// deliveries of a subscription may arrive out of order. The succeeded and
+// failed deliveries are deleted after retention.
+func (d *Dispatcher) Start(ctx context.Context) {
+	ticker := time.NewTicker(dispatchInterval)
+	defer ticker.Stop()
+	cleanup := time.NewTicker(cleanupInterval)
+	defer cleanup.Stop()
+
+	for {
+		// a full batch means more deliveries are due
+		for {
+			n, err := d.dispatch(ctx, time.Now())
+			if err != nil {
+				logging.Error(ctx, "[Dispatcher] err: %v", err)
+				break
+			}
+			if n < dispatchBatch {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-cleanup.C:
+			deleteFinished(ctx, time.Now().Add(-retention))
+		case <-ticker.C:
+		}
+	}
+}
+
+func deleteFinished(ctx context.Context, before time.Time) {
+	db := database.GetDB()
+	for {
+		n, err := webhookDeliveryDao.DeleteFinished(db, before, cleanupBatch)
+		if err != nil {
+			logging.Error(ctx, "[deleteFinished] err: %v", err)
+			return
+		}
+		if n < cleanupBatch {
+			return
+		}
+	}
+}
+
+// dispatch sends one batch of due deliveries and returns how many it took
+func (d *Dispatcher) dispatch(ctx context.Context, now time.Time) (int, error) {
+	db := database.GetDB()
+
+	deliveries, err := webhookDeliveryDao.Claim(db, now, now.Add(dispatchLease), dispatchBatch)
+	if err != nil || len(deliveries) == 0 {
+		return 0, err
+	}
+
+	subscriptions := map[uint64]*models.WebhookSubscriptionModel{}
+	for _, delivery := range deliveries {
+		if _, ok := subscriptions[delivery.SubscriptionID]; ok {
+			continue
+		}
+		s, err := webhookSubscriptionDao.Get(db, &webhookSubscriptionDao.QueryModel{ID: delivery.SubscriptionID})
+		if err != nil {
+			// the lease runs out and the batch is claimed again
+			return 0, err
+		}
+		subscriptions[delivery.SubscriptionID] = s
+	}
+
+	wg := sync.WaitGroup{}
+	for i := range deliveries {
+		wg.Add(1)
+		go func(delivery *models.WebhookDeliveryModel) {
+			defer wg.Done()
+
+			updates := d.deliver(ctx, delivery, subscriptions[delivery.SubscriptionID], now)
+			if err := webhookDeliveryDao.Modify(db, delivery, updates); err != nil {
+				logging.Error(ctx, "[Dispatcher] delivery %d err: %v", delivery.ID, err)
+			}
+		}(&deliveries[i])
+	}
+	wg.Wait()
+
+	return len(deliveries), nil
+}
+
+// deliver sends the delivery once and returns how to update it
+func (d *Dispatcher) deliver(ctx context.Context, delivery *models.WebhookDeliveryModel, subscription *models.WebhookSubscriptionModel, now time.Time) map[string]interface{} {
+	attempts := delivery.Attempts + 1
+
+	if subscription == nil || subscription.Status != 1 {
+		return map[string]interface{}{
+			"status":     models.WebhookDeliveryStatus_Failed,
+			"attempts":   attempts,
+			"last_error": "subscription deleted or disabled",
+		}
+	}
+
+	code, err := d.post(ctx, delivery, subscription)
+	updates := map[string]interface{}{
+		"attempts": attempts,
+	}
+	if code != 0 {
+		updates["response_code"] = code
+	}
+
+	if err == nil {
+		updates["status"] = models.WebhookDeliveryStatus_Succeeded
+		updates["delivered_at"] = time.Now()
+		updates["last_error"] = nil
+		return updates
+	}
+
+	updates["last_error"] = lastError(err)
+	if attempts >= maxAttempts {
+		logging.Error(ctx, "[Dispatcher] delivery %d to webhook %d given up after %d attempts: %v", delivery.ID, subscription.ID, attempts, err)
+		updates["status"] = models.WebhookDeliveryStatus_Failed
+	} else {
+		updates["next_attempt_at"] = now.Add(retryDelay(attempts))
+	}
+	return updates
+}
+
+// post returns the status code of the response, 0 without one, and an error
+// unless it is a 2xx.
+func (d *Dispatcher) post(ctx context.Context, delivery *models.WebhookDeliveryModel, subscription *models.WebhookSubscriptionModel) (int, error) {
+	body := []byte(delivery.Body)
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "be-product-webhook")
+	req.Header.Set(SignatureHeader, Sign(subscription.Secret, time.Now(), body))
+	req.Header.Set(EventTypeHeader, string(delivery.EventType))
+	req.Header.Set(EventIDHeader, strconv.FormatUint(delivery.EventID, 10))
+	req.Header.Set(DeliveryHeader, strconv.FormatUint(delivery.ID, 10))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp.StatusCode, nil
+	}
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, responseSnippet))
+	return resp.StatusCode, fmt.Errorf("HTTP %d: %s", resp.StatusCode, snippet)
+}
+
+// retryDelay doubles from retryBase up to retryMax
+func retryDelay(attempts int) time.Duration {
+	delay := retryBase
+	for i := 1; i < attempts && delay < retryMax; i++ {
+		delay *= 2
+	}
+	if delay > retryMax {
+		delay = retryMax
+	}
+	return delay
+}
+
+func lastError(err error) string {
+	message := err.Error()
+	if len(message) > lastErrorMaxLength {
+		message = message[:lastErrorMaxLength]
+	}
+	return message
+}
@@ -0,0 +1,184 @@
+// Package webhook delivers the catalog events to the HTTPS endpoints the
+// partners register. When the outbox relay publishes an event, Publisher
+// queues a delivery for every subscription matching it. The Dispatcher then
+// sends the deliveries signed with the secret of their subscription and
+// retries them with exponential backoff. Each delivery keeps the outcome of
+// its last attempt.
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-common/database"
+	"github.com/paper-trade-chatbot/be-product/dao/webhookDeliveryDao"
+	"github.com/paper-trade-chatbot/be-product/dao/webhookSubscriptionDao"
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+	"github.com/paper-trade-chatbot/be-product/service/event"
+)
+
+const (
+	// SignatureHeader is "t=<unix time>,v1=<hex HMAC-SHA256>", the HMAC is
+	// over "<unix time>.<body>" with the secret of the subscription.
+	SignatureHeader = "X-Webhook-Signature"
+	EventTypeHeader = "X-Webhook-Event"
+	// EventIDHeader stays the same when an event is delivered again
+	EventIDHeader  = "X-Webhook-Event-ID"
+	DeliveryHeader = "X-Webhook-Delivery"
+
+	signatureVersion = "v1"
+)
+
+// Body is the JSON posted to the endpoints
+type Body struct {
+	ID           uint64                 `json:"id"`
+	Type         string                 `json:"type"`
+	OccurredAt   int64                  `json:"occurredAt"`
+	ProductID    uint64                 `json:"productId,omitempty"`
+	ExchangeCode string                 `json:"exchangeCode,omitempty"`
+	Payload      map[string]interface{} `json:"payload"`
+}
+
+// Publisher is the event.Publisher queueing the deliveries. An event
+// published again is not queued twice for a subscription.
+type Publisher struct{}
+
+func (p *Publisher) Publish(ctx context.Context, e *event.Event) error {
+	db := database.GetDB()
+
+	subscriptions, err := webhookSubscriptionDao.Gets(db, &webhookSubscriptionDao.QueryModel{Status: 1})
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(&Body{
+		ID:           e.ID,
+		Type:         string(e.Type),
+		OccurredAt:   e.OccurredAt.Unix(),
+		ProductID:    e.ProductID,
+		ExchangeCode: e.ExchangeCode,
+		Payload:      e.Payload,
+	})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	rows := []*models.WebhookDeliveryModel{}
+	for _, s := range subscriptions {
+		filters, err := DecodeEventTypes(s.EventTypes)
+		if err != nil {
+			return fmt.Errorf("webhook %d: %w", s.ID, err)
+		}
+		if !Matches(filters, string(e.Type)) {
+			continue
+		}
+		rows = append(rows, &models.WebhookDeliveryModel{
+			SubscriptionID: s.ID,
+			EventID:        e.ID,
+			EventType:      models.EventType(e.Type),
+			Body:           string(body),
+			Status:         models.WebhookDeliveryStatus_Pending,
+			NextAttemptAt:  now,
+		})
+	}
+	return webhookDeliveryDao.NewsIgnoreDuplicate(db, rows)
+}
+
+// Matches reports whether an event type passes the filters. A filter is an
+// event type, or "<group>.*" for every event type of the group, e.g.
+// "product.*". No filter matches every event type.
+func Matches(filters []string, eventType string) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	for _, f := range filters {
+		if f == eventType || (strings.HasSuffix(f, ".*") && strings.HasPrefix(eventType, strings.TrimSuffix(f, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidFilter reports whether the filter matches at least one known event
+// type.
+func ValidFilter(filter string) bool {
+	for _, t := range models.EventTypes {
+		if Matches([]string{filter}, string(t)) {
+			return true
+		}
+	}
+	return false
+}
+
+func EncodeEventTypes(filters []string) string {
+	if filters == nil {
+		filters = []string{}
+	}
+	b, _ := json.Marshal(filters)
+	return string(b)
+}
+
+func DecodeEventTypes(value string) ([]string, error) {
+	filters := []string{}
+	if value == "" {
+		return filters, nil
+	}
+	if err := json.Unmarshal([]byte(value), &filters); err != nil {
+		return nil, fmt.Errorf("event types: %w", err)
+	}
+	return filters, nil
+}
+
+// Sign returns the SignatureHeader value of the body sent at the time
+func Sign(secret string, at time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	return "t=" + timestamp + "," + signatureVersion + "=" + signature(secret, timestamp, body)
+}
+
+// Verify checks a SignatureHeader value the way a receiver should, the
+// signature must be no older than tolerance.
+func Verify(secret, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var timestamp, signed string
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(part, "=")
+		switch k {
+		case "t":
+			timestamp = v
+		case signatureVersion:
+			signed = v
+		}
+	}
+	if timestamp == "" || signed == "" {
+		return errors.New("malformed signature")
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("malformed signature time")
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return errors.New("signature expired")
+	}
+
+	if !hmac.Equal([]byte(signed), []byte(signature(secret, timestamp, body))) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+func signature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
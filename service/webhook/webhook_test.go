@@ -0,0 +1,213 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	models "github.com/paper-trade-chatbot/be-product/models/databaseModels"
+)
+
+const testSecret = "whsec_test"
+
+func TestSignVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"id":1,"type":"product.modified"}`)
+	header := Sign(testSecret, now, body)
+
+	if err := Verify(testSecret, header, body, now.Add(time.Minute), 5*time.Minute); err != nil {
+		t.Fatalf("valid signature: %v", err)
+	}
+
+	cases := map[string]struct {
+		secret string
+		header string
+		body   []byte
+		now    time.Time
+	}{
+		"tampered body": {testSecret, header, []byte(`{"id":2,"type":"product.modified"}`), now},
+		"other secret":  {"whsec_other", header, body, now},
+		"expired":       {testSecret, header, body, now.Add(10 * time.Minute)},
+		"from future":   {testSecret, header, body, now.Add(-10 * time.Minute)},
+		"malformed":     {testSecret, "v1=abc", body, now},
+		"bad time":      {testSecret, "t=abc,v1=abc", body, now},
+	}
+	for name, c := range cases {
+		if err := Verify(c.secret, c.header, c.body, c.now, 5*time.Minute); err == nil {
+			t.Errorf("%s: verified", name)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	cases := map[int]time.Duration{
+		1:  retryBase,
+		2:  2 * retryBase,
+		3:  4 * retryBase,
+		7:  64 * retryBase,
+		9:  256 * retryBase,
+		10: retryMax,
+		50: retryMax,
+	}
+	for attempts, want := range cases {
+		if got := retryDelay(attempts); got != want {
+			t.Errorf("retryDelay(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
+
+// newTestDispatcher is the default dispatcher trusting the certificate of srv
+func newTestDispatcher(srv *httptest.Server) *Dispatcher {
+	d := NewDispatcher(nil)
+	d.client.Transport = srv.Client().Transport
+	return d
+}
+
+func testDelivery(attempts int) *models.WebhookDeliveryModel {
+	return &models.WebhookDeliveryModel{
+		ID:             7,
+		SubscriptionID: 3,
+		EventID:        42,
+		EventType:      models.EventType_ProductModified,
+		Body:           `{"id":42,"type":"product.modified","payload":{}}`,
+		Status:         models.WebhookDeliveryStatus_Pending,
+		Attempts:       attempts,
+	}
+}
+
+func testSubscription(url string) *models.WebhookSubscriptionModel {
+	return &models.WebhookSubscriptionModel{
+		ID:     3,
+		URL:    url,
+		Secret: testSecret,
+		Status: 1,
+	}
+}
+
+func TestDeliverSigned(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := Verify(testSecret, r.Header.Get(SignatureHeader), body, time.Now(), time.Minute); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get(EventTypeHeader) != "product.modified" || r.Header.Get(EventIDHeader) != "42" || r.Header.Get(DeliveryHeader) != "7" {
+			http.Error(w, "headers", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	now := time.Now()
+	updates := newTestDispatcher(srv).deliver(context.Background(), testDelivery(0), testSubscription(srv.URL), now)
+
+	if updates["status"] != models.WebhookDeliveryStatus_Succeeded {
+		t.Fatalf("got %v", updates)
+	}
+	if updates["attempts"] != 1 || updates["response_code"] != http.StatusNoContent {
+		t.Fatalf("got %v", updates)
+	}
+}
+
+func TestDeliverRetriesOn5xx(t *testing.T) {
+	var hits int32
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		http.Error(w, "busy", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	d := newTestDispatcher(srv)
+	now := time.Now()
+	for _, attempts := range []int{0, 1, 2} {
+		updates := d.deliver(context.Background(), testDelivery(attempts), testSubscription(srv.URL), now)
+
+		if _, ok := updates["status"]; ok {
+			t.Fatalf("attempt %d: got %v", attempts+1, updates)
+		}
+		if updates["attempts"] != attempts+1 || updates["response_code"] != http.StatusServiceUnavailable {
+			t.Fatalf("attempt %d: got %v", attempts+1, updates)
+		}
+		if want := now.Add(retryDelay(attempts + 1)); updates["next_attempt_at"] != want {
+			t.Fatalf("attempt %d: next attempt %v, want %v", attempts+1, updates["next_attempt_at"], want)
+		}
+		if lastError, _ := updates["last_error"].(string); !strings.Contains(lastError, "HTTP 503: busy") {
+			t.Fatalf("attempt %d: last error %q", attempts+1, lastError)
+		}
+	}
+	if hits != 3 {
+		t.Fatalf("%d requests", hits)
+	}
+}
+
+func TestDeliverGivesUp(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	updates := newTestDispatcher(srv).deliver(context.Background(), testDelivery(maxAttempts-1), testSubscription(srv.URL), time.Now())
+
+	if updates["status"] != models.WebhookDeliveryStatus_Failed || updates["attempts"] != maxAttempts {
+		t.Fatalf("got %v", updates)
+	}
+	if _, ok := updates["next_attempt_at"]; ok {
+		t.Fatalf("retried after %d attempts: %v", maxAttempts, updates)
+	}
+}
+
+func TestDeliverDoesNotFollowRedirects(t *testing.T) {
+	var followed int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hook", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/elsewhere", http.StatusTemporaryRedirect)
+	})
+	mux.HandleFunc("/elsewhere", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&followed, 1)
+		w.WriteHeader(http.StatusOK)
+	})
+	srv := httptest.NewTLSServer(mux)
+	defer srv.Close()
+
+	updates := newTestDispatcher(srv).deliver(context.Background(), testDelivery(0), testSubscription(srv.URL+"/hook"), time.Now())
+
+	if followed != 0 {
+		t.Fatal("redirect followed")
+	}
+	if updates["response_code"] != http.StatusTemporaryRedirect {
+		t.Fatalf("got %v", updates)
+	}
+	if _, ok := updates["next_attempt_at"]; !ok {
+		t.Fatalf("redirect not retried: %v", updates)
+	}
+}
+
+func TestDeliverDisabledSubscription(t *testing.T) {
+	var hits int32
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+	}))
+	defer srv.Close()
+
+	d := newTestDispatcher(srv)
+	disabled := testSubscription(srv.URL)
+	disabled.Status = 2
+	for name, subscription := range map[string]*models.WebhookSubscriptionModel{
+		"disabled": disabled,
+		"deleted":  nil,
+	} {
+		updates := d.deliver(context.Background(), testDelivery(0), subscription, time.Now())
+		if updates["status"] != models.WebhookDeliveryStatus_Failed {
+			t.Fatalf("%s: got %v", name, updates)
+		}
+	}
+	if hits != 0 {
+		t.Fatalf("%d requests", hits)
+	}
+}